@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Access control. A resource with Access set is visible only to members of
+// its teams, channels or groups and to the listed users; to everyone else it
+// behaves as if it did not exist, in listings, status, booking, queueing and
+// subscriptions alike. Resources without Access are open to all, and their
+// managers (see roles.go) always see them.
+
+const maxAccessEntries = 50
+
+// errNoAccess is returned when a booking is made or handed over to a user
+// who may not access the resource.
+var errNoAccess = errors.New("user has no access to the resource")
+
+// accessChecker returns a function reporting whether userID may use a
+// resource. The user's teams and groups are looked up once and channel
+// memberships once per channel, so checking a whole list stays cheap.
+func (p *Plugin) accessChecker(userID string) func(res *Resource) bool {
+	manages := p.managerChecker(userID)
+	var teams, groups []string
+	loaded := false
+	channels := map[string]bool{}
+	return func(res *Resource) bool {
+		a := res.Access
+		if a == nil || containsString(a.Users, userID) || manages(res) {
+			return true
+		}
+		if !loaded {
+			loaded = true
+			if ts, appErr := p.API.GetTeamsForUser(userID); appErr == nil {
+				for _, t := range ts {
+					teams = append(teams, t.Id)
+				}
+			}
+			groups = p.userGroups(userID)
+		}
+		if intersects(a.Teams, teams) || intersects(a.Groups, groups) {
+			return true
+		}
+		for _, ch := range a.Channels {
+			member, seen := channels[ch]
+			if !seen {
+				_, appErr := p.API.GetChannelMember(ch, userID)
+				member = appErr == nil
+				channels[ch] = member
+			}
+			if member {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// canAccess reports whether userID may see and use res.
+func (p *Plugin) canAccess(userID string, res *Resource) bool {
+	return p.accessChecker(userID)(res)
+}
+
+// visibleResources returns the resources userID may see.
+func (p *Plugin) visibleResources(userID string) ([]*Resource, error) {
+	resources, err := p.store.GetAllResources()
+	if err != nil {
+		return nil, err
+	}
+	allowed := p.accessChecker(userID)
+	out := resources[:0]
+	for _, r := range resources {
+		if allowed(r) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+// visibleEntries returns the index entries of the resources userID may see.
+func (p *Plugin) visibleEntries(userID string) ([]*indexEntry, error) {
+	entries, err := p.store.IndexEntries()
+	if err != nil {
+		return nil, err
+	}
+	allowed := p.accessChecker(userID)
+	out := entries[:0]
+	for _, e := range entries {
+		if allowed(&e.Resource) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// resourceFor loads resource id for userID; one they may not access is
+// reported as missing (nil, nil), like GetResource does.
+func (p *Plugin) resourceFor(userID, id string) (*Resource, error) {
+	res, err := p.store.GetResource(id)
+	if err != nil || res == nil {
+		return res, err
+	}
+	if !p.canAccess(userID, res) {
+		return nil, nil
+	}
+	return res, nil
+}
+
+// checkAccessAll fails for the first of members userID may not access,
+// reporting it as missing.
+func (p *Plugin) checkAccessAll(userID string, members []*Resource) error {
+	allowed := p.accessChecker(userID)
+	for _, m := range members {
+		if !allowed(m) {
+			return fmt.Errorf("resource %s not found", m.ID)
+		}
+	}
+	return nil
+}
+
+// describeAccess renders res.Access for chat, or "" if it is open to all.
+func (p *Plugin) describeAccess(res *Resource) string {
+	a := res.Access
+	if a == nil {
+		return ""
+	}
+	var parts []string
+	for _, id := range a.Teams {
+		if t, appErr := p.API.GetTeam(id); appErr == nil {
+			parts = append(parts, "команда `"+t.Name+"`")
+		}
+	}
+	for _, id := range a.Channels {
+		if ch, appErr := p.API.GetChannel(id); appErr == nil {
+			parts = append(parts, "канал ~"+ch.Name)
+		}
+	}
+	for _, g := range a.Groups {
+		parts = append(parts, "группа `"+g+"`")
+	}
+	for _, id := range a.Users {
+		parts = append(parts, p.displayName(id))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sanitizeAccess cleans admin input; an empty list clears it.
+func sanitizeAccess(a *Access) *Access {
+	if a == nil {
+		return nil
+	}
+	ids := func(in []string) []string {
+		var out []string
+		for _, id := range in {
+			if model.IsValidId(id) && !containsString(out, id) && len(out) < maxAccessEntries {
+				out = append(out, id)
+			}
+		}
+		return out
+	}
+	out := &Access{Teams: ids(a.Teams), Channels: ids(a.Channels), Users: ids(a.Users)}
+	for _, g := range mergeNames(nil, a.Groups) {
+		if len(out.Groups) < maxAccessEntries {
+			out.Groups = append(out.Groups, g)
+		}
+	}
+	if len(out.Teams) == 0 && len(out.Channels) == 0 && len(out.Groups) == 0 && len(out.Users) == 0 {
+		return nil
+	}
+	return out
+}
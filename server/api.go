@@ -2,8 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -29,18 +32,56 @@ func (p *Plugin) initRoutes() {
 	api.HandleFunc("/status", p.apiGetAllStatus).Methods("GET")
 	api.HandleFunc("/status/{id}", p.apiGetStatus).Methods("GET")
 
+	api.HandleFunc("/pools", p.apiGetPools).Methods("GET")
+	api.HandleFunc("/pools/{name}/book", p.apiBookPool).Methods("POST")
+	api.HandleFunc("/pools/{name}/queue", p.apiJoinPoolQueue).Methods("POST")
+	api.HandleFunc("/pools/{name}/queue", p.apiLeavePoolQueue).Methods("DELETE")
+
+	api.HandleFunc("/bundles", p.apiBookBundle).Methods("POST")
+	api.HandleFunc("/bundles/queue", p.apiJoinBundleQueue).Methods("POST")
+	api.HandleFunc("/bundles/queue", p.apiLeaveBundleQueue).Methods("DELETE")
+	api.HandleFunc("/bundles/{bid}", p.apiGetBundle).Methods("GET")
+	api.HandleFunc("/bundles/{bid}", p.apiReleaseBundle).Methods("DELETE")
+	api.HandleFunc("/bundles/{bid}/extend", p.apiExtendBundle).Methods("POST")
+
 	api.HandleFunc("/resources/{id}/book", p.apiBookResource).Methods("POST")
 	api.HandleFunc("/resources/{id}/release", p.apiReleaseResource).Methods("POST")
 	api.HandleFunc("/resources/{id}/extend", p.apiExtendResource).Methods("POST")
+	api.HandleFunc("/resources/{id}/preempt", p.apiPreemptResource).Methods("POST")
+	api.HandleFunc("/resources/{id}/transfer", p.apiTransferResource).Methods("POST")
+	api.HandleFunc("/resources/{id}/transfer/accept", p.apiAcceptTransfer).Methods("POST")
+	api.HandleFunc("/resources/{id}/transfer/decline", p.apiDeclineTransfer).Methods("POST")
 
 	api.HandleFunc("/resources/{id}/queue", p.apiJoinQueue).Methods("POST")
 	api.HandleFunc("/resources/{id}/queue", p.apiLeaveQueue).Methods("DELETE")
+	api.HandleFunc("/resources/{id}/queue/{user_id}", p.apiKickFromQueue).Methods("DELETE")
+	api.HandleFunc("/resources/{id}/maintenance", p.apiStartMaintenance).Methods("POST")
+	api.HandleFunc("/resources/{id}/maintenance", p.apiEndMaintenance).Methods("DELETE")
+
+	api.HandleFunc("/resources/{id}/reservations", p.apiGetReservations).Methods("GET")
+	api.HandleFunc("/resources/{id}/reservations", p.apiCreateReservation).Methods("POST")
+	api.HandleFunc("/resources/{id}/reservations/{rid}", p.apiCancelReservation).Methods("DELETE")
+
+	api.HandleFunc("/resources/{id}/recurring", p.apiGetRecurring).Methods("GET")
+	api.HandleFunc("/resources/{id}/recurring", p.apiCreateRecurring).Methods("POST")
+	api.HandleFunc("/resources/{id}/recurring/{rid}", p.apiDeleteRecurring).Methods("DELETE")
+	api.HandleFunc("/resources/{id}/recurring/{rid}/exceptions", p.apiAddRecurringException).Methods("POST")
 
 	api.HandleFunc("/resources/{id}/subscribe", p.apiSubscribe).Methods("POST")
 	api.HandleFunc("/resources/{id}/unsubscribe", p.apiUnsubscribe).Methods("POST")
 
 	api.HandleFunc("/resources/{id}/history", p.apiGetHistory).Methods("GET")
 	api.HandleFunc("/presets", p.apiGetPresets).Methods("GET")
+	api.HandleFunc("/priorities", p.apiGetPriorities).Methods("GET")
+	api.HandleFunc("/priorities", p.apiSetPriorities).Methods("PUT")
+	api.HandleFunc("/managers", p.apiGetManagers).Methods("GET")
+	api.HandleFunc("/managers", p.apiSetManagers).Methods("PUT")
+	api.HandleFunc("/groups", p.apiGetGroups).Methods("GET")
+	api.HandleFunc("/groups", p.apiCreateGroup).Methods("POST")
+	api.HandleFunc("/groups/{gid}", p.apiUpdateGroup).Methods("PUT")
+	api.HandleFunc("/groups/{gid}", p.apiDeleteGroup).Methods("DELETE")
+	api.HandleFunc("/groups/{gid}/subscribe", p.apiSubscribeGroup).Methods("POST")
+	api.HandleFunc("/groups/{gid}/unsubscribe", p.apiUnsubscribeGroup).Methods("POST")
 
 	// --- Interactive button actions (NO auth middleware) ---
 	// Mattermost server calls these with PostActionIntegrationRequest in body.
@@ -48,6 +89,15 @@ func (p *Plugin) initRoutes() {
 	// Mattermost strips /plugins/com.scientia.resource-queue → plugin sees /actions/book
 	p.router.HandleFunc("/actions/book", p.actionBook).Methods("POST")
 	p.router.HandleFunc("/actions/queue", p.actionQueue).Methods("POST")
+	p.router.HandleFunc("/actions/claim", p.actionClaim).Methods("POST")
+	p.router.HandleFunc("/actions/pass", p.actionPass).Methods("POST")
+	p.router.HandleFunc("/actions/release", p.actionRelease).Methods("POST")
+	p.router.HandleFunc("/actions/extend", p.actionExtend).Methods("POST")
+	p.router.HandleFunc("/actions/transfer_accept", p.actionTransferAccept).Methods("POST")
+	p.router.HandleFunc("/actions/transfer_decline", p.actionTransferDecline).Methods("POST")
+	p.router.HandleFunc("/actions/approve", p.actionApprove).Methods("POST")
+	p.router.HandleFunc("/actions/reject", p.actionReject).Methods("POST")
+	p.router.HandleFunc("/actions/reject_reason", p.actionRejectReason).Methods("POST")
 }
 
 // --- middleware ---
@@ -62,6 +112,14 @@ func (p *Plugin) authMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// actionCaller reports whether an action or dialog request comes from the
+// user it names. The /actions routes sit outside authMiddleware, and their
+// bodies can be forged, so the server-set header is what counts.
+func actionCaller(r *http.Request, userID string) bool {
+	caller := r.Header.Get("Mattermost-User-ID")
+	return caller != "" && caller == userID
+}
+
 // --- helpers ---
 
 func httpJSON(w http.ResponseWriter, v interface{}) {
@@ -82,6 +140,54 @@ func truncate(s string, max int) string {
 	return s
 }
 
+// pageParams reads page= (counted from 0) and per_page= (at most
+// maxPerPage). Without per_page everything is one page.
+func pageParams(q url.Values) (page, perPage int) {
+	page, _ = strconv.Atoi(q.Get("page"))
+	perPage, _ = strconv.Atoi(q.Get("per_page"))
+	if page < 0 {
+		page = 0
+	}
+	if perPage < 0 {
+		perPage = 0
+	}
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+	return page, perPage
+}
+
+// pageBounds returns the slice bounds of page in a list of n items.
+func pageBounds(n, page, perPage int) (start, end int) {
+	if perPage == 0 {
+		return 0, n
+	}
+	if page > n/perPage {
+		return n, n
+	}
+	start = page * perPage
+	return start, min(start+perPage, n)
+}
+
+// clampCapacity limits a resource's seat count to 1..maxCapacity.
+func clampCapacity(n int) int {
+	if n < 1 {
+		return 1
+	}
+	if n > maxCapacity {
+		return maxCapacity
+	}
+	return n
+}
+
+// normalizeHandoff maps unknown handoff policies to the default claim window.
+func normalizeHandoff(s string) string {
+	if strings.TrimSpace(strings.ToLower(s)) == HandoffAuto {
+		return HandoffAuto
+	}
+	return HandoffClaim
+}
+
 // actionURL returns the integration URL for interactive buttons.
 func actionURL(action string) string {
 	return "/plugins/" + pluginID + "/actions/" + action
@@ -89,19 +195,51 @@ func actionURL(action string) string {
 
 // --- status builder ---
 
+// buildStatus reads the status of res from its own keys.
 func (p *Plugin) buildStatus(res *Resource, currentUserID string) ResourceStatus {
-	booking, _ := p.store.GetBooking(res.ID)
+	bookings, _ := p.store.GetBookings(res.ID)
 	entries, _ := p.store.GetQueueEntries(res.ID)
 	subs, _ := p.store.GetSubscribers(res.ID)
+	st := p.makeStatus(res, bookings, entries, subs, currentUserID)
+	st.ApprovalPending = res.Approval != nil && p.pendingApproval(res, currentUserID) != nil
+	st.CanManage = p.canManage(currentUserID, res)
+	return st
+}
+
+// indexedStatus builds the status of a resource from its index entry; only a
+// pending approval request is looked up, and only if the resource has any.
+func (p *Plugin) indexedStatus(e *indexEntry, currentUserID string, manages func(*Resource) bool) ResourceStatus {
+	res := &e.Resource
+	st := p.makeStatus(res, e.active(), e.Queue, e.Subscribers, currentUserID)
+	st.ApprovalPending = res.Approval != nil && e.Approvals > 0 && p.pendingApproval(res, currentUserID) != nil
+	st.CanManage = manages(res)
+	return st
+}
 
+func (p *Plugin) makeStatus(res *Resource, bookings []Booking, entries []QueueEntry, subs []string, currentUserID string) ResourceStatus {
+	bvs := make([]BookingView, 0, len(bookings))
+	isHolder, heldForYou, transferForYou := false, false, false
 	var bv *BookingView
-	if booking != nil {
-		bv = &BookingView{Booking: *booking, Username: p.username(booking.UserID)}
+	for _, b := range bookings {
+		bvs = append(bvs, BookingView{Booking: b, Username: p.username(b.UserID), DisplayName: p.plainName(b.UserID)})
+		if b.TransferTo == currentUserID {
+			transferForYou = true
+		}
+		if b.UserID == currentUserID && b.Hold {
+			heldForYou = true
+		}
+		if b.UserID == currentUserID && !b.Hold {
+			isHolder = true
+			bv = &bvs[len(bvs)-1]
+		}
+	}
+	if bv == nil && len(bvs) > 0 {
+		bv = &bvs[0]
 	}
 
 	qv := make([]QueueView, 0, len(entries))
 	for _, e := range entries {
-		qv = append(qv, QueueView{QueueEntry: e, Username: p.username(e.UserID)})
+		qv = append(qv, QueueView{QueueEntry: e, Username: p.username(e.UserID), DisplayName: p.plainName(e.UserID)})
 	}
 
 	isSub := false
@@ -120,13 +258,18 @@ func (p *Plugin) buildStatus(res *Resource, currentUserID string) ResourceStatus
 	}
 
 	return ResourceStatus{
-		Resource:     *res,
-		Booking:      bv,
-		Queue:        qv,
-		Subscribers:  len(subs),
-		IsSubscribed: isSub,
-		IsHolder:     booking != nil && booking.UserID == currentUserID,
-		InQueue:      inQ,
+		Resource:       *res,
+		Booking:        bv,
+		Bookings:       bvs,
+		Capacity:       res.Seats(),
+		Queue:          qv,
+		Subscribers:    len(subs),
+		IsSubscribed:   isSub,
+		IsHolder:       isHolder,
+		HeldForYou:     heldForYou,
+		TransferForYou: transferForYou,
+		InQueue:        inQ,
+		InMaintenance:  inMaintenance(res),
 	}
 }
 
@@ -136,17 +279,36 @@ func (p *Plugin) buildStatus(res *Resource, currentUserID string) ResourceStatus
 
 // --- Resources CRUD ---
 
+// apiGetResources lists the resources the user may see, narrowed by the
+// tag=, group=, q= and free= filters; ?managed=1 keeps only those they
+// manage. page= and per_page= pick one page, and X-Total-Count tells how many
+// there are in all.
 func (p *Plugin) apiGetResources(w http.ResponseWriter, r *http.Request) {
-	res, err := p.store.GetAllResources()
+	uid := r.Header.Get("Mattermost-User-ID")
+	res, err := p.visibleResources(uid)
 	if err != nil {
 		httpErr(w, 500, err.Error())
 		return
 	}
-	httpJSON(w, res)
+	res = p.filterResources(res, parseFilterQuery(r.URL.Query()))
+	if r.URL.Query().Get("managed") != "" {
+		manages := p.managerChecker(uid)
+		managed := res[:0]
+		for _, rs := range res {
+			if manages(rs) {
+				managed = append(managed, rs)
+			}
+		}
+		res = managed
+	}
+	page, perPage := pageParams(r.URL.Query())
+	start, end := pageBounds(len(res), page, perPage)
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(res)))
+	httpJSON(w, res[start:end])
 }
 
 func (p *Plugin) apiGetResource(w http.ResponseWriter, r *http.Request) {
-	res, err := p.store.GetResource(mux.Vars(r)["id"])
+	res, err := p.resourceFor(r.Header.Get("Mattermost-User-ID"), mux.Vars(r)["id"])
 	if err != nil || res == nil {
 		httpErr(w, 404, "not found")
 		return
@@ -156,12 +318,12 @@ func (p *Plugin) apiGetResource(w http.ResponseWriter, r *http.Request) {
 
 func (p *Plugin) apiCreateResource(w http.ResponseWriter, r *http.Request) {
 	uid := r.Header.Get("Mattermost-User-ID")
-	if !p.isAdmin(uid) {
-		httpErr(w, 403, "admin only")
+	if !p.canManage(uid, nil) {
+		httpErr(w, 403, "managers only")
 		return
 	}
 	var res Resource
-	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&res); err != nil {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16384)).Decode(&res); err != nil {
 		httpErr(w, 400, "bad json")
 		return
 	}
@@ -169,6 +331,25 @@ func (p *Plugin) apiCreateResource(w http.ResponseWriter, r *http.Request) {
 	res.Name = truncate(strings.TrimSpace(res.Name), maxNameLen)
 	res.IP = truncate(strings.TrimSpace(res.IP), maxIPLen)
 	res.Description = truncate(strings.TrimSpace(res.Description), maxDescLen)
+	res.Pool = normalizePool(res.Pool)
+	tags, err := sanitizeTags(res.Tags)
+	if err != nil {
+		httpErr(w, 400, err.Error())
+		return
+	}
+	res.Tags = tags
+	res.GroupID = strings.TrimSpace(res.GroupID)
+	if !p.groupExists(res.GroupID) {
+		httpErr(w, 400, "unknown group")
+		return
+	}
+	res.Handoff = normalizeHandoff(res.Handoff)
+	res.Policy = sanitizePolicy(res.Policy)
+	res.Approval = sanitizeApproval(res.Approval)
+	res.Access = sanitizeAccess(res.Access)
+	res.Managers = sanitizeManagers(res.Managers)
+	res.Maintenance = nil // scheduled through the /maintenance endpoint
+	res.Capacity = clampCapacity(res.Capacity)
 	res.CreatedAt = time.Now()
 	res.CreatedBy = uid
 	if res.Name == "" {
@@ -196,18 +377,17 @@ func (p *Plugin) apiCreateResource(w http.ResponseWriter, r *http.Request) {
 
 func (p *Plugin) apiUpdateResource(w http.ResponseWriter, r *http.Request) {
 	uid := r.Header.Get("Mattermost-User-ID")
-	if !p.isAdmin(uid) {
-		httpErr(w, 403, "admin only")
-		return
-	}
-	id := mux.Vars(r)["id"]
-	existing, err := p.store.GetResource(id)
+	existing, err := p.resourceFor(uid, mux.Vars(r)["id"])
 	if err != nil || existing == nil {
 		httpErr(w, 404, "not found")
 		return
 	}
+	if !p.canManage(uid, existing) {
+		httpErr(w, 403, "managers only")
+		return
+	}
 	var upd Resource
-	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&upd); err != nil {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16384)).Decode(&upd); err != nil {
 		httpErr(w, 400, "bad json")
 		return
 	}
@@ -215,6 +395,36 @@ func (p *Plugin) apiUpdateResource(w http.ResponseWriter, r *http.Request) {
 	existing.IP = truncate(strings.TrimSpace(upd.IP), maxIPLen)
 	existing.Icon = truncate(strings.TrimSpace(upd.Icon), 10)
 	existing.Description = truncate(strings.TrimSpace(upd.Description), maxDescLen)
+	existing.Pool = normalizePool(upd.Pool)
+	if upd.Tags != nil {
+		tags, err := sanitizeTags(upd.Tags) // an empty list clears them
+		if err != nil {
+			httpErr(w, 400, err.Error())
+			return
+		}
+		existing.Tags = tags
+	}
+	existing.GroupID = strings.TrimSpace(upd.GroupID)
+	if !p.groupExists(existing.GroupID) {
+		httpErr(w, 400, "unknown group")
+		return
+	}
+	existing.Handoff = normalizeHandoff(upd.Handoff)
+	if upd.Policy != nil {
+		existing.Policy = sanitizePolicy(upd.Policy) // an all-zero policy clears it
+	}
+	if upd.Approval != nil {
+		existing.Approval = sanitizeApproval(upd.Approval) // no approvers clears it
+	}
+	if upd.Access != nil {
+		existing.Access = sanitizeAccess(upd.Access) // an empty list opens it to all
+	}
+	if upd.Managers != nil {
+		existing.Managers = sanitizeManagers(upd.Managers) // an empty list clears it
+	}
+	if upd.Capacity > 0 {
+		existing.Capacity = clampCapacity(upd.Capacity)
+	}
 	if upd.Variables != nil {
 		clean := make(map[string]string, len(upd.Variables))
 		for k, v := range upd.Variables {
@@ -238,11 +448,17 @@ func (p *Plugin) apiUpdateResource(w http.ResponseWriter, r *http.Request) {
 }
 
 func (p *Plugin) apiDeleteResource(w http.ResponseWriter, r *http.Request) {
-	if !p.isAdmin(r.Header.Get("Mattermost-User-ID")) {
-		httpErr(w, 403, "admin only")
+	uid := r.Header.Get("Mattermost-User-ID")
+	res, err := p.resourceFor(uid, mux.Vars(r)["id"])
+	if err != nil || res == nil {
+		httpErr(w, 404, "not found")
+		return
+	}
+	if !p.canManage(uid, res) {
+		httpErr(w, 403, "managers only")
 		return
 	}
-	if err := p.store.DeleteResource(mux.Vars(r)["id"]); err != nil {
+	if err := p.store.DeleteResource(res.ID); err != nil {
 		httpErr(w, 500, err.Error())
 		return
 	}
@@ -251,23 +467,51 @@ func (p *Plugin) apiDeleteResource(w http.ResponseWriter, r *http.Request) {
 
 // --- Status ---
 
+// apiGetAllStatus returns the status of the resources the user may see, read
+// from the resource index, narrowed by the tag=, group=, q= and free= filters
+// and ordered by name. page= and per_page= pick one page of statuses; the
+// pool summaries, group tree and total always cover every match.
 func (p *Plugin) apiGetAllStatus(w http.ResponseWriter, r *http.Request) {
 	uid := r.Header.Get("Mattermost-User-ID")
-	resources, err := p.store.GetAllResources()
+	entries, err := p.visibleEntries(uid)
 	if err != nil {
 		httpErr(w, 500, err.Error())
 		return
 	}
-	statuses := make([]ResourceStatus, 0, len(resources))
-	for _, res := range resources {
-		statuses = append(statuses, p.buildStatus(res, uid))
+	free := make(map[string]bool, len(entries))
+	isFree := func(res *Resource) bool { return free[res.ID] }
+	matches := p.filterMatcher(parseFilterQuery(r.URL.Query()))
+	manages := p.managerChecker(uid)
+	canCreate := p.canManage(uid, nil)
+	canManage := canCreate
+	var matched []*indexEntry
+	var resources []*Resource
+	for _, e := range entries {
+		free[e.Resource.ID] = e.free()
+		canManage = canManage || manages(&e.Resource)
+		if matches(&e.Resource, isFree) {
+			matched = append(matched, e)
+			resources = append(resources, &e.Resource)
+		}
 	}
-	httpJSON(w, StatusResponse{UserID: uid, IsAdmin: p.isAdmin(uid), Statuses: statuses})
+	page, perPage := pageParams(r.URL.Query())
+	start, end := pageBounds(len(matched), page, perPage)
+	statuses := make([]ResourceStatus, 0, end-start)
+	for _, e := range matched[start:end] {
+		statuses = append(statuses, p.indexedStatus(e, uid, manages))
+	}
+	groups, _ := p.store.GetGroups()
+	httpJSON(w, StatusResponse{
+		UserID: uid, IsAdmin: p.isAdmin(uid), CanManage: canManage, CanCreate: canCreate,
+		Statuses: statuses, Pools: p.buildPoolStatuses(resources, isFree, uid),
+		Groups: p.buildGroupTree(groups, resources, isFree, uid),
+		Total:  len(matched), Page: page, PerPage: perPage,
+	})
 }
 
 func (p *Plugin) apiGetStatus(w http.ResponseWriter, r *http.Request) {
 	uid := r.Header.Get("Mattermost-User-ID")
-	res, err := p.store.GetResource(mux.Vars(r)["id"])
+	res, err := p.resourceFor(uid, mux.Vars(r)["id"])
 	if err != nil || res == nil {
 		httpErr(w, 404, "not found")
 		return
@@ -275,23 +519,33 @@ func (p *Plugin) apiGetStatus(w http.ResponseWriter, r *http.Request) {
 	httpJSON(w, p.buildStatus(res, uid))
 }
 
-// --- Booking ---
+// --- Pools ---
 
-func (p *Plugin) apiBookResource(w http.ResponseWriter, r *http.Request) {
+func (p *Plugin) apiGetPools(w http.ResponseWriter, r *http.Request) {
 	uid := r.Header.Get("Mattermost-User-ID")
-	id := mux.Vars(r)["id"]
-
-	res, err := p.store.GetResource(id)
-	if err != nil || res == nil {
-		httpErr(w, 404, "not found")
+	entries, err := p.visibleEntries(uid)
+	if err != nil {
+		httpErr(w, 500, err.Error())
 		return
 	}
-	existing, _ := p.store.GetBooking(id)
-	if existing != nil {
-		httpErr(w, 409, "resource busy")
-		return
+	free := make(map[string]bool, len(entries))
+	var resources []*Resource
+	for _, e := range entries {
+		if e.Resource.Pool != "" {
+			free[e.Resource.ID] = e.free()
+			resources = append(resources, &e.Resource)
+		}
 	}
+	httpJSON(w, p.buildPoolStatuses(resources, func(res *Resource) bool { return free[res.ID] }, uid))
+}
 
+func (p *Plugin) apiBookPool(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	_, members, err := p.findPool(uid, poolPrefix+mux.Vars(r)["name"])
+	if err != nil {
+		httpErr(w, 404, "pool not found")
+		return
+	}
 	var req struct {
 		Minutes int    `json:"minutes"`
 		Purpose string `json:"purpose"`
@@ -300,249 +554,921 @@ func (p *Plugin) apiBookResource(w http.ResponseWriter, r *http.Request) {
 		httpErr(w, 400, "invalid minutes")
 		return
 	}
-	maxMin := p.cfgMaxBookingHours() * 60
-	if req.Minutes > maxMin {
-		httpErr(w, 400, fmt.Sprintf("max %d hours", p.cfgMaxBookingHours()))
+	_, b, err := p.bookFromPool(members, uid, time.Duration(req.Minutes)*time.Minute, truncate(req.Purpose, maxPurposeLen))
+	if errors.Is(err, errNoFreeMember) {
+		httpErr(w, 409, "all pool members are busy")
 		return
 	}
-
-	b := &Booking{
-		ResourceID: id, UserID: uid,
-		Purpose:   truncate(req.Purpose, maxPurposeLen),
-		StartedAt: time.Now(),
-		ExpiresAt: time.Now().Add(time.Duration(req.Minutes) * time.Minute),
-	}
-	if err := p.store.SaveBooking(b); err != nil {
-		httpErr(w, 500, err.Error())
+	if err != nil {
+		httpErr(w, storeErrStatus(err), err.Error())
 		return
 	}
-	p.store.RemoveFromQueue(id, uid)
-	p.notifySubscribers(id, fmt.Sprintf("🔒 **%s** занят @%s на %s",
-		res.Name, p.username(uid), formatDuration(time.Duration(req.Minutes)*time.Minute)), uid)
 	httpJSON(w, b)
 }
 
-func (p *Plugin) apiReleaseResource(w http.ResponseWriter, r *http.Request) {
+func (p *Plugin) apiJoinPoolQueue(w http.ResponseWriter, r *http.Request) {
 	uid := r.Header.Get("Mattermost-User-ID")
-	id := mux.Vars(r)["id"]
-
-	res, err := p.store.GetResource(id)
-	if err != nil || res == nil {
-		httpErr(w, 404, "not found")
+	pool, _, err := p.findPool(uid, poolPrefix+mux.Vars(r)["name"])
+	if err != nil {
+		httpErr(w, 404, "pool not found")
+		return
+	}
+	var req struct {
+		Minutes  int    `json:"minutes"`
+		Purpose  string `json:"purpose"`
+		Priority string `json:"priority"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil {
+		httpErr(w, 400, "bad json")
 		return
 	}
-	booking, _ := p.store.GetBooking(id)
-	if booking == nil {
-		httpErr(w, 400, "not booked")
+	if req.Minutes <= 0 {
+		req.Minutes = 60
+	}
+	priority, ok := parsePriority(req.Priority)
+	if !ok && req.Priority != "" {
+		httpErr(w, 400, "invalid priority")
 		return
 	}
-	if booking.UserID != uid && !p.isAdmin(uid) {
-		httpErr(w, 403, "not holder")
+	pos, err := p.enqueue(poolQueueID(pool), "пул `"+pool+"`", QueueEntry{
+		UserID: uid, DesiredDuration: time.Duration(req.Minutes) * time.Minute,
+		Purpose: truncate(req.Purpose, maxPurposeLen), QueuedAt: time.Now(), Priority: priority,
+	}, maxQueueSize)
+	if errors.Is(err, errPriorityDenied) {
+		httpErr(w, 403, err.Error())
 		return
 	}
-	p.store.AddHistory(HistoryEntry{
-		UserID: booking.UserID, ResourceID: id, Purpose: booking.Purpose,
-		StartedAt: booking.StartedAt, EndedAt: time.Now(),
-	})
-	p.store.DeleteBooking(id)
-	p.notifySubscribers(id, fmt.Sprintf("🔓 **%s** освобождён", res.Name), "")
-	p.processQueue(id, res.Name)
-	httpJSON(w, map[string]string{"status": "released"})
+	if err != nil {
+		httpErr(w, 400, err.Error())
+		return
+	}
+	httpJSON(w, map[string]interface{}{"position": pos})
 }
 
-func (p *Plugin) apiExtendResource(w http.ResponseWriter, r *http.Request) {
+func (p *Plugin) apiLeavePoolQueue(w http.ResponseWriter, r *http.Request) {
 	uid := r.Header.Get("Mattermost-User-ID")
-	id := mux.Vars(r)["id"]
+	p.store.RemoveFromQueue(poolQueueID(normalizePool(mux.Vars(r)["name"])), uid)
+	httpJSON(w, map[string]string{"status": "ok"})
+}
 
-	booking, _ := p.store.GetBooking(id)
-	if booking == nil {
-		httpErr(w, 400, "not booked")
-		return
-	}
-	if booking.UserID != uid {
-		httpErr(w, 403, "not holder")
-		return
-	}
+// --- Bundles ---
 
+func (p *Plugin) apiBookBundle(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
 	var req struct {
-		Minutes int `json:"minutes"`
+		ResourceIDs []string `json:"resource_ids"`
+		Minutes     int      `json:"minutes"`
+		Purpose     string   `json:"purpose"`
 	}
-	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 256)).Decode(&req); err != nil || req.Minutes <= 0 {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil || req.Minutes <= 0 {
 		httpErr(w, 400, "invalid minutes")
 		return
 	}
-	newExpiry := booking.ExpiresAt.Add(time.Duration(req.Minutes) * time.Minute)
-	maxMin := p.cfgMaxBookingHours() * 60
-	if int(newExpiry.Sub(booking.StartedAt).Minutes()) > maxMin {
-		httpErr(w, 400, fmt.Sprintf("total exceeds max %d hours", p.cfgMaxBookingHours()))
+	members, err := p.findBundleIDs(req.ResourceIDs)
+	if err == nil {
+		err = p.checkAccessAll(uid, members)
+	}
+	if err != nil {
+		httpErr(w, 400, err.Error())
 		return
 	}
-	booking.ExpiresAt = newExpiry
-	booking.NotifiedSoon = false
-	if err := p.store.SaveBooking(booking); err != nil {
-		httpErr(w, 500, err.Error())
+	bundle, err := p.bookBundle(members, uid, time.Duration(req.Minutes)*time.Minute, truncate(req.Purpose, maxPurposeLen))
+	if err != nil {
+		httpErr(w, storeErrStatus(err), err.Error())
 		return
 	}
-	httpJSON(w, booking)
+	httpJSON(w, bundle)
 }
 
-// --- Queue ---
+// apiGetBundle returns a bundle only to users who may see all of its
+// resources; to anyone else it does not exist.
+func (p *Plugin) apiGetBundle(w http.ResponseWriter, r *http.Request) {
+	bundle, err := p.store.GetBundle(mux.Vars(r)["bid"])
+	if err != nil || bundle == nil {
+		httpErr(w, 404, "not found")
+		return
+	}
+	canAccess := p.accessChecker(r.Header.Get("Mattermost-User-ID"))
+	for _, id := range bundle.ResourceIDs {
+		if res, _ := p.store.GetResource(id); res != nil && !canAccess(res) {
+			httpErr(w, 404, "not found")
+			return
+		}
+	}
+	httpJSON(w, bundle)
+}
 
-func (p *Plugin) apiJoinQueue(w http.ResponseWriter, r *http.Request) {
+func (p *Plugin) apiReleaseBundle(w http.ResponseWriter, r *http.Request) {
 	uid := r.Header.Get("Mattermost-User-ID")
-	id := mux.Vars(r)["id"]
+	released, err := p.releaseBundle(mux.Vars(r)["bid"], uid)
+	if err != nil {
+		httpErr(w, storeErrStatus(err), err.Error())
+		return
+	}
+	httpJSON(w, released)
+}
 
-	res, err := p.store.GetResource(id)
-	if err != nil || res == nil {
-		httpErr(w, 404, "not found")
+func (p *Plugin) apiExtendBundle(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	var req struct {
+		Minutes int `json:"minutes"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil || req.Minutes <= 0 {
+		httpErr(w, 400, "invalid minutes")
 		return
 	}
-	booking, _ := p.store.GetBooking(id)
-	if booking != nil && booking.UserID == uid {
-		httpErr(w, 400, "you already hold this resource")
+	extended, err := p.extendBundle(mux.Vars(r)["bid"], uid, time.Duration(req.Minutes)*time.Minute)
+	if err != nil {
+		httpErr(w, storeErrStatus(err), err.Error())
 		return
 	}
+	httpJSON(w, extended)
+}
 
+func (p *Plugin) apiJoinBundleQueue(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
 	var req struct {
-		Minutes int    `json:"minutes"`
-		Purpose string `json:"purpose"`
+		ResourceIDs []string `json:"resource_ids"`
+		Minutes     int      `json:"minutes"`
+		Purpose     string   `json:"purpose"`
 	}
-	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
 		httpErr(w, 400, "bad json")
 		return
 	}
 	if req.Minutes <= 0 {
 		req.Minutes = 60
 	}
-
-	pos, err := p.store.AddToQueue(id, QueueEntry{
-		UserID: uid, DesiredDuration: time.Duration(req.Minutes) * time.Minute,
-		Purpose: truncate(req.Purpose, maxPurposeLen), QueuedAt: time.Now(),
-	})
+	members, err := p.findBundleIDs(req.ResourceIDs)
+	if err == nil {
+		err = p.checkAccessAll(uid, members)
+	}
 	if err != nil {
 		httpErr(w, 400, err.Error())
 		return
 	}
-
-	// Notify current holder that someone queued
-	if booking != nil && !booking.NotifiedQueue {
-		p.sendDM(booking.UserID, fmt.Sprintf("👋 @%s встал в очередь на **%s**", p.username(uid), res.Name))
-		booking.NotifiedQueue = true
-		p.store.SaveBooking(booking)
+	pos, err := p.queueBundle(members, uid, time.Duration(req.Minutes)*time.Minute, truncate(req.Purpose, maxPurposeLen))
+	if errors.Is(err, errApprovalRequired) {
+		httpErr(w, storeErrStatus(err), err.Error())
+		return
+	}
+	if err != nil {
+		httpErr(w, 400, err.Error())
+		return
 	}
 	httpJSON(w, map[string]interface{}{"position": pos})
 }
 
-func (p *Plugin) apiLeaveQueue(w http.ResponseWriter, r *http.Request) {
+// apiLeaveBundleQueue takes the set as ?ids=a,b,c.
+func (p *Plugin) apiLeaveBundleQueue(w http.ResponseWriter, r *http.Request) {
 	uid := r.Header.Get("Mattermost-User-ID")
-	p.store.RemoveFromQueue(mux.Vars(r)["id"], uid)
+	ids := strings.Split(r.URL.Query().Get("ids"), ",")
+	p.store.RemoveFromBundleQueue(uid, ids)
 	httpJSON(w, map[string]string{"status": "ok"})
 }
 
-// --- Subscriptions ---
+// --- Booking ---
 
-func (p *Plugin) apiSubscribe(w http.ResponseWriter, r *http.Request) {
+func (p *Plugin) apiBookResource(w http.ResponseWriter, r *http.Request) {
 	uid := r.Header.Get("Mattermost-User-ID")
-	if err := p.store.Subscribe(mux.Vars(r)["id"], uid); err != nil {
-		httpErr(w, 400, err.Error())
+	id := mux.Vars(r)["id"]
+
+	res, err := p.resourceFor(uid, id)
+	if err != nil || res == nil {
+		httpErr(w, 404, "not found")
 		return
 	}
-	httpJSON(w, map[string]string{"status": "subscribed"})
-}
-
-func (p *Plugin) apiUnsubscribe(w http.ResponseWriter, r *http.Request) {
-	uid := r.Header.Get("Mattermost-User-ID")
-	p.store.Unsubscribe(mux.Vars(r)["id"], uid)
-	httpJSON(w, map[string]string{"status": "ok"})
-}
-
-// --- History ---
 
-func (p *Plugin) apiGetHistory(w http.ResponseWriter, r *http.Request) {
-	id := mux.Vars(r)["id"]
-	entries, err := p.store.GetHistory(id, 50)
-	if err != nil {
-		httpErr(w, 500, err.Error())
+	var req struct {
+		Minutes int    `json:"minutes"`
+		Purpose string `json:"purpose"`
+		// UserID books for another user (admins only).
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil || req.Minutes < 0 {
+		httpErr(w, 400, "invalid minutes")
 		return
 	}
-	type histView struct {
-		HistoryEntry
-		Username string `json:"username"`
+	// Limits are checked by bookResource; no minutes means the default.
+	dur := time.Duration(req.Minutes) * time.Minute
+	if req.Minutes == 0 {
+		dur = p.limitsFor(res).Default
 	}
-	views := make([]histView, 0, len(entries))
-	for _, e := range entries {
-		views = append(views, histView{HistoryEntry: e, Username: p.username(e.UserID)})
+	target := uid
+	if req.UserID != "" && req.UserID != uid {
+		if _, err := p.getUser(req.UserID); err != nil {
+			httpErr(w, 404, "user not found")
+			return
+		}
+		target = req.UserID
 	}
-	httpJSON(w, views)
-}
-
-func (p *Plugin) apiGetPresets(w http.ResponseWriter, r *http.Request) {
-	httpJSON(w, DefaultPresets)
-}
-
-// ===========================
-// Interactive button actions
-// ===========================
-// Mattermost POSTs PostActionIntegrationRequest here when user clicks a button.
-// Response must be PostActionIntegrationResponse.
 
-func (p *Plugin) actionBook(w http.ResponseWriter, r *http.Request) {
-	var req model.PostActionIntegrationRequest
-	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
-		p.API.LogError("actionBook: decode", "err", err.Error())
+	b, err := p.bookFor(res, uid, target, dur, truncate(req.Purpose, maxPurposeLen))
+	if errors.Is(err, errApprovalRequired) {
+		// The booking waits for an approver: answer 202 with the request.
+		ar, err := p.requestApproval(res, uid, dur, truncate(req.Purpose, maxPurposeLen))
+		if err != nil {
+			httpErr(w, storeErrStatus(err), err.Error())
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(model.PostActionIntegrationResponse{
-			EphemeralText: "Ошибка запроса",
-		})
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(ar)
 		return
 	}
-
-	p.API.LogDebug("actionBook called",
-		"user_id", req.UserId,
-		"context", fmt.Sprintf("%v", req.Context))
-
-	uid := req.UserId
-	resourceID, _ := req.Context["resource_id"].(string)
-	minutesF, _ := req.Context["minutes"].(float64)
-	minutes := int(minutesF)
-
-	resp := func(text string) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(model.PostActionIntegrationResponse{EphemeralText: text})
-	}
-
-	if uid == "" || resourceID == "" || minutes <= 0 {
-		resp("Ошибка: неверные параметры")
+	if err != nil {
+		httpErr(w, storeErrStatus(err), err.Error())
 		return
 	}
+	httpJSON(w, b)
+}
 
-	res, err := p.store.GetResource(resourceID)
+func (p *Plugin) apiReleaseResource(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	id := mux.Vars(r)["id"]
+
+	res, err := p.resourceFor(uid, id)
 	if err != nil || res == nil {
-		resp("Ресурс не найден")
+		httpErr(w, 404, "not found")
 		return
 	}
-
-	existing, _ := p.store.GetBooking(resourceID)
-	if existing != nil {
-		resp(fmt.Sprintf("🔴 **%s** уже занят @%s", res.Name, p.username(existing.UserID)))
-		return
+	// Admins may free a specific holder's seat on multi-seat resources.
+	var req struct {
+		UserID string `json:"user_id"`
 	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil {
+			httpErr(w, 400, "bad json")
+			return
+		}
+	}
+	if _, err := p.releaseResource(res, uid, req.UserID); err != nil {
+		httpErr(w, storeErrStatus(err), err.Error())
+		return
+	}
+	httpJSON(w, map[string]string{"status": "released"})
+}
+
+func (p *Plugin) apiExtendResource(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	id := mux.Vars(r)["id"]
+
+	res, err := p.resourceFor(uid, id)
+	if err != nil || res == nil {
+		httpErr(w, 404, "not found")
+		return
+	}
+
+	var req struct {
+		Minutes int `json:"minutes"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 256)).Decode(&req); err != nil || req.Minutes <= 0 {
+		httpErr(w, 400, "invalid minutes")
+		return
+	}
+	booking, err := p.extendBooking(res, uid, time.Duration(req.Minutes)*time.Minute)
+	if err != nil {
+		httpErr(w, storeErrStatus(err), err.Error())
+		return
+	}
+	httpJSON(w, booking)
+}
+
+// --- Queue ---
+
+func (p *Plugin) apiPreemptResource(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	res, err := p.resourceFor(uid, mux.Vars(r)["id"])
+	if err != nil || res == nil {
+		httpErr(w, 404, "not found")
+		return
+	}
+	var req struct {
+		Reason string `json:"reason"`
+		UserID string `json:"user_id"` // holder to preempt; optional
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		httpErr(w, 400, "reason required")
+		return
+	}
+	b, err := p.preemptBooking(res, uid, req.UserID, truncate(strings.TrimSpace(req.Reason), maxPurposeLen))
+	if err != nil {
+		httpErr(w, storeErrStatus(err), err.Error())
+		return
+	}
+	httpJSON(w, b)
+}
+
+// apiTransferResource offers the caller's booking to {user_id}.
+func (p *Plugin) apiTransferResource(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	res, err := p.resourceFor(uid, mux.Vars(r)["id"])
+	if err != nil || res == nil {
+		httpErr(w, 404, "not found")
+		return
+	}
+	var req struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil || req.UserID == "" {
+		httpErr(w, 400, "user_id required")
+		return
+	}
+	if _, err := p.getUser(req.UserID); err != nil {
+		httpErr(w, 404, "user not found")
+		return
+	}
+	b, err := p.offerTransfer(res, uid, req.UserID)
+	if err != nil {
+		httpErr(w, storeErrStatus(err), err.Error())
+		return
+	}
+	httpJSON(w, b)
+}
+
+func (p *Plugin) apiAcceptTransfer(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	res, err := p.resourceFor(uid, mux.Vars(r)["id"])
+	if err != nil || res == nil {
+		httpErr(w, 404, "not found")
+		return
+	}
+	b, _, err := p.acceptTransfer(res, uid)
+	if err != nil {
+		httpErr(w, storeErrStatus(err), err.Error())
+		return
+	}
+	httpJSON(w, b)
+}
+
+func (p *Plugin) apiDeclineTransfer(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	res, err := p.resourceFor(uid, mux.Vars(r)["id"])
+	if err != nil || res == nil {
+		httpErr(w, 404, "not found")
+		return
+	}
+	if err := p.declineTransfer(res, uid); err != nil {
+		httpErr(w, storeErrStatus(err), err.Error())
+		return
+	}
+	httpJSON(w, map[string]string{"status": "ok"})
+}
+
+func (p *Plugin) apiJoinQueue(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	id := mux.Vars(r)["id"]
+
+	res, err := p.resourceFor(uid, id)
+	if err != nil || res == nil {
+		httpErr(w, 404, "not found")
+		return
+	}
+	if own, _ := p.store.GetUserBooking(id, uid); own != nil {
+		httpErr(w, 400, "you already hold this resource")
+		return
+	}
+
+	var req struct {
+		Minutes  int    `json:"minutes"`
+		Purpose  string `json:"purpose"`
+		Priority string `json:"priority"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil {
+		httpErr(w, 400, "bad json")
+		return
+	}
+	dur := time.Duration(req.Minutes) * time.Minute
+	if req.Minutes <= 0 {
+		dur = p.limitsFor(res).Default
+	}
+	priority, ok := parsePriority(req.Priority)
+	if !ok && req.Priority != "" {
+		httpErr(w, 400, "invalid priority")
+		return
+	}
+
+	pos, err := p.joinQueue(res, QueueEntry{
+		UserID: uid, DesiredDuration: dur,
+		Purpose: truncate(req.Purpose, maxPurposeLen), QueuedAt: time.Now(), Priority: priority,
+	})
+	if errors.Is(err, errPriorityDenied) {
+		httpErr(w, 403, err.Error())
+		return
+	}
+	if err != nil {
+		httpErr(w, 400, err.Error())
+		return
+	}
+
+	// Notify current holders that someone queued
+	if !p.hasFreeSeat(res) {
+		p.notifyHolderQueued(res, uid)
+	}
+	httpJSON(w, map[string]interface{}{"position": pos})
+}
+
+func (p *Plugin) apiLeaveQueue(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	p.store.RemoveFromQueue(mux.Vars(r)["id"], uid)
+	httpJSON(w, map[string]string{"status": "ok"})
+}
+
+// apiKickFromQueue removes another user from the queue (managers only).
+func (p *Plugin) apiKickFromQueue(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	res, err := p.resourceFor(uid, mux.Vars(r)["id"])
+	if err != nil || res == nil {
+		httpErr(w, 404, "not found")
+		return
+	}
+	if err := p.kickFromQueue(res, uid, mux.Vars(r)["user_id"]); err != nil {
+		httpErr(w, storeErrStatus(err), err.Error())
+		return
+	}
+	httpJSON(w, map[string]string{"status": "ok"})
+}
+
+// --- Maintenance ---
+
+// apiStartMaintenance puts the resource into maintenance: right away if
+// starts_at is omitted, open-ended if ends_at is.
+func (p *Plugin) apiStartMaintenance(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	res, err := p.resourceFor(uid, mux.Vars(r)["id"])
+	if err != nil || res == nil {
+		httpErr(w, 404, "not found")
+		return
+	}
+	var req struct {
+		Reason   string    `json:"reason"`
+		StartsAt time.Time `json:"starts_at"`
+		EndsAt   time.Time `json:"ends_at"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2048)).Decode(&req); err != nil {
+		httpErr(w, 400, "bad json")
+		return
+	}
+	if err := p.scheduleMaintenance(res, uid, strings.TrimSpace(req.Reason), req.StartsAt, req.EndsAt); err != nil {
+		httpErr(w, storeErrStatus(err), err.Error())
+		return
+	}
+	httpJSON(w, res.Maintenance)
+}
+
+func (p *Plugin) apiEndMaintenance(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	res, err := p.resourceFor(uid, mux.Vars(r)["id"])
+	if err != nil || res == nil {
+		httpErr(w, 404, "not found")
+		return
+	}
+	if err := p.endMaintenance(res, uid); err != nil {
+		httpErr(w, storeErrStatus(err), err.Error())
+		return
+	}
+	httpJSON(w, map[string]string{"status": "ok"})
+}
+
+// --- Reservations ---
+
+func (p *Plugin) apiGetReservations(w http.ResponseWriter, r *http.Request) {
+	if res, _ := p.resourceFor(r.Header.Get("Mattermost-User-ID"), mux.Vars(r)["id"]); res == nil {
+		httpErr(w, 404, "not found")
+		return
+	}
+	rsvs, err := p.store.GetReservations(mux.Vars(r)["id"])
+	if err != nil {
+		httpErr(w, 500, err.Error())
+		return
+	}
+	views := make([]ReservationView, 0, len(rsvs))
+	for _, rv := range rsvs {
+		views = append(views, ReservationView{Reservation: rv, Username: p.username(rv.UserID), DisplayName: p.plainName(rv.UserID)})
+	}
+	httpJSON(w, views)
+}
+
+func (p *Plugin) apiCreateReservation(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	res, err := p.resourceFor(uid, mux.Vars(r)["id"])
+	if err != nil || res == nil {
+		httpErr(w, 404, "not found")
+		return
+	}
+	var req struct {
+		StartsAt time.Time `json:"starts_at"`
+		Minutes  int       `json:"minutes"`
+		Purpose  string    `json:"purpose"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil || req.Minutes <= 0 {
+		httpErr(w, 400, "invalid minutes")
+		return
+	}
+	rsv, err := p.reserveResource(res, uid, req.StartsAt, time.Duration(req.Minutes)*time.Minute, truncate(req.Purpose, maxPurposeLen))
+	if err != nil {
+		var ce *ConflictError
+		switch {
+		case errors.As(err, &ce):
+			httpErr(w, 409, err.Error())
+		case errors.Is(err, ErrBusy):
+			httpErr(w, 409, "slot overlaps the current booking")
+		case errors.Is(err, errBadSlot):
+			httpErr(w, 400, "start must be in the future and within 90 days")
+		default:
+			httpErr(w, storeErrStatus(err), err.Error())
+		}
+		return
+	}
+	httpJSON(w, rsv)
+}
+
+func (p *Plugin) apiCancelReservation(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	vars := mux.Vars(r)
+	res, err := p.resourceFor(uid, vars["id"])
+	if err != nil || res == nil {
+		httpErr(w, 404, "not found")
+		return
+	}
+	if _, err := p.cancelReservation(res, vars["rid"], uid); err != nil {
+		if errors.Is(err, ErrNoReservation) {
+			httpErr(w, 404, err.Error())
+			return
+		}
+		httpErr(w, storeErrStatus(err), err.Error())
+		return
+	}
+	httpJSON(w, map[string]string{"status": "ok"})
+}
+
+// --- Recurring rules ---
+
+func (p *Plugin) apiGetRecurring(w http.ResponseWriter, r *http.Request) {
+	if res, _ := p.resourceFor(r.Header.Get("Mattermost-User-ID"), mux.Vars(r)["id"]); res == nil {
+		httpErr(w, 404, "not found")
+		return
+	}
+	rules, err := p.store.GetRecurringRules(mux.Vars(r)["id"])
+	if err != nil {
+		httpErr(w, 500, err.Error())
+		return
+	}
+	httpJSON(w, rules)
+}
+
+func (p *Plugin) apiCreateRecurring(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	res, err := p.resourceFor(uid, mux.Vars(r)["id"])
+	if err != nil || res == nil {
+		httpErr(w, 404, "not found")
+		return
+	}
+	var rule RecurringRule
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&rule); err != nil {
+		httpErr(w, 400, "bad json")
+		return
+	}
+	rule.UserID = uid
+	rule.Purpose = truncate(rule.Purpose, maxPurposeLen)
+	rule.ExpandedUntil = time.Time{}
+	created, err := p.addRecurringRule(res, rule)
+	if errors.Is(err, errQuota) {
+		httpErr(w, 429, err.Error())
+		return
+	}
+	if err != nil {
+		httpErr(w, 400, err.Error())
+		return
+	}
+	httpJSON(w, created)
+}
+
+func (p *Plugin) apiDeleteRecurring(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	vars := mux.Vars(r)
+	res, err := p.resourceFor(uid, vars["id"])
+	if err != nil || res == nil {
+		httpErr(w, 404, "not found")
+		return
+	}
+	if _, err := p.deleteRecurringRule(res, vars["rid"], uid); err != nil {
+		if errors.Is(err, ErrNoRule) {
+			httpErr(w, 404, err.Error())
+			return
+		}
+		httpErr(w, storeErrStatus(err), err.Error())
+		return
+	}
+	httpJSON(w, map[string]string{"status": "ok"})
+}
+
+func (p *Plugin) apiAddRecurringException(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	vars := mux.Vars(r)
+	res, err := p.resourceFor(uid, vars["id"])
+	if err != nil || res == nil {
+		httpErr(w, 404, "not found")
+		return
+	}
+	var req struct {
+		Date string `json:"date"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 256)).Decode(&req); err != nil {
+		httpErr(w, 400, "bad json")
+		return
+	}
+	rule, err := p.skipRecurringDate(res, vars["rid"], req.Date, uid)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNoRule):
+			httpErr(w, 404, err.Error())
+		case errors.Is(err, errNotHolder):
+			httpErr(w, 403, err.Error())
+		default:
+			httpErr(w, 400, err.Error())
+		}
+		return
+	}
+	httpJSON(w, rule)
+}
+
+// --- Subscriptions ---
+
+func (p *Plugin) apiSubscribe(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	if res, _ := p.resourceFor(uid, mux.Vars(r)["id"]); res == nil {
+		httpErr(w, 404, "not found")
+		return
+	}
+	if err := p.store.Subscribe(mux.Vars(r)["id"], uid); err != nil {
+		httpErr(w, 400, err.Error())
+		return
+	}
+	httpJSON(w, map[string]string{"status": "subscribed"})
+}
+
+func (p *Plugin) apiUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	p.store.Unsubscribe(mux.Vars(r)["id"], uid)
+	httpJSON(w, map[string]string{"status": "ok"})
+}
+
+// --- History ---
+
+func (p *Plugin) apiGetHistory(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if res, _ := p.resourceFor(r.Header.Get("Mattermost-User-ID"), id); res == nil {
+		httpErr(w, 404, "not found")
+		return
+	}
+	entries, err := p.store.GetHistory(id, 50)
+	if err != nil {
+		httpErr(w, 500, err.Error())
+		return
+	}
+	type histView struct {
+		HistoryEntry
+		Username    string `json:"username"`
+		DisplayName string `json:"display_name"`
+	}
+	views := make([]histView, 0, len(entries))
+	for _, e := range entries {
+		views = append(views, histView{HistoryEntry: e, Username: p.username(e.UserID), DisplayName: p.plainName(e.UserID)})
+	}
+	httpJSON(w, views)
+}
+
+// apiGetPriorities returns the priority classes and the caller's highest level.
+func (p *Plugin) apiGetPriorities(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Mattermost-User-ID")
+	classes, err := p.store.GetPriorityClasses()
+	if err != nil {
+		httpErr(w, 500, err.Error())
+		return
+	}
+	if classes == nil {
+		classes = []PriorityClass{}
+	}
+	httpJSON(w, map[string]interface{}{"classes": classes, "max_priority": priorityName(p.maxPriority(uid))})
+}
 
-	b := &Booking{
-		ResourceID: resourceID, UserID: uid,
-		StartedAt: time.Now(),
-		ExpiresAt: time.Now().Add(time.Duration(minutes) * time.Minute),
+// apiSetPriorities replaces the priority classes (admin only).
+func (p *Plugin) apiSetPriorities(w http.ResponseWriter, r *http.Request) {
+	if !p.isAdmin(r.Header.Get("Mattermost-User-ID")) {
+		httpErr(w, 403, "admin only")
+		return
 	}
-	if err := p.store.SaveBooking(b); err != nil {
-		resp("Ошибка: " + err.Error())
+	var classes []PriorityClass
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16384)).Decode(&classes); err != nil {
+		httpErr(w, 400, "bad json")
+		return
+	}
+	classes = sanitizePriorityClasses(classes)
+	err := p.store.UpdatePriorityClasses(func([]PriorityClass) ([]PriorityClass, error) {
+		return classes, nil
+	})
+	if err != nil {
+		httpErr(w, 500, err.Error())
+		return
+	}
+	if classes == nil {
+		classes = []PriorityClass{}
+	}
+	httpJSON(w, classes)
+}
+
+func (p *Plugin) apiGetManagers(w http.ResponseWriter, r *http.Request) {
+	m, err := p.store.GetManagers()
+	if err != nil {
+		httpErr(w, 500, err.Error())
+		return
+	}
+	if m == nil {
+		m = &Managers{}
+	}
+	httpJSON(w, m)
+}
+
+// apiSetManagers replaces the global managers (system admin only).
+func (p *Plugin) apiSetManagers(w http.ResponseWriter, r *http.Request) {
+	if !p.isAdmin(r.Header.Get("Mattermost-User-ID")) {
+		httpErr(w, 403, "admin only")
+		return
+	}
+	var m Managers
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16384)).Decode(&m); err != nil {
+		httpErr(w, 400, "bad json")
+		return
+	}
+	clean := sanitizeManagers(&m)
+	err := p.store.UpdateManagers(func(*Managers) (*Managers, error) {
+		return clean, nil
+	})
+	if err != nil {
+		httpErr(w, 500, err.Error())
+		return
+	}
+	if clean == nil {
+		clean = &Managers{}
+	}
+	httpJSON(w, clean)
+}
+
+// --- Groups ---
+
+// groupExists reports whether id names a resource group; "" (no group) counts.
+func (p *Plugin) groupExists(id string) bool {
+	if id == "" {
+		return true
+	}
+	groups, _ := p.store.GetGroups()
+	return groupByID(groups, id) != nil
+}
+
+// groupErrStatus maps group management failures to HTTP codes.
+func groupErrStatus(err error) int {
+	switch {
+	case errors.Is(err, errNotManager):
+		return http.StatusForbidden
+	case errors.Is(err, errNoGroup):
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+func (p *Plugin) apiGetGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := p.store.GetGroups()
+	if err != nil {
+		httpErr(w, 500, err.Error())
+		return
+	}
+	if groups == nil {
+		groups = []ResourceGroup{}
+	}
+	httpJSON(w, groups)
+}
+
+func (p *Plugin) apiCreateGroup(w http.ResponseWriter, r *http.Request) {
+	var g ResourceGroup
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&g); err != nil {
+		httpErr(w, 400, "bad json")
+		return
+	}
+	created, err := p.createGroup(r.Header.Get("Mattermost-User-ID"), g)
+	if err != nil {
+		httpErr(w, groupErrStatus(err), err.Error())
+		return
+	}
+	httpJSON(w, created)
+}
+
+func (p *Plugin) apiUpdateGroup(w http.ResponseWriter, r *http.Request) {
+	var g ResourceGroup
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&g); err != nil {
+		httpErr(w, 400, "bad json")
+		return
+	}
+	updated, err := p.updateGroup(r.Header.Get("Mattermost-User-ID"), mux.Vars(r)["gid"], g)
+	if err != nil {
+		httpErr(w, groupErrStatus(err), err.Error())
+		return
+	}
+	httpJSON(w, updated)
+}
+
+func (p *Plugin) apiDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	if _, err := p.deleteGroup(r.Header.Get("Mattermost-User-ID"), mux.Vars(r)["gid"]); err != nil {
+		httpErr(w, groupErrStatus(err), err.Error())
+		return
+	}
+	httpJSON(w, map[string]string{"status": "ok"})
+}
+
+func (p *Plugin) apiSubscribeGroup(w http.ResponseWriter, r *http.Request) {
+	gid := mux.Vars(r)["gid"]
+	if !p.groupExists(gid) {
+		httpErr(w, 404, "not found")
+		return
+	}
+	if err := p.store.Subscribe(groupSubsID(gid), r.Header.Get("Mattermost-User-ID")); err != nil {
+		httpErr(w, 400, err.Error())
+		return
+	}
+	httpJSON(w, map[string]string{"status": "subscribed"})
+}
+
+func (p *Plugin) apiUnsubscribeGroup(w http.ResponseWriter, r *http.Request) {
+	p.store.Unsubscribe(groupSubsID(mux.Vars(r)["gid"]), r.Header.Get("Mattermost-User-ID"))
+	httpJSON(w, map[string]string{"status": "ok"})
+}
+
+// apiGetPresets returns the duration presets, limited by the resource's
+// policy when ?resource_id= is given.
+func (p *Plugin) apiGetPresets(w http.ResponseWriter, r *http.Request) {
+	if id := r.URL.Query().Get("resource_id"); id != "" {
+		if res, _ := p.resourceFor(r.Header.Get("Mattermost-User-ID"), id); res != nil {
+			httpJSON(w, p.limitsFor(res).presetViews())
+			return
+		}
+	}
+	httpJSON(w, DefaultPresets)
+}
+
+// ===========================
+// Interactive button actions
+// ===========================
+// Mattermost POSTs PostActionIntegrationRequest here when user clicks a button.
+// Response must be PostActionIntegrationResponse.
+
+func (p *Plugin) actionBook(w http.ResponseWriter, r *http.Request) {
+	var req model.PostActionIntegrationRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		p.API.LogError("actionBook: decode", "err", err.Error())
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(model.PostActionIntegrationResponse{
+			EphemeralText: "Ошибка запроса",
+		})
+		return
+	}
+
+	p.API.LogDebug("actionBook called",
+		"user_id", req.UserId,
+		"context", fmt.Sprintf("%v", req.Context))
+
+	if !actionCaller(r, req.UserId) {
+		httpErr(w, 401, "Unauthorized")
+		return
+	}
+	uid := req.UserId
+	resourceID, _ := req.Context["resource_id"].(string)
+	minutesF, _ := req.Context["minutes"].(float64)
+	minutes := int(minutesF)
+
+	resp := func(text string) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(model.PostActionIntegrationResponse{EphemeralText: text})
+	}
+
+	if uid == "" || resourceID == "" || minutes <= 0 {
+		resp("Ошибка: неверные параметры")
+		return
+	}
+
+	res, err := p.resourceFor(uid, resourceID)
+	if err != nil || res == nil {
+		resp("Ресурс не найден")
+		return
+	}
+
+	b, err := p.bookResource(res, uid, time.Duration(minutes)*time.Minute, "")
+	if err != nil {
+		resp(p.bookErrText(res, err))
 		return
 	}
-	p.store.RemoveFromQueue(resourceID, uid)
-	p.notifySubscribers(resourceID, fmt.Sprintf("🔒 **%s** занят @%s на %s",
-		res.Name, p.username(uid), formatDuration(time.Duration(minutes)*time.Minute)), uid)
 
 	resp(fmt.Sprintf("✅ **%s** забронирован на %dм (до %s)",
-		res.Name, minutes, b.ExpiresAt.Format("15:04")))
+		res.Name, minutes, b.ExpiresAt.Format("15:04")) + p.reservationWarning(res, uid, b.ExpiresAt))
 }
 
 func (p *Plugin) actionQueue(w http.ResponseWriter, r *http.Request) {
@@ -553,6 +1479,10 @@ func (p *Plugin) actionQueue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !actionCaller(r, req.UserId) {
+		httpErr(w, 401, "Unauthorized")
+		return
+	}
 	uid := req.UserId
 	resourceID, _ := req.Context["resource_id"].(string)
 	minutesF, _ := req.Context["minutes"].(float64)
@@ -571,35 +1501,275 @@ func (p *Plugin) actionQueue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, err := p.store.GetResource(resourceID)
+	res, err := p.resourceFor(uid, resourceID)
 	if err != nil || res == nil {
 		resp("Ресурс не найден")
 		return
 	}
 
-	booking, _ := p.store.GetBooking(resourceID)
-	if booking == nil {
+	bookings, _ := p.store.GetBookings(resourceID)
+	if len(bookings) < res.Seats() {
 		resp(fmt.Sprintf("**%s** свободен — используйте `/rq book %s 1h`", res.Name, res.Name))
 		return
 	}
-	if booking.UserID == uid {
+	if own, _ := p.store.GetUserBooking(resourceID, uid); own != nil {
 		resp("Вы уже занимаете этот ресурс")
 		return
 	}
 
-	pos, err := p.store.AddToQueue(resourceID, QueueEntry{
+	pos, err := p.joinQueue(res, QueueEntry{
 		UserID: uid, DesiredDuration: time.Duration(minutes) * time.Minute, QueuedAt: time.Now(),
 	})
 	if err != nil {
+		if text := p.limitErrText(res, err); text != "" {
+			resp(text)
+			return
+		}
 		resp("Ошибка: " + err.Error())
 		return
 	}
 
-	if !booking.NotifiedQueue {
-		p.sendDM(booking.UserID, fmt.Sprintf("👋 @%s встал в очередь на **%s**", p.username(uid), res.Name))
-		booking.NotifiedQueue = true
-		p.store.SaveBooking(booking)
+	p.notifyHolderQueued(res, uid)
+
+	resp(queuedText("**"+res.Name+"**", pos, PriorityNormal))
+}
+
+// actionClaim and actionPass answer the buttons of a claim-window DM. On
+// success the DM is rewritten without buttons.
+func (p *Plugin) actionClaim(w http.ResponseWriter, r *http.Request) {
+	p.buttonAction(w, r, true, func(res *Resource, uid string) (string, error) {
+		b, err := p.claimHold(res, uid, 0, "")
+		if errors.Is(err, ErrNotBooked) {
+			return "", errHoldExpired
+		}
+		if err != nil {
+			return "", err
+		}
+		if bundle, _ := p.store.GetBundle(b.BundleID); bundle != nil {
+			if members, err := p.findBundleIDs(bundle.ResourceIDs); err == nil {
+				return fmt.Sprintf("✅ Комплект **%s** ваш до %s", resourceNames(members), b.ExpiresAt.Format("15:04")), nil
+			}
+		}
+		return fmt.Sprintf("✅ **%s** ваш до %s", res.Name, b.ExpiresAt.Format("15:04")) +
+			p.reservationWarning(res, uid, b.ExpiresAt), nil
+	})
+}
+
+func (p *Plugin) actionPass(w http.ResponseWriter, r *http.Request) {
+	p.buttonAction(w, r, true, func(res *Resource, uid string) (string, error) {
+		if err := p.passHold(res, uid); errors.Is(err, ErrNotBooked) {
+			return "", errHoldExpired
+		} else if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("⏭ Вы пропустили **%s** — он передан следующему в очереди", res.Name), nil
+	})
+}
+
+// actionRelease and actionExtend answer the buttons of a handoff DM. The DM
+// keeps its buttons, so the result is shown as an ephemeral reply.
+func (p *Plugin) actionRelease(w http.ResponseWriter, r *http.Request) {
+	p.buttonAction(w, r, false, func(res *Resource, uid string) (string, error) {
+		if _, err := p.releaseResource(res, uid, uid); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("🔓 **%s** освобождён", res.Name), nil
+	})
+}
+
+func (p *Plugin) actionExtend(w http.ResponseWriter, r *http.Request) {
+	p.buttonAction(w, r, false, func(res *Resource, uid string) (string, error) {
+		b, err := p.extendBooking(res, uid, time.Hour)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("⏳ **%s** продлён до %s", res.Name, b.ExpiresAt.Format("15:04")), nil
+	})
+}
+
+// actionTransferAccept and actionTransferDecline answer a transfer offer DM.
+func (p *Plugin) actionTransferAccept(w http.ResponseWriter, r *http.Request) {
+	p.buttonAction(w, r, true, func(res *Resource, uid string) (string, error) {
+		b, from, err := p.acceptTransfer(res, uid)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("✅ **%s** передан вам от @%s (до %s)", res.Name, p.username(from), b.ExpiresAt.Format("15:04")), nil
+	})
+}
+
+func (p *Plugin) actionTransferDecline(w http.ResponseWriter, r *http.Request) {
+	p.buttonAction(w, r, true, func(res *Resource, uid string) (string, error) {
+		if err := p.declineTransfer(res, uid); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("✖ Вы отклонили передачу **%s**", res.Name), nil
+	})
+}
+
+// approvalAction decodes an Approve/Reject press on an approver's DM and
+// runs fn with the request ID from the button context.
+func (p *Plugin) approvalAction(w http.ResponseWriter, r *http.Request, fn func(req *model.PostActionIntegrationRequest, res *Resource, id string) (string, error)) {
+	var req model.PostActionIntegrationRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(model.PostActionIntegrationResponse{EphemeralText: "Ошибка запроса"})
+		return
+	}
+	if !actionCaller(r, req.UserId) {
+		httpErr(w, 401, "Unauthorized")
+		return
+	}
+	resp := func(out model.PostActionIntegrationResponse) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+	resourceID, _ := req.Context["resource_id"].(string)
+	id, _ := req.Context["request_id"].(string)
+	if req.UserId == "" || resourceID == "" || id == "" {
+		resp(model.PostActionIntegrationResponse{EphemeralText: "Ошибка: неверные параметры"})
+		return
+	}
+	res, err := p.store.GetResource(resourceID)
+	if err != nil || res == nil {
+		resp(model.PostActionIntegrationResponse{Update: &model.Post{Message: "Ресурс удалён"}})
+		return
+	}
+	text, err := fn(&req, res, id)
+	switch {
+	case errors.Is(err, ErrNoApproval):
+		resp(model.PostActionIntegrationResponse{Update: &model.Post{Message: approvalErrText(res, err)}})
+	case err != nil:
+		resp(model.PostActionIntegrationResponse{EphemeralText: p.bookErrText(res, err)})
+	case text == "":
+		resp(model.PostActionIntegrationResponse{})
+	default:
+		resp(model.PostActionIntegrationResponse{Update: &model.Post{Message: text}})
+	}
+}
+
+func (p *Plugin) actionApprove(w http.ResponseWriter, r *http.Request) {
+	p.approvalAction(w, r, func(req *model.PostActionIntegrationRequest, res *Resource, id string) (string, error) {
+		ar, b, pos, err := p.approveRequest(res, id, req.UserId)
+		switch {
+		case ar == nil:
+			return "", err
+		case err != nil:
+			return fmt.Sprintf("✅ Запрос @%s на **%s** одобрен, но занять ресурс не удалось: %s",
+				p.username(ar.UserID), res.Name, p.bookErrText(res, err)), nil
+		case b == nil:
+			return fmt.Sprintf("✅ Запрос @%s на **%s** одобрен — ресурс занят, @%s в очереди (позиция: %d)",
+				p.username(ar.UserID), res.Name, p.username(ar.UserID), pos), nil
+		}
+		return fmt.Sprintf("✅ Запрос @%s на **%s** одобрен (до %s)", p.username(ar.UserID), res.Name, b.ExpiresAt.Format("15:04")), nil
+	})
+}
+
+// actionReject asks the approver for a reason in a dialog; without a
+// trigger ID (old clients) the request is rejected right away.
+func (p *Plugin) actionReject(w http.ResponseWriter, r *http.Request) {
+	p.approvalAction(w, r, func(req *model.PostActionIntegrationRequest, res *Resource, id string) (string, error) {
+		if !p.isApprover(req.UserId, res) {
+			return "", errNotApprover
+		}
+		if req.TriggerId != "" {
+			appErr := p.API.OpenInteractiveDialog(model.OpenDialogRequest{
+				TriggerId: req.TriggerId,
+				URL:       actionURL("reject_reason"),
+				Dialog: model.Dialog{
+					CallbackId:  res.ID + ":" + id,
+					Title:       "Отклонить запрос",
+					SubmitLabel: "Отклонить",
+					Elements: []model.DialogElement{{
+						DisplayName: "Причина", Name: "reason", Type: "textarea",
+						Optional: true, MaxLength: maxPurposeLen,
+					}},
+				},
+			})
+			if appErr == nil {
+				return "", nil
+			}
+			p.API.LogWarn("actionReject: OpenInteractiveDialog", "err", appErr.Error())
+		}
+		ar, err := p.rejectRequest(res, id, req.UserId, "")
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("❌ Запрос @%s на **%s** отклонён", p.username(ar.UserID), res.Name), nil
+	})
+}
+
+// actionRejectReason handles the reject dialog submission.
+func (p *Plugin) actionRejectReason(w http.ResponseWriter, r *http.Request) {
+	var req model.SubmitDialogRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		httpErr(w, 400, "bad json")
+		return
+	}
+	if !actionCaller(r, req.UserId) {
+		httpErr(w, 401, "Unauthorized")
+		return
+	}
+	if req.Cancelled {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	resourceID, id, _ := strings.Cut(req.CallbackId, ":")
+	res, err := p.store.GetResource(resourceID)
+	if err != nil || res == nil {
+		httpJSON(w, model.SubmitDialogResponse{Error: "Ресурс не найден"})
+		return
+	}
+	reason, _ := req.Submission["reason"].(string)
+	if _, err := p.rejectRequest(res, id, req.UserId, truncate(strings.TrimSpace(reason), maxPurposeLen)); err != nil {
+		httpJSON(w, model.SubmitDialogResponse{Error: p.bookErrText(res, err)})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// buttonAction decodes a button press on a resource DM and runs fn. With
+// update set, a successful result replaces the DM (dropping its buttons).
+func (p *Plugin) buttonAction(w http.ResponseWriter, r *http.Request, update bool, fn func(res *Resource, uid string) (string, error)) {
+	var req model.PostActionIntegrationRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(model.PostActionIntegrationResponse{EphemeralText: "Ошибка запроса"})
+		return
+	}
+	if !actionCaller(r, req.UserId) {
+		httpErr(w, 401, "Unauthorized")
+		return
+	}
+	resp := func(out model.PostActionIntegrationResponse) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+
+	uid := req.UserId
+	resourceID, _ := req.Context["resource_id"].(string)
+	if uid == "" || resourceID == "" {
+		resp(model.PostActionIntegrationResponse{EphemeralText: "Ошибка: неверные параметры"})
+		return
+	}
+	res, err := p.resourceFor(uid, resourceID)
+	if err != nil || res == nil {
+		resp(model.PostActionIntegrationResponse{EphemeralText: "Ресурс не найден"})
+		return
 	}
 
-	resp(fmt.Sprintf("✅ Вы в очереди на **%s** (позиция: %d)", res.Name, pos))
+	text, err := fn(res, uid)
+	switch {
+	case errors.Is(err, errHoldExpired):
+		resp(model.PostActionIntegrationResponse{Update: &model.Post{
+			Message: fmt.Sprintf("⌛ Время на подтверждение **%s** истекло", res.Name)}})
+	case errors.Is(err, ErrNotBooked):
+		resp(model.PostActionIntegrationResponse{EphemeralText: fmt.Sprintf("Вы не занимаете **%s**", res.Name)})
+	case err != nil:
+		resp(model.PostActionIntegrationResponse{EphemeralText: p.bookErrText(res, err)})
+	case update:
+		resp(model.PostActionIntegrationResponse{Update: &model.Post{Message: text}})
+	default:
+		resp(model.PostActionIntegrationResponse{EphemeralText: text})
+	}
 }
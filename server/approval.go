@@ -0,0 +1,288 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Approval workflow. A resource with Approval set cannot be booked directly
+// by ordinary users: /rq book and the book API file an ApprovalRequest
+// instead, and every approver (the listed users and the members of the
+// group) gets a DM with Approve/Reject buttons. The first decision wins: on
+// approval the requester is booked, or queued if the resource is busy by
+// then; on rejection they are told the reason. Undecided requests expire via
+// the scheduler. Approvers and managers book such resources directly, and the
+// queue, reservations and pools refuse everyone else.
+
+const maxApprovers = 50 // DMs sent per request
+
+var (
+	errApprovalRequired = errors.New("booking requires approval")
+	errNotApprover      = errors.New("not an approver")
+	errNoApprovers      = errors.New("no approvers configured")
+)
+
+// isApprover reports whether userID may approve bookings of res. Managers
+// of the resource always may.
+func (p *Plugin) isApprover(userID string, res *Resource) bool {
+	if p.canManage(userID, res) {
+		return true
+	}
+	if res.Approval == nil {
+		return false
+	}
+	if containsString(res.Approval.Users, userID) {
+		return true
+	}
+	if res.Approval.Group == "" {
+		return false
+	}
+	return containsString(p.userGroups(userID), res.Approval.Group)
+}
+
+// needsApproval reports whether bookings of res by userID must be approved.
+func (p *Plugin) needsApproval(res *Resource, userID string) bool {
+	return res.Approval != nil && !p.isApprover(userID, res)
+}
+
+// approvers returns the user IDs to ask for approval of a booking of res:
+// the approvers, then the resource's own managers.
+func (p *Plugin) approvers(res *Resource) []string {
+	var ids []string
+	users := res.Approval.Users
+	var groups []string
+	if res.Approval.Group != "" {
+		groups = append(groups, res.Approval.Group)
+	}
+	if res.Managers != nil {
+		users = append(users[:len(users):len(users)], res.Managers.Users...)
+		groups = append(groups, res.Managers.Groups...)
+	}
+	for _, uid := range users {
+		if !containsString(ids, uid) && len(ids) < maxApprovers {
+			ids = append(ids, uid)
+		}
+	}
+	for _, g := range groups {
+		ids = p.groupMemberIDs(ids, g, maxApprovers)
+	}
+	return ids
+}
+
+// requestApproval files a request to book res for userID and DMs the
+// approvers. Limits and quotas are checked up front so nobody approves a
+// booking that would fail anyway.
+func (p *Plugin) requestApproval(res *Resource, userID string, dur time.Duration, purpose string) (*ApprovalRequest, error) {
+	if inMaintenance(res) {
+		return nil, errMaintenance
+	}
+	if err := p.limitsFor(res).checkBooking(dur); err != nil {
+		return nil, err
+	}
+	if err := p.checkQuota(userID, []*Resource{res}, dur); err != nil {
+		return nil, err
+	}
+	if own, _ := p.store.GetUserBooking(res.ID, userID); own != nil {
+		return nil, ErrHolding
+	}
+	ids := p.approvers(res)
+	if len(ids) == 0 {
+		return nil, errNoApprovers
+	}
+	now := time.Now()
+	req := ApprovalRequest{
+		ID: model.NewId()[:8], ResourceID: res.ID, UserID: userID, Duration: dur, Purpose: purpose,
+		RequestedAt: now, ExpiresAt: now.Add(time.Duration(p.cfgApprovalHours()) * time.Hour),
+	}
+	if err := p.store.AddApprovalRequest(req); err != nil {
+		return nil, err
+	}
+
+	posts := map[string]string{}
+	for _, uid := range ids {
+		if post := p.sendDMPost(uid, p.approvalPost(res, &req)); post != nil {
+			posts[uid] = post.Id
+		}
+	}
+	if updated, err := p.store.UpdateApprovalRequest(res.ID, req.ID, func(cur *ApprovalRequest) error {
+		cur.Posts = posts
+		return nil
+	}); err == nil {
+		return updated, nil
+	}
+	req.Posts = posts
+	return &req, nil
+}
+
+// approvalPost is the DM asking an approver to decide on req.
+func (p *Plugin) approvalPost(res *Resource, req *ApprovalRequest) *model.Post {
+	text := fmt.Sprintf("🔐 @%s просит забронировать **%s** на %s", p.username(req.UserID), res.Name, formatDuration(req.Duration))
+	if req.Purpose != "" {
+		text += ": " + req.Purpose
+	}
+	text += fmt.Sprintf("\nЗапрос действует до %s", req.ExpiresAt.Format("02.01 15:04"))
+	ctx := map[string]interface{}{"resource_id": res.ID, "request_id": req.ID}
+	post := &model.Post{}
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{{
+		Text: text,
+		Actions: []*model.PostAction{
+			{
+				Id: "approve", Name: "✅ Одобрить", Type: "button",
+				Integration: &model.PostActionIntegration{URL: actionURL("approve"), Context: ctx},
+			},
+			{
+				Id: "reject", Name: "❌ Отклонить", Type: "button",
+				Integration: &model.PostActionIntegration{URL: actionURL("reject"), Context: ctx},
+			},
+		},
+	}})
+	return post
+}
+
+// pendingApproval returns userID's pending request for res, or nil.
+func (p *Plugin) pendingApproval(res *Resource, userID string) *ApprovalRequest {
+	reqs, _ := p.store.GetApprovalRequests(res.ID)
+	for i := range reqs {
+		if reqs[i].UserID == userID && time.Now().Before(reqs[i].ExpiresAt) {
+			return &reqs[i]
+		}
+	}
+	return nil
+}
+
+// takeApproval removes a pending request for a decision by approverID.
+func (p *Plugin) takeApproval(res *Resource, id, approverID string) (*ApprovalRequest, error) {
+	if !p.isApprover(approverID, res) {
+		return nil, errNotApprover
+	}
+	return p.store.TakeApprovalRequest(res.ID, id, func(req *ApprovalRequest) error {
+		if time.Now().After(req.ExpiresAt) {
+			return ErrNoApproval
+		}
+		return nil
+	})
+}
+
+// approveRequest books res for the requester of request id. If the resource
+// got busy in the meantime the requester is queued instead and the booking
+// is nil; pos is then their queue position.
+func (p *Plugin) approveRequest(res *Resource, id, approverID string) (*ApprovalRequest, *Booking, int, error) {
+	req, err := p.takeApproval(res, id, approverID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	p.closeApprovalPosts(req, fmt.Sprintf("✅ @%s одобрил запрос @%s на **%s**",
+		p.username(approverID), p.username(req.UserID), res.Name))
+
+	b, err := p.placeBooking(res, Booking{UserID: req.UserID, ApprovedBy: approverID}, req.Duration, req.Purpose)
+	if errors.Is(err, ErrBusy) {
+		entry := QueueEntry{UserID: req.UserID, DesiredDuration: req.Duration, Purpose: req.Purpose, QueuedAt: time.Now()}
+		pos, qerr := p.enqueue(res.ID, "**"+res.Name+"**", entry, p.limitsFor(res).QueueLimit)
+		if qerr == nil {
+			p.notifyHolderQueued(res, req.UserID)
+			p.sendDM(req.UserID, fmt.Sprintf("✅ @%s одобрил бронь **%s**, но ресурс уже занят — вы в очереди (позиция: %d)",
+				p.username(approverID), res.Name, pos))
+			return req, nil, pos, nil
+		}
+		err = qerr
+	}
+	if err != nil {
+		p.sendDM(req.UserID, fmt.Sprintf("✅ @%s одобрил бронь **%s**, но занять его не удалось: %s",
+			p.username(approverID), res.Name, p.bookErrText(res, err)))
+		return req, nil, 0, err
+	}
+	p.sendDM(req.UserID, fmt.Sprintf("✅ @%s одобрил бронь **%s** — забронирован за вами на %s (до %s)",
+		p.username(approverID), res.Name, formatDuration(req.Duration), b.ExpiresAt.Format("15:04")))
+	return req, b, 0, nil
+}
+
+// rejectRequest drops request id and tells the requester why.
+func (p *Plugin) rejectRequest(res *Resource, id, approverID, reason string) (*ApprovalRequest, error) {
+	req, err := p.takeApproval(res, id, approverID)
+	if err != nil {
+		return nil, err
+	}
+	why := ""
+	if reason != "" {
+		why = ": " + reason
+	}
+	p.closeApprovalPosts(req, fmt.Sprintf("❌ @%s отклонил запрос @%s на **%s**%s",
+		p.username(approverID), p.username(req.UserID), res.Name, why))
+	p.sendDM(req.UserID, fmt.Sprintf("❌ @%s отклонил ваш запрос на **%s**%s", p.username(approverID), res.Name, why))
+	return req, nil
+}
+
+// expireApprovals drops undecided requests past their deadline. Called by
+// the scheduler.
+func (p *Plugin) expireApprovals(resourceID, name string) {
+	reqs, err := p.store.GetApprovalRequests(resourceID)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for _, r := range reqs {
+		if now.Before(r.ExpiresAt) {
+			continue
+		}
+		req, err := p.store.TakeApprovalRequest(resourceID, r.ID, nil)
+		if err != nil {
+			continue
+		}
+		p.closeApprovalPosts(req, fmt.Sprintf("⌛ Запрос @%s на **%s** истёк без решения", p.username(req.UserID), name))
+		p.sendDM(req.UserID, fmt.Sprintf("⌛ Ваш запрос на **%s** никто не согласовал вовремя — он отменён", name))
+	}
+}
+
+// closeApprovalPosts replaces the approvers' DMs about req with text,
+// dropping the buttons.
+func (p *Plugin) closeApprovalPosts(req *ApprovalRequest, text string) {
+	for _, postID := range req.Posts {
+		post, appErr := p.API.GetPost(postID)
+		if appErr != nil {
+			continue
+		}
+		post.Message = text
+		post.Props = nil
+		if _, appErr := p.API.UpdatePost(post); appErr != nil {
+			p.API.LogWarn("closeApprovalPosts: UpdatePost", "post", postID, "err", appErr.Error())
+		}
+	}
+}
+
+// approvalErrText renders approval failures for chat responses, or "".
+func approvalErrText(res *Resource, err error) string {
+	switch {
+	case errors.Is(err, errApprovalRequired):
+		return fmt.Sprintf("🔐 **%s** бронируется только после согласования — запросите бронь: `/rq book %s <время> [цель]`", res.Name, res.Name)
+	case errors.Is(err, errNotApprover):
+		return fmt.Sprintf("🚫 Вы не можете согласовывать брони **%s**", res.Name)
+	case errors.Is(err, errNoApprovers):
+		return fmt.Sprintf("Для **%s** не назначены согласующие — обратитесь к менеджеру ресурса", res.Name)
+	case errors.Is(err, ErrNoApproval):
+		return fmt.Sprintf("Запрос на **%s** уже рассмотрен или истёк", res.Name)
+	case errors.Is(err, ErrRequestPending):
+		return fmt.Sprintf("Ваш запрос на **%s** уже ждёт согласования", res.Name)
+	}
+	return ""
+}
+
+// sanitizeApproval cleans admin input; no approvers at all clears it.
+func sanitizeApproval(a *Approval) *Approval {
+	if a == nil {
+		return nil
+	}
+	out := &Approval{Group: truncate(strings.TrimPrefix(strings.TrimSpace(a.Group), "@"), maxNameLen)}
+	for _, uid := range a.Users {
+		if model.IsValidId(uid) && !containsString(out.Users, uid) && len(out.Users) < maxApprovers {
+			out.Users = append(out.Users, uid)
+		}
+	}
+	if len(out.Users) == 0 && out.Group == "" {
+		return nil
+	}
+	return out
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+// Status boards. /rq board posts the /rq list of a channel as a pinned bot
+// post and keeps editing it: after every change to a resource (batched with
+// the WebSocket events, see events.go), every group change and every
+// scheduler tick. A channel may have several boards with different filters.
+// A board is forgotten when its post is deleted, or found deleted on update.
+//
+// Everyone in the channel sees the board, so it shows only resources open to
+// all and those whose access list names the channel or its team.
+
+const (
+	maxBoards           = 100
+	maxBoardsPerChannel = 5
+	maxBoardRows        = 100
+)
+
+var (
+	errNoBoard      = errors.New("board not found")
+	errBoardLimit   = errors.New("board limit reached")
+	errNotBoardUser = errors.New("not a channel member")
+)
+
+// boardState remembers what each board post last showed, so unchanged
+// boards are not rewritten every tick.
+type boardState struct {
+	mu   sync.Mutex
+	sums map[string][32]byte
+}
+
+// createBoard posts a board for the filter args in channelID.
+func (p *Plugin) createBoard(userID, channelID string, args []string) (*Board, error) {
+	if _, appErr := p.API.GetChannelMember(channelID, userID); appErr != nil {
+		return nil, errNotBoardUser
+	}
+	ch, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		return nil, fmt.Errorf("get channel: %v", appErr)
+	}
+	boards, err := p.store.GetBoards()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBoardLimits(boards, channelID); err != nil {
+		return nil, err
+	}
+
+	b := Board{ChannelID: channelID, TeamID: ch.TeamId, Filter: args, CreatedAt: time.Now(), CreatedBy: userID}
+	entries, err := p.store.IndexEntries()
+	if err != nil {
+		return nil, err
+	}
+	groups, _ := p.store.GetGroups()
+	post := &model.Post{UserId: p.botUserID, ChannelId: channelID, IsPinned: true}
+	p.fillBoardPost(post, &b, entries, groups)
+	created, appErr := p.API.CreatePost(post)
+	if appErr != nil {
+		return nil, fmt.Errorf("create post: %v", appErr)
+	}
+	b.PostID = created.Id
+
+	err = p.store.UpdateBoards(func(boards []Board) ([]Board, error) {
+		if err := checkBoardLimits(boards, channelID); err != nil {
+			return nil, err
+		}
+		return append(boards, b), nil
+	})
+	if err != nil {
+		p.API.DeletePost(created.Id)
+		return nil, err
+	}
+	return &b, nil
+}
+
+func checkBoardLimits(boards []Board, channelID string) error {
+	if len(boards) >= maxBoards {
+		return errBoardLimit
+	}
+	n := 0
+	for _, b := range boards {
+		if b.ChannelID == channelID {
+			n++
+		}
+	}
+	if n >= maxBoardsPerChannel {
+		return errBoardLimit
+	}
+	return nil
+}
+
+// channelBoards returns the boards posted in channelID.
+func (p *Plugin) channelBoards(channelID string) ([]Board, error) {
+	boards, err := p.store.GetBoards()
+	if err != nil {
+		return nil, err
+	}
+	var out []Board
+	for _, b := range boards {
+		if b.ChannelID == channelID {
+			out = append(out, b)
+		}
+	}
+	return out, nil
+}
+
+// deleteBoard removes the board in channelID whose post ID starts with ref,
+// or its only board if ref is empty, and deletes the post. Boards are removed
+// by whoever created them or by global managers.
+func (p *Plugin) deleteBoard(userID, channelID, ref string) (*Board, error) {
+	boards, err := p.channelBoards(channelID)
+	if err != nil {
+		return nil, err
+	}
+	var found []Board
+	for _, b := range boards {
+		if ref == "" || strings.HasPrefix(b.PostID, ref) {
+			found = append(found, b)
+		}
+	}
+	if len(found) != 1 {
+		return nil, errNoBoard
+	}
+	b := found[0]
+	if b.CreatedBy != userID && !p.canManage(userID, nil) {
+		return nil, errNotManager
+	}
+	if err := p.dropBoard(b.PostID); err != nil {
+		return nil, err
+	}
+	p.API.DeletePost(b.PostID)
+	return &b, nil
+}
+
+// dropBoard forgets the board with postID, if there is one.
+func (p *Plugin) dropBoard(postID string) error {
+	return p.store.UpdateBoards(func(boards []Board) ([]Board, error) {
+		out := boards[:0]
+		for _, b := range boards {
+			if b.PostID != postID {
+				out = append(out, b)
+			}
+		}
+		return out, nil
+	})
+}
+
+// refreshBoards rewrites every board whose contents have changed.
+func (p *Plugin) refreshBoards() {
+	boards, err := p.store.GetBoards()
+	if err != nil || len(boards) == 0 {
+		return
+	}
+	entries, err := p.store.IndexEntries()
+	if err != nil {
+		return
+	}
+	groups, _ := p.store.GetGroups()
+
+	p.boards.mu.Lock()
+	defer p.boards.mu.Unlock()
+	old := p.boards.sums
+	p.boards.sums = make(map[string][32]byte, len(boards))
+	for i := range boards {
+		b := &boards[i]
+		var fresh model.Post
+		p.fillBoardPost(&fresh, b, entries, groups)
+		data, _ := json.Marshal(fresh.Props)
+		sum := sha256.Sum256(append([]byte(fresh.Message), data...))
+		if old[b.PostID] == sum {
+			p.boards.sums[b.PostID] = sum
+			continue
+		}
+		post, appErr := p.API.GetPost(b.PostID)
+		if appErr != nil && appErr.StatusCode != http.StatusNotFound {
+			continue
+		}
+		if appErr != nil || post.DeleteAt != 0 {
+			p.API.LogInfo("Status board post is gone, dropping the board", "post", b.PostID, "channel", b.ChannelID)
+			p.dropBoard(b.PostID)
+			continue
+		}
+		post.Message, post.Props = fresh.Message, fresh.Props
+		if _, appErr := p.API.UpdatePost(post); appErr != nil {
+			p.API.LogWarn("refreshBoards: UpdatePost", "post", b.PostID, "err", appErr.Error())
+			continue
+		}
+		p.boards.sums[b.PostID] = sum
+	}
+}
+
+// fillBoardPost renders board b into post: a header and the /rq list rows of
+// the resources the channel may see.
+func (p *Plugin) fillBoardPost(post *model.Post, b *Board, entries []*indexEntry, groups []ResourceGroup) {
+	filter, _ := parseFilterArgs(b.Filter)
+	matches := p.filterMatcher(filter)
+	byID := map[string]*indexEntry{}
+	var resources []*Resource
+	for _, e := range entries {
+		if !boardVisible(b, &e.Resource) || !matches(&e.Resource, func(*Resource) bool { return e.free() }) {
+			continue
+		}
+		byID[e.Resource.ID] = e
+		resources = append(resources, &e.Resource)
+	}
+
+	header := "📋 **Ресурсы**"
+	if !filter.empty() {
+		header += " · " + describeFilter(filter)
+	}
+	free := 0
+	for _, e := range byID {
+		if e.free() {
+			free++
+		}
+	}
+	header += fmt.Sprintf(" · свободно %d из %d · обновлено %s", free, len(resources), time.Now().Format("15:04"))
+
+	var attachments []*model.SlackAttachment
+	rows := 0
+	for _, sec := range groupSections(groups, resources) {
+		if rows >= maxBoardRows {
+			break
+		}
+		if sec.Group != nil {
+			attachments = append(attachments, &model.SlackAttachment{Text: groupHeading(sec)})
+		}
+		for _, r := range sec.Resources {
+			if rows >= maxBoardRows {
+				break
+			}
+			e := byID[r.ID]
+			attachments = append(attachments, p.listRow(r, e.active(), e.Queue))
+			rows++
+		}
+	}
+	switch {
+	case len(resources) == 0 && filter.empty():
+		header += "\nНет ресурсов"
+	case len(resources) == 0:
+		header += "\nНет ресурсов по фильтру"
+	case rows < len(resources):
+		header += fmt.Sprintf("\n… показаны первые %d, остальные — `/rq list`", rows)
+	}
+	post.Message = header
+	model.ParseSlackAttachment(post, attachments)
+}
+
+// boardVisible reports whether res may be shown on b, which everyone in the
+// board's channel can read.
+func boardVisible(b *Board, res *Resource) bool {
+	a := res.Access
+	return a == nil || containsString(a.Channels, b.ChannelID) || (b.TeamID != "" && containsString(a.Teams, b.TeamID))
+}
+
+func boardErrText(err error) string {
+	switch {
+	case errors.Is(err, errNoBoard):
+		return "Доска не найдена: укажите начало ID её сообщения (`/rq board list`)"
+	case errors.Is(err, errBoardLimit):
+		return fmt.Sprintf("Слишком много досок: не больше %d в канале и %d всего", maxBoardsPerChannel, maxBoards)
+	case errors.Is(err, errNotBoardUser):
+		return "🚫 Доску можно создать только в канале, где вы состоите"
+	case errors.Is(err, errNotManager):
+		return "🚫 Доску удаляет тот, кто её создал, или глобальный менеджер"
+	}
+	return ""
+}
+
+// MessageHasBeenDeleted forgets a board whose post was deleted.
+func (p *Plugin) MessageHasBeenDeleted(c *plugin.Context, post *model.Post) {
+	if post.UserId == p.botUserID {
+		p.dropBoard(post.Id)
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Booking state transitions shared by slash commands, the REST API and
+// interactive buttons. Every transition goes through an atomic Store method,
+// so when two users race for the same resource exactly one of them wins and
+// the other gets a proper error instead of silently overwriting the booking.
+
+var (
+	errNotHolder   = errors.New("not holder")
+	errMaxExceeded = errors.New("max booking duration exceeded")
+	// errAmbiguousHolder is returned when an admin releases a multi-seat
+	// resource without saying whose seat to free.
+	errAmbiguousHolder = errors.New("several holders, specify user")
+	// errBookForDenied is returned when a user who does not manage a
+	// resource tries to book it for someone else.
+	errBookForDenied = errors.New("booking for others not allowed")
+)
+
+// bookResource atomically takes a seat of res for userID, then drops the user
+// from the queue and tells subscribers. Returns ErrBusy if all seats are taken.
+func (p *Plugin) bookResource(res *Resource, userID string, dur time.Duration, purpose string) (*Booking, error) {
+	return p.bookFor(res, userID, userID, dur, purpose)
+}
+
+// bookFor is bookResource on behalf of actorID: the booking belongs to
+// userID, counts against their quota and records actorID as BookedBy when
+// they differ. Only managers of res may book for others; the user gets a DM.
+// Resources that require approval return errApprovalRequired unless actorID
+// is an approver or userID is claiming a hold from the queue.
+func (p *Plugin) bookFor(res *Resource, actorID, userID string, dur time.Duration, purpose string) (*Booking, error) {
+	onBehalf := actorID != userID
+	if onBehalf && !p.canManage(actorID, res) {
+		return nil, errBookForDenied
+	}
+	if onBehalf && !p.canAccess(userID, res) {
+		return nil, errNoAccess
+	}
+	if inMaintenance(res) {
+		return nil, errMaintenance
+	}
+	if p.needsApproval(res, actorID) {
+		if own, _ := p.store.GetUserBooking(res.ID, userID); own == nil || !own.Hold {
+			return nil, errApprovalRequired
+		}
+	}
+	tmpl := Booking{UserID: userID}
+	if onBehalf {
+		tmpl.BookedBy = actorID
+	}
+	b, err := p.placeBooking(res, tmpl, dur, purpose)
+	if err != nil || !onBehalf {
+		return b, err
+	}
+	msg := fmt.Sprintf("📌 @%s забронировал для вас **%s** на %s (до %s)",
+		p.username(actorID), res.Name, formatDuration(b.ExpiresAt.Sub(b.StartedAt)), b.ExpiresAt.Format("15:04"))
+	if b.Purpose != "" {
+		msg += ": " + b.Purpose
+	}
+	p.sendDM(userID, msg+"\n`/rq release "+res.Name+"` — освободить, если не нужен")
+	return b, nil
+}
+
+// placeBooking takes a seat of res for tmpl.UserID for dur after checking
+// limits and quotas, claiming the user's hold if they have one. tmpl carries
+// the attribution fields (BookedBy, ApprovedBy) of the new booking.
+func (p *Plugin) placeBooking(res *Resource, tmpl Booking, dur time.Duration, purpose string) (*Booking, error) {
+	userID := tmpl.UserID
+	if inMaintenance(res) {
+		return nil, errMaintenance
+	}
+	if err := p.limitsFor(res).checkBooking(dur); err != nil {
+		return nil, err
+	}
+	if own, _ := p.store.GetUserBooking(res.ID, userID); own != nil && own.Hold {
+		b, err := p.claimHold(res, userID, dur, purpose)
+		if err != nil || (tmpl.BookedBy == "" && tmpl.ApprovedBy == "") {
+			return b, err
+		}
+		if updated, err := p.store.UpdateBooking(res.ID, userID, func(cur *Booking) error {
+			cur.BookedBy, cur.ApprovedBy = tmpl.BookedBy, tmpl.ApprovedBy
+			return nil
+		}); err == nil {
+			b = updated
+		}
+		return b, nil
+	}
+	if err := p.checkQuota(userID, []*Resource{res}, dur); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	b := &tmpl
+	b.ResourceID, b.Purpose = res.ID, purpose
+	b.StartedAt, b.ExpiresAt = now, now.Add(dur)
+	if err := p.store.CreateBooking(b, res.Seats()); err != nil {
+		return nil, err
+	}
+	p.store.RemoveFromQueue(res.ID, userID)
+	if res.Pool != "" {
+		p.store.RemoveFromQueue(poolQueueID(res.Pool), userID)
+	}
+	p.notifySubscribers(res.ID, fmt.Sprintf("🔒 **%s** занят @%s на %s%s", res.Name, p.username(userID), formatDuration(dur), p.seatsNote(res)), userID)
+	return b, nil
+}
+
+// releaseResource ends a booking on behalf of actorID, records history,
+// notifies subscribers and hands the freed seat to the queue. A booking that
+// is part of a bundle releases the whole bundle. targetUserID
+// selects whose seat to free; if empty it is the actor's own booking, or for
+// a manager the only holder of the resource.
+func (p *Plugin) releaseResource(res *Resource, actorID, targetUserID string) (*Booking, error) {
+	if targetUserID == "" {
+		targetUserID = actorID
+		if own, _ := p.store.GetUserBooking(res.ID, actorID); own == nil && p.canManage(actorID, res) {
+			bookings, err := p.store.GetBookings(res.ID)
+			if err != nil {
+				return nil, err
+			}
+			if len(bookings) > 1 {
+				return nil, errAmbiguousHolder
+			}
+			if len(bookings) == 1 {
+				targetUserID = bookings[0].UserID
+			}
+		}
+	}
+	if b, _ := p.store.GetUserBooking(res.ID, targetUserID); b != nil && b.BundleID != "" {
+		if _, err := p.releaseBundle(b.BundleID, actorID); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	booking, err := p.store.TakeBooking(res.ID, targetUserID, func(b *Booking) error {
+		if b.IsExpired() {
+			return ErrNotBooked
+		}
+		if b.UserID != actorID && !p.canManage(actorID, res) {
+			return errNotHolder
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if booking.Hold {
+		p.processQueue(res.ID, res.Name) // a released hold is a pass
+		return booking, nil
+	}
+	p.store.AddHistory(booking.History(time.Now()))
+	if booking.PreemptedBy != "" {
+		p.completePreemption(res.ID, res.Name, booking)
+		return booking, nil
+	}
+	p.notifyFreed(res, fmt.Sprintf("🔓 **%s** освобождён%s", res.Name, p.seatsNote(res)))
+	p.processQueue(res.ID, res.Name)
+	return booking, nil
+}
+
+// extendBooking pushes the user's expiry by dur within the resource's limits.
+// Bundle bookings are extended together.
+func (p *Plugin) extendBooking(res *Resource, userID string, dur time.Duration) (*Booking, error) {
+	own, _ := p.store.GetUserBooking(res.ID, userID)
+	if own != nil && own.BundleID != "" && !own.Hold {
+		extended, err := p.extendBundle(own.BundleID, userID, dur)
+		if err != nil {
+			return nil, err
+		}
+		for i := range extended {
+			if extended[i].ResourceID == res.ID {
+				return &extended[i], nil
+			}
+		}
+		return &extended[0], nil
+	}
+	if own != nil && !own.Hold {
+		if err := p.checkQuotaSpan(userID, []*Resource{res}, own.ExpiresAt, own.ExpiresAt.Add(dur), false); err != nil {
+			return nil, err
+		}
+	}
+	l := p.limitsFor(res)
+	b, err := p.store.UpdateBooking(res.ID, userID, func(b *Booking) error {
+		if b.Hold {
+			return ErrNotBooked
+		}
+		if b.PreemptedBy != "" {
+			return errPreempted
+		}
+		if err := l.checkExtend(b, dur); err != nil {
+			return err
+		}
+		b.ExpiresAt = b.ExpiresAt.Add(dur)
+		b.Extended += dur
+		b.NotifiedSoon = false
+		return nil
+	})
+	if errors.Is(err, ErrNotBooked) {
+		if others, _ := p.store.GetBookings(res.ID); len(others) > 0 {
+			return nil, errNotHolder
+		}
+	}
+	return b, err
+}
+
+// joinQueue validates the wanted duration against res's limits and queues
+// the entry, up to the resource's queue limit.
+func (p *Plugin) joinQueue(res *Resource, entry QueueEntry) (int, error) {
+	l := p.limitsFor(res)
+	if err := l.checkBooking(entry.DesiredDuration); err != nil {
+		return -1, err
+	}
+	if inMaintenance(res) {
+		return -1, errMaintenance
+	}
+	if p.needsApproval(res, entry.UserID) {
+		return -1, errApprovalRequired
+	}
+	return p.enqueue(res.ID, "**"+res.Name+"**", entry, l.QueueLimit)
+}
+
+// queuedText confirms a queue entry, mentioning a raised priority.
+func queuedText(what string, pos, priority int) string {
+	text := fmt.Sprintf("✅ Вы в очереди на %s (позиция: %d)", what, pos)
+	if priority > PriorityNormal {
+		text += ", приоритет: " + priorityLabel(priority)
+	}
+	return text
+}
+
+// notifyHolderQueued tells the current holders that someone joined the queue.
+// Each holder's NotifiedQueue flag is flipped atomically so they are told once.
+func (p *Plugin) notifyHolderQueued(res *Resource, queuedUserID string) {
+	var notify []string
+	err := p.store.UpdateBookings(res.ID, func(b *Booking) error {
+		if b.Hold {
+			return nil
+		}
+		if !b.NotifiedQueue {
+			notify = append(notify, b.UserID)
+		}
+		b.NotifiedQueue = true
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	for _, uid := range notify {
+		p.sendDM(uid, fmt.Sprintf("👋 @%s встал в очередь на **%s**", p.username(queuedUserID), res.Name))
+	}
+}
+
+// hasFreeSeat reports whether res can take one more holder right now.
+func (p *Plugin) hasFreeSeat(res *Resource) bool {
+	if inMaintenance(res) {
+		return false
+	}
+	bookings, _ := p.store.GetBookings(res.ID)
+	return len(bookings) < res.Seats()
+}
+
+// seatsNote renders " (n/N мест)" for multi-seat resources and "" otherwise.
+func (p *Plugin) seatsNote(res *Resource) string {
+	if res.Seats() == 1 {
+		return ""
+	}
+	bookings, _ := p.store.GetBookings(res.ID)
+	return fmt.Sprintf(" (%d/%d мест)", len(bookings), res.Seats())
+}
+
+// bookErrText renders a failed booking attempt for chat responses.
+func (p *Plugin) bookErrText(res *Resource, err error) string {
+	var be *BundleError
+	if errors.As(err, &be) {
+		res = be.Resource // the member that failed
+	}
+	if text := p.limitErrText(res, err); text != "" {
+		return text
+	}
+	if text := quotaErrText(err); text != "" {
+		return text
+	}
+	if text := preemptErrText(res, err); text != "" {
+		return text
+	}
+	if text := transferErrText(res, err); text != "" {
+		return text
+	}
+	if text := approvalErrText(res, err); text != "" {
+		return text
+	}
+	switch {
+	case errors.Is(err, ErrBusy):
+		bookings, _ := p.store.GetBookings(res.ID)
+		if h := holdOf(bookings); h != nil && len(bookings) == 1 {
+			return fmt.Sprintf("⏳ **%s** придержан для @%s до %s", res.Name, p.username(h.UserID), h.ExpiresAt.Format("15:04"))
+		}
+		if len(bookings) == 1 {
+			b := bookings[0]
+			return fmt.Sprintf("🔴 **%s** занят @%s (⏱ %s)", res.Name, p.username(b.UserID), formatTimeLeft(time.Until(b.ExpiresAt)))
+		}
+		if len(bookings) > 1 {
+			return fmt.Sprintf("🔴 **%s**: все места заняты (%d/%d), ближайшее освободится через %s",
+				res.Name, len(bookings), res.Seats(), formatTimeLeft(time.Until(earliestExpiry(bookings))))
+		}
+		return fmt.Sprintf("🔴 **%s** уже занят", res.Name)
+	case errors.Is(err, ErrHolding):
+		return fmt.Sprintf("Вы уже занимаете **%s**", res.Name)
+	case errors.Is(err, errNoAccess):
+		return fmt.Sprintf("🚫 У этого пользователя нет доступа к **%s**", res.Name)
+	case errors.Is(err, errMaintenance):
+		m := res.Maintenance
+		if m == nil {
+			return fmt.Sprintf("🛠 **%s** на обслуживании", res.Name)
+		}
+		return fmt.Sprintf("🛠 **%s** на обслуживании%s%s — бронь и очередь недоступны", res.Name, maintenanceUntil(m), maintenanceReason(m))
+	case errors.Is(err, errBookForDenied):
+		return fmt.Sprintf("🚫 Бронировать **%s** для других могут только его менеджеры", res.Name)
+	case errors.Is(err, errAmbiguousHolder):
+		return fmt.Sprintf("У **%s** несколько держателей — укажите, чьё место освободить: `/rq release %s @user`", res.Name, res.Name)
+	case errors.Is(err, ErrConflict):
+		return "⚠️ Ресурс одновременно изменил другой пользователь, попробуйте ещё раз"
+	}
+	return "Ошибка: " + err.Error()
+}
+
+// storeErrStatus maps errors from booking transitions to HTTP status codes.
+func storeErrStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrBusy), errors.Is(err, ErrConflict), errors.Is(err, ErrHolding),
+		errors.Is(err, errPreempted), errors.Is(err, errSeatFree), errors.Is(err, errNoTransfer),
+		errors.Is(err, ErrNoApproval), errors.Is(err, ErrRequestPending), errors.Is(err, errNoApprovers),
+		errors.Is(err, errMaintenance):
+		return http.StatusConflict
+	case errors.Is(err, errQuota):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrNotBooked), errors.Is(err, errMaxExceeded), errors.Is(err, errAmbiguousHolder),
+		errors.Is(err, errNotPreset), errors.Is(err, errExtendExceeded),
+		errors.Is(err, errBundleTransfer), errors.Is(err, errSelfTransfer), errors.Is(err, errNotQueued),
+		errors.Is(err, errBadMaintenance):
+		return http.StatusBadRequest
+	case errors.Is(err, errNotHolder), errors.Is(err, errPriorityDenied), errors.Is(err, errPreemptDenied),
+		errors.Is(err, errBookForDenied), errors.Is(err, errApprovalRequired), errors.Is(err, errNotApprover),
+		errors.Is(err, errNoAccess), errors.Is(err, errNotManager):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// earliestExpiry returns the soonest expiry among bookings.
+func earliestExpiry(bookings []Booking) time.Time {
+	t := bookings[0].ExpiresAt
+	for _, b := range bookings[1:] {
+		if b.ExpiresAt.Before(t) {
+			t = b.ExpiresAt
+		}
+	}
+	return t
+}
@@ -0,0 +1,560 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Bundles book several resources together: either every member is booked or
+// none is. The member bookings carry the bundle ID and are released and
+// extended as one unit; history still gets one record per resource, linked
+// by the bundle ID. Users waiting for a whole set share one bundle queue that
+// is served when all members have a free seat at the same time: the waiter
+// gets a hold on every member for the claim window, tagged with a new bundle
+// ID, and claims or passes the set as a whole (see claim.go).
+
+var errBundleSize = fmt.Errorf("a bundle needs 2 to %d resources", maxBundleSize)
+
+// BundleError reports which member kept a bundle from being booked.
+type BundleError struct {
+	Resource *Resource
+	Err      error
+}
+
+func (e *BundleError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Resource.Name, e.Err)
+}
+
+func (e *BundleError) Unwrap() error { return e.Err }
+
+// isBundleRef reports whether a command argument lists several resources ("a,b,c").
+func isBundleRef(arg string) bool {
+	return strings.Contains(arg, ",")
+}
+
+// findBundle resolves "a,b,c" to distinct resources userID may access.
+func (p *Plugin) findBundle(userID, ref string) ([]*Resource, error) {
+	var members []*Resource
+	seen := map[string]bool{}
+	for _, part := range strings.Split(ref, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if isPoolRef(part) {
+			return nil, fmt.Errorf("пулы нельзя включать в комплект: `%s`", part)
+		}
+		res, err := p.findResource(userID, part)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[res.ID] {
+			seen[res.ID] = true
+			members = append(members, res)
+		}
+	}
+	if len(members) < 2 || len(members) > maxBundleSize {
+		return nil, fmt.Errorf("в комплекте должно быть от 2 до %d ресурсов", maxBundleSize)
+	}
+	return members, nil
+}
+
+// findBundleIDs resolves resource IDs from an API request.
+func (p *Plugin) findBundleIDs(ids []string) ([]*Resource, error) {
+	var members []*Resource
+	seen := map[string]bool{}
+	for _, id := range ids {
+		res, err := p.store.GetResource(id)
+		if err != nil {
+			return nil, err
+		}
+		if res == nil {
+			return nil, fmt.Errorf("resource %s not found", id)
+		}
+		if !seen[res.ID] {
+			seen[res.ID] = true
+			members = append(members, res)
+		}
+	}
+	if len(members) < 2 || len(members) > maxBundleSize {
+		return nil, errBundleSize
+	}
+	return members, nil
+}
+
+// bookBundle books every member for userID or none of them. Bookings are
+// created one by one; if any member is busy the ones already created are
+// taken back before anyone is notified, and a *BundleError names the culprit.
+func (p *Plugin) bookBundle(members []*Resource, userID string, dur time.Duration, purpose string) (*Bundle, error) {
+	for _, res := range members {
+		if err := p.limitsFor(res).checkBooking(dur); err != nil {
+			return nil, &BundleError{Resource: res, Err: err}
+		}
+		if inMaintenance(res) {
+			return nil, &BundleError{Resource: res, Err: errMaintenance}
+		}
+		if p.needsApproval(res, userID) {
+			return nil, &BundleError{Resource: res, Err: errApprovalRequired}
+		}
+	}
+	if own, _ := p.store.GetUserBooking(members[0].ID, userID); own != nil && own.Hold && own.BundleID != "" {
+		if bundle, _ := p.store.GetBundle(own.BundleID); bundle != nil && sameMembers(bundle.ResourceIDs, members) {
+			if _, err := p.claimBundleHold(members[0], own, dur, purpose); err != nil {
+				return nil, err
+			}
+			return bundle, nil
+		}
+	}
+	if err := p.checkQuota(userID, members, dur); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	bundle := &Bundle{ID: model.NewId()[:8], UserID: userID, Purpose: purpose, CreatedAt: now}
+	for _, res := range members {
+		bundle.ResourceIDs = append(bundle.ResourceIDs, res.ID)
+	}
+	// The record goes first so a booking never points at a missing bundle.
+	if err := p.store.SaveBundle(bundle); err != nil {
+		return nil, err
+	}
+	for i, res := range members {
+		b := &Booking{
+			ResourceID: res.ID, UserID: userID, Purpose: purpose,
+			StartedAt: now, ExpiresAt: now.Add(dur), BundleID: bundle.ID,
+		}
+		if err := p.store.CreateBooking(b, res.Seats()); err != nil {
+			p.rollbackBundle(bundle, members[:i])
+			return nil, &BundleError{Resource: res, Err: err}
+		}
+	}
+
+	p.store.RemoveFromBundleQueue(userID, bundle.ResourceIDs)
+	names := resourceNames(members)
+	for _, res := range members {
+		p.store.RemoveFromQueue(res.ID, userID)
+		p.notifySubscribers(res.ID, fmt.Sprintf("🔒 **%s** занят @%s на %s (комплект: %s)",
+			res.Name, p.username(userID), formatDuration(dur), names), userID)
+	}
+	return bundle, nil
+}
+
+func (p *Plugin) rollbackBundle(bundle *Bundle, booked []*Resource) {
+	for _, res := range booked {
+		_, err := p.store.TakeBooking(res.ID, bundle.UserID, func(b *Booking) error {
+			if b.BundleID != bundle.ID {
+				return ErrConflict
+			}
+			return nil
+		})
+		if err != nil {
+			p.API.LogWarn("rollbackBundle: TakeBooking", "resource", res.ID, "bundle", bundle.ID, "err", err.Error())
+		}
+	}
+	p.store.DeleteBundle(bundle.ID)
+}
+
+// releaseBundle ends every booking of the bundle on behalf of actorID (the
+// owner or a manager of every member), with one history record per resource.
+func (p *Plugin) releaseBundle(bundleID, actorID string) ([]Booking, error) {
+	bundle, err := p.store.GetBundle(bundleID)
+	if err != nil {
+		return nil, err
+	}
+	if bundle == nil {
+		return nil, ErrNotBooked
+	}
+	if bundle.UserID != actorID {
+		// Someone else's bundle needs a manager of every member.
+		for _, id := range bundle.ResourceIDs {
+			res, _ := p.store.GetResource(id)
+			if res != nil && !p.canManage(actorID, res) {
+				return nil, errNotHolder
+			}
+		}
+	}
+	var released []Booking
+	for _, id := range bundle.ResourceIDs {
+		booking, err := p.store.TakeBooking(id, bundle.UserID, func(b *Booking) error {
+			if b.BundleID != bundle.ID || b.IsExpired() {
+				return ErrNotBooked
+			}
+			return nil
+		})
+		if err != nil {
+			continue // already expired or released
+		}
+		released = append(released, *booking)
+		name := id
+		res, _ := p.store.GetResource(id)
+		if res != nil {
+			name = res.Name
+		}
+		if booking.Hold {
+			p.processQueue(id, name) // a released hold is a pass
+			continue
+		}
+		p.store.AddHistory(booking.History(time.Now()))
+		if res != nil {
+			p.notifyFreed(res, fmt.Sprintf("🔓 **%s** освобождён%s", name, p.seatsNote(res)))
+		}
+		p.processQueue(id, name)
+	}
+	p.store.DeleteBundle(bundle.ID)
+	if len(released) == 0 {
+		return nil, ErrNotBooked
+	}
+	return released, nil
+}
+
+// extendBundle pushes the expiry of every booking in the bundle by dur. All
+// members are checked against their limits, and the added time against the
+// quotas, before any is changed.
+func (p *Plugin) extendBundle(bundleID, userID string, dur time.Duration) ([]Booking, error) {
+	bundle, err := p.store.GetBundle(bundleID)
+	if err != nil {
+		return nil, err
+	}
+	if bundle == nil {
+		return nil, ErrNotBooked
+	}
+	if bundle.UserID != userID {
+		return nil, errNotHolder
+	}
+	var members []*Resource
+	var until time.Time
+	for _, id := range bundle.ResourceIDs {
+		b, _ := p.store.GetUserBooking(id, userID)
+		res, _ := p.store.GetResource(id)
+		if b == nil || b.BundleID != bundle.ID || b.Hold || res == nil {
+			continue
+		}
+		if err := p.limitsFor(res).checkExtend(b, dur); err != nil {
+			return nil, &BundleError{Resource: res, Err: err}
+		}
+		members = append(members, res)
+		if b.ExpiresAt.After(until) {
+			until = b.ExpiresAt
+		}
+	}
+	if len(members) > 0 {
+		if err := p.checkQuotaSpan(userID, members, until, until.Add(dur), false); err != nil {
+			return nil, err
+		}
+	}
+	var extended []Booking
+	for _, id := range bundle.ResourceIDs {
+		b, err := p.store.UpdateBooking(id, userID, func(b *Booking) error {
+			if b.BundleID != bundle.ID || b.Hold {
+				return ErrNotBooked
+			}
+			b.ExpiresAt = b.ExpiresAt.Add(dur)
+			b.Extended += dur
+			b.NotifiedSoon = false
+			return nil
+		})
+		if err == nil {
+			extended = append(extended, *b)
+		}
+	}
+	if len(extended) == 0 {
+		return nil, ErrNotBooked
+	}
+	return extended, nil
+}
+
+// queueBundle puts userID in line for the whole set and tells the holders of
+// busy members.
+func (p *Plugin) queueBundle(members []*Resource, userID string, dur time.Duration, purpose string) (int, error) {
+	for _, res := range members {
+		if inMaintenance(res) {
+			return -1, &BundleError{Resource: res, Err: errMaintenance}
+		}
+		if p.needsApproval(res, userID) {
+			return -1, &BundleError{Resource: res, Err: errApprovalRequired}
+		}
+	}
+	entry := BundleQueueEntry{UserID: userID, DesiredDuration: dur, Purpose: purpose, QueuedAt: time.Now()}
+	for _, res := range members {
+		entry.ResourceIDs = append(entry.ResourceIDs, res.ID)
+	}
+	pos, err := p.store.AddToBundleQueue(entry)
+	if err != nil {
+		return -1, err
+	}
+	for _, res := range members {
+		if !p.hasFreeSeat(res) {
+			p.notifyHolderQueued(res, userID)
+		}
+	}
+	return pos, nil
+}
+
+// cleanupBundle deletes the bundle record once none of its bookings is left.
+func (p *Plugin) cleanupBundle(bundleID string) {
+	bundle, _ := p.store.GetBundle(bundleID)
+	if bundle == nil {
+		return
+	}
+	for _, id := range bundle.ResourceIDs {
+		bookings, _ := p.store.GetBookingsRaw(id)
+		for _, b := range bookings {
+			if b.BundleID == bundleID {
+				return
+			}
+		}
+	}
+	p.store.DeleteBundle(bundleID)
+}
+
+// serveBundleQueue holds the set of the oldest bundle waiter whose whole set
+// is now free, res included, unless someone in the resource's own or pool
+// queue has waited longer. Returns true if a bundle waiter got the set.
+func (p *Plugin) serveBundleQueue(res *Resource) bool {
+	entries, err := p.store.GetBundleQueue()
+	if err != nil || len(entries) == 0 {
+		return false
+	}
+	var heads []QueueEntry
+	if own, _ := p.store.GetQueueEntries(res.ID); len(own) > 0 {
+		heads = append(heads, own[0])
+	}
+	if res.Pool != "" {
+		if shared, _ := p.store.GetQueueEntries(poolQueueID(res.Pool)); len(shared) > 0 {
+			heads = append(heads, shared[0])
+		}
+	}
+	for _, e := range entries {
+		if !containsString(e.ResourceIDs, res.ID) {
+			continue
+		}
+		for _, h := range heads {
+			// Bundle waiters have normal priority.
+			if queueBefore(h, QueueEntry{QueuedAt: e.QueuedAt}) {
+				return false
+			}
+		}
+		members, err := p.findBundleIDs(e.ResourceIDs)
+		if err != nil || !p.allFree(members) {
+			continue
+		}
+		hold, ok := p.holdBundle(e, members)
+		if !ok {
+			continue
+		}
+		p.sendBundleHoldOffer(res, members, hold)
+		return true
+	}
+	return false
+}
+
+// holdBundle holds every member for bundle waiter e for the claim window and
+// takes e out of the bundle queue. Either every hold is created or none is.
+// Returns the hold on the first member.
+func (p *Plugin) holdBundle(e BundleQueueEntry, members []*Resource) (*Booking, bool) {
+	now := time.Now()
+	window := time.Duration(p.cfgClaimMinutes()) * time.Minute
+	bundle := &Bundle{ID: model.NewId()[:8], UserID: e.UserID, Purpose: e.Purpose, CreatedAt: now}
+	for _, res := range members {
+		bundle.ResourceIDs = append(bundle.ResourceIDs, res.ID)
+	}
+	if err := p.store.SaveBundle(bundle); err != nil {
+		return nil, false
+	}
+	var first *Booking
+	for i, res := range members {
+		hold := &Booking{
+			ResourceID: res.ID, UserID: e.UserID, Purpose: e.Purpose,
+			StartedAt: now, ExpiresAt: now.Add(window),
+			Hold: true, Desired: e.DesiredDuration, BundleID: bundle.ID,
+		}
+		if err := p.store.CreateBooking(hold, res.Seats()); err != nil {
+			p.rollbackBundle(bundle, members[:i])
+			if errors.Is(err, ErrHolding) {
+				p.store.RemoveFromBundleQueue(e.UserID, e.ResourceIDs)
+			}
+			return nil, false
+		}
+		if first == nil {
+			first = hold
+		}
+	}
+	if removed, _ := p.store.RemoveFromBundleQueue(e.UserID, e.ResourceIDs); !removed {
+		p.rollbackBundle(bundle, members)
+		return nil, false
+	}
+	return first, true
+}
+
+func (p *Plugin) sendBundleHoldOffer(res *Resource, members []*Resource, hold *Booking) {
+	ctx := map[string]interface{}{"resource_id": res.ID}
+	post := &model.Post{}
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{{
+		Text: fmt.Sprintf("🎉 Комплект **%s** свободен! Вы следующий в очереди — ресурсы придержаны для вас до %s.",
+			resourceNames(members), hold.ExpiresAt.Format("15:04")),
+		Actions: []*model.PostAction{
+			{
+				Id: "claim", Name: fmt.Sprintf("✅ Занять на %s", formatDuration(hold.Desired)), Type: "button",
+				Integration: &model.PostActionIntegration{URL: actionURL("claim"), Context: ctx},
+			},
+			{
+				Id: "pass", Name: "⏭ Пропустить", Type: "button",
+				Integration: &model.PostActionIntegration{URL: actionURL("pass"), Context: ctx},
+			},
+		},
+	}})
+	p.sendDMPost(hold.UserID, post)
+}
+
+// claimBundleHold turns the holds of the bundle that hold belongs to into
+// bookings lasting dur (the duration asked for in the bundle queue if dur is
+// 0) and returns the booking of res. If a hold is gone, the rest of the set
+// is given up as well.
+func (p *Plugin) claimBundleHold(res *Resource, hold *Booking, dur time.Duration, purpose string) (*Booking, error) {
+	bundle, err := p.store.GetBundle(hold.BundleID)
+	if err != nil {
+		return nil, err
+	}
+	if bundle == nil {
+		return nil, ErrNotBooked
+	}
+	members, err := p.findBundleIDs(bundle.ResourceIDs)
+	if err != nil {
+		return nil, err
+	}
+	if dur <= 0 {
+		dur = hold.Desired
+	}
+	for _, m := range members {
+		if err := p.limitsFor(m).checkBooking(dur); err != nil {
+			return nil, &BundleError{Resource: m, Err: err}
+		}
+	}
+	if err := p.checkQuota(bundle.UserID, members, dur); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var out *Booking
+	for _, m := range members {
+		b, err := p.store.UpdateBooking(m.ID, bundle.UserID, func(b *Booking) error {
+			if !b.Hold || b.BundleID != bundle.ID {
+				return ErrNotBooked
+			}
+			if purpose != "" {
+				b.Purpose = purpose
+			}
+			b.Hold, b.Desired = false, 0
+			b.StartedAt, b.ExpiresAt = now, now.Add(dur)
+			return nil
+		})
+		if err != nil {
+			p.rollbackBundle(bundle, members)
+			for _, m := range members {
+				p.processQueue(m.ID, m.Name)
+			}
+			return nil, err
+		}
+		if m.ID == res.ID {
+			out = b
+		}
+	}
+	names := resourceNames(members)
+	for _, m := range members {
+		p.store.RemoveFromQueue(m.ID, bundle.UserID)
+		p.notifySubscribers(m.ID, fmt.Sprintf("🔒 **%s** занят @%s на %s (комплект: %s)",
+			m.Name, p.username(bundle.UserID), formatDuration(dur), names), bundle.UserID)
+	}
+	return out, nil
+}
+
+// dropBundleHold gives up the holds left of bundle and offers each seat to
+// the next in line.
+func (p *Plugin) dropBundleHold(bundle *Bundle) {
+	for _, id := range bundle.ResourceIDs {
+		_, err := p.store.TakeBooking(id, bundle.UserID, func(b *Booking) error {
+			if !b.Hold || b.BundleID != bundle.ID {
+				return ErrNotBooked
+			}
+			return nil
+		})
+		if err != nil {
+			continue
+		}
+		name := id
+		if res, _ := p.store.GetResource(id); res != nil {
+			name = res.Name
+		}
+		p.processQueue(id, name)
+	}
+	p.store.DeleteBundle(bundle.ID)
+}
+
+// sameMembers reports whether ids lists exactly the resources of members.
+func sameMembers(ids []string, members []*Resource) bool {
+	if len(ids) != len(members) {
+		return false
+	}
+	for _, m := range members {
+		if !containsString(ids, m.ID) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Plugin) allFree(members []*Resource) bool {
+	for _, res := range members {
+		if !p.hasFreeSeat(res) {
+			return false
+		}
+	}
+	return true
+}
+
+// bundleErrText renders a failed bundle booking for chat responses.
+func (p *Plugin) bundleErrText(err error) string {
+	if text := quotaErrText(err); text != "" {
+		return text
+	}
+	var be *BundleError
+	if errors.As(err, &be) {
+		if errors.Is(be.Err, ErrHolding) {
+			return fmt.Sprintf("Вы уже занимаете **%s** — комплект не забронирован", be.Resource.Name)
+		}
+		return p.bookErrText(be.Resource, be.Err) + " — комплект не забронирован"
+	}
+	return "Ошибка: " + err.Error()
+}
+
+func resourceNames(members []*Resource) string {
+	names := make([]string, len(members))
+	for i, m := range members {
+		names[i] = m.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// memberRefs returns names usable in commands, falling back to IDs for
+// names with spaces or commas.
+func memberRefs(members []*Resource) []string {
+	refs := make([]string, len(members))
+	for i, m := range members {
+		refs[i] = m.Name
+		if strings.ContainsAny(m.Name, " ,") {
+			refs[i] = m.ID
+		}
+	}
+	return refs
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
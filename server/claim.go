@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// When a seat frees up, the head of the queue gets an exclusive hold for the
+// claim window instead of a bare "it's free" DM that anyone could beat them
+// to. A hold is a Booking with Hold set: it occupies the seat, so others get
+// ErrBusy, and the scheduler expires it like any booking. Claiming turns it
+// into a real booking; passing or letting it expire offers the seat to the
+// next in line. Resources with the HandoffAuto policy skip the claim step:
+// the queue head is booked straight away for the duration they asked for,
+// or dropped from the queue if that would break their quota.
+
+// maxHoldAttempts bounds how many queue heads offerHold skips over when they
+// turn out to hold the resource already.
+const maxHoldAttempts = 5
+
+// errHoldExpired is returned by button handlers when the claim window is over.
+var errHoldExpired = errors.New("hold expired")
+
+// offerHold hands the freed seat of res to the next in line: a claim-window
+// hold with Claim/Pass buttons, or a booking outright under HandoffAuto.
+// Entries leave the queue only once their hold or booking exists, so a seat
+// sniped between release and offer keeps the queue intact.
+func (p *Plugin) offerHold(res *Resource) {
+	if inMaintenance(res) {
+		return // the queue waits for the end of maintenance
+	}
+	window := time.Duration(p.cfgClaimMinutes()) * time.Minute
+	for i := 0; i < maxHoldAttempts; i++ {
+		entry, queueID := p.peekNextInLine(res)
+		if entry == nil {
+			return
+		}
+		now := time.Now()
+		hold := &Booking{
+			ResourceID: res.ID, UserID: entry.UserID, Purpose: entry.Purpose,
+			StartedAt: now, ExpiresAt: now.Add(window),
+			Hold: true, Desired: entry.DesiredDuration,
+		}
+		if res.Handoff == HandoffAuto {
+			dur := p.handoffDuration(res, entry.DesiredDuration)
+			if err := p.checkQuota(entry.UserID, []*Resource{res}, dur); err != nil {
+				if !errors.Is(err, errQuota) {
+					return
+				}
+				p.store.RemoveFromQueue(queueID, entry.UserID)
+				p.sendDM(entry.UserID, fmt.Sprintf("Ваша очередь на **%s** подошла, но бронь не создана — вы удалены из очереди.\n%s",
+					res.Name, quotaErrText(err)))
+				continue
+			}
+			hold = &Booking{
+				ResourceID: res.ID, UserID: entry.UserID, Purpose: entry.Purpose,
+				StartedAt: now, ExpiresAt: now.Add(dur),
+				Handoff: true,
+			}
+		}
+		err := p.store.CreateBooking(hold, res.Seats())
+		if errors.Is(err, ErrHolding) {
+			p.store.RemoveFromQueue(queueID, entry.UserID)
+			continue
+		}
+		if err != nil {
+			return // no free seat after all; the queue stays as it is
+		}
+		p.store.RemoveFromQueue(queueID, entry.UserID)
+		if hold.Handoff {
+			p.completeHandoff(res, hold)
+			return
+		}
+		p.sendHoldOffer(res, hold, queueID != res.ID)
+		return
+	}
+}
+
+func (p *Plugin) sendHoldOffer(res *Resource, hold *Booking, fromPool bool) {
+	text := fmt.Sprintf("🎉 **%s** свободен! Вы следующий в очереди — ресурс придержан для вас до %s.",
+		res.Name, hold.ExpiresAt.Format("15:04"))
+	if fromPool {
+		text = fmt.Sprintf("🎉 **%s** из пула `%s` свободен! Вы следующий в очереди — ресурс придержан для вас до %s.",
+			res.Name, res.Pool, hold.ExpiresAt.Format("15:04"))
+	}
+	ctx := map[string]interface{}{"resource_id": res.ID}
+	post := &model.Post{}
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{{
+		Text: text,
+		Actions: []*model.PostAction{
+			{
+				Id: "claim", Name: fmt.Sprintf("✅ Занять на %s", formatDuration(hold.Desired)), Type: "button",
+				Integration: &model.PostActionIntegration{URL: actionURL("claim"), Context: ctx},
+			},
+			{
+				Id: "pass", Name: "⏭ Пропустить", Type: "button",
+				Integration: &model.PostActionIntegration{URL: actionURL("pass"), Context: ctx},
+			},
+		},
+	}})
+	p.sendDMPost(hold.UserID, post)
+}
+
+// handoffDuration clamps the duration asked for in the queue to the
+// resource's limits.
+func (p *Plugin) handoffDuration(res *Resource, d time.Duration) time.Duration {
+	l := p.limitsFor(res)
+	if d > l.MaxBooking {
+		return l.MaxBooking
+	}
+	if d <= 0 {
+		return l.Default
+	}
+	return d
+}
+
+// completeHandoff finishes an automatic handoff: the user leaves every queue
+// for the resource, subscribers are told and the new holder gets a DM with
+// Release/Extend buttons.
+func (p *Plugin) completeHandoff(res *Resource, b *Booking) {
+	p.store.RemoveFromQueue(res.ID, b.UserID)
+	if res.Pool != "" {
+		p.store.RemoveFromQueue(poolQueueID(res.Pool), b.UserID)
+	}
+	dur := b.ExpiresAt.Sub(b.StartedAt)
+	p.notifySubscribers(res.ID, fmt.Sprintf("🔁 **%s** передан из очереди @%s на %s%s",
+		res.Name, p.username(b.UserID), formatDuration(dur), p.seatsNote(res)), b.UserID)
+
+	ctx := map[string]interface{}{"resource_id": res.ID}
+	extendCtx := map[string]interface{}{"resource_id": res.ID, "minutes": 60}
+	post := &model.Post{}
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{{
+		Text: fmt.Sprintf("🔁 Ваша очередь подошла: **%s** забронирован за вами на %s (до %s).",
+			res.Name, formatDuration(dur), b.ExpiresAt.Format("15:04")) +
+			p.reservationWarning(res, b.UserID, b.ExpiresAt),
+		Actions: []*model.PostAction{
+			{
+				Id: "release", Name: "🔓 Освободить", Type: "button",
+				Integration: &model.PostActionIntegration{URL: actionURL("release"), Context: ctx},
+			},
+			{
+				Id: "extend", Name: "⏳ +1ч", Type: "button",
+				Integration: &model.PostActionIntegration{URL: actionURL("extend"), Context: extendCtx},
+			},
+		},
+	}})
+	p.sendDMPost(b.UserID, post)
+}
+
+// claimHold turns userID's hold into a booking lasting dur (the duration
+// asked for in the queue if dur is 0), within the user's quotas; a hold on a
+// bundle member claims the whole set. Returns
+// ErrNotBooked without a booking and ErrHolding if it is already a real one.
+func (p *Plugin) claimHold(res *Resource, userID string, dur time.Duration, purpose string) (*Booking, error) {
+	if own, _ := p.store.GetUserBooking(res.ID, userID); own != nil && own.Hold {
+		if own.BundleID != "" {
+			return p.claimBundleHold(res, own, dur, purpose)
+		}
+		want := dur
+		if want <= 0 {
+			want = own.Desired
+		}
+		if err := p.checkQuota(userID, []*Resource{res}, want); err != nil {
+			return nil, err
+		}
+	}
+	b, err := p.store.UpdateBooking(res.ID, userID, func(b *Booking) error {
+		if !b.Hold {
+			return ErrHolding
+		}
+		if dur <= 0 {
+			dur = b.Desired
+		}
+		if purpose != "" {
+			b.Purpose = purpose
+		}
+		now := time.Now()
+		b.Hold = false
+		b.Desired = 0
+		b.StartedAt = now
+		b.ExpiresAt = now.Add(dur)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.store.RemoveFromQueue(res.ID, userID)
+	if res.Pool != "" {
+		p.store.RemoveFromQueue(poolQueueID(res.Pool), userID)
+	}
+	p.notifySubscribers(res.ID, fmt.Sprintf("🔒 **%s** занят @%s на %s%s", res.Name, p.username(userID), formatDuration(dur), p.seatsNote(res)), userID)
+	return b, nil
+}
+
+// passHold gives up userID's hold, with the rest of the set for a bundle
+// member, and offers the seat to the next in line.
+func (p *Plugin) passHold(res *Resource, userID string) error {
+	hold, err := p.store.TakeBooking(res.ID, userID, func(b *Booking) error {
+		if !b.Hold || b.IsExpired() {
+			return ErrNotBooked
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if hold.BundleID != "" {
+		if bundle, _ := p.store.GetBundle(hold.BundleID); bundle != nil {
+			p.dropBundleHold(bundle)
+		}
+	}
+	p.processQueue(res.ID, res.Name)
+	return nil
+}
+
+// holdOf returns the hold among bookings, if any.
+func holdOf(bookings []Booking) *Booking {
+	for i := range bookings {
+		if bookings[i].Hold {
+			return &bookings[i]
+		}
+	}
+	return nil
+}
+
+// holderLabel renders who occupies a seat: the holder with time left, or
+// whom a hold is waiting for.
+func (p *Plugin) holderLabel(b Booking) string {
+	if b.Hold {
+		return fmt.Sprintf("⏳ придержан для %s до %s", p.displayName(b.UserID), b.ExpiresAt.Format("15:04"))
+	}
+	return fmt.Sprintf("🔴 %s ⏱%s", p.displayName(b.UserID), formatTimeLeft(time.Until(b.ExpiresAt)))
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -14,7 +16,7 @@ func (p *Plugin) registerCommands() error {
 	return p.API.RegisterCommand(&model.Command{
 		Trigger:          "rq",
 		AutoComplete:     true,
-		AutoCompleteHint: "[list|book|release|extend|queue|leave|subscribe|history|help]",
+		AutoCompleteHint: "[list|book|release|transfer|preempt|extend|queue|leave|reserve|recur|subscribe|history|quota|priority|approval|access|admin|maintenance|groups|group|board|help]",
 		AutoCompleteDesc: "Управление общими ресурсами",
 	})
 }
@@ -29,25 +31,55 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 
 	switch sub {
 	case "list", "ls", "l":
-		return p.cmdList()
+		return p.cmdList(args.UserId, rest)
 	case "status", "st", "s":
-		return p.cmdStatus(rest)
+		return p.cmdStatus(args.UserId, rest)
 	case "book", "b":
 		return p.cmdBook(args.UserId, rest)
 	case "release", "free", "r":
 		return p.cmdRelease(args.UserId, rest)
+	case "preempt":
+		return p.cmdPreempt(args.UserId, rest)
+	case "transfer", "give":
+		return p.cmdTransfer(args.UserId, rest)
 	case "extend", "e":
 		return p.cmdExtend(args.UserId, rest)
 	case "queue", "q":
 		return p.cmdQueue(args.UserId, rest)
 	case "leave":
 		return p.cmdLeave(args.UserId, rest)
+	case "reserve", "rs":
+		return p.cmdReserve(args.UserId, rest)
+	case "reservations", "rsv":
+		return p.cmdReservations(args.UserId, rest)
+	case "unreserve":
+		return p.cmdUnreserve(args.UserId, rest)
+	case "recur", "recurring":
+		return p.cmdRecur(args.UserId, splitQuoted(strings.Join(rest, " ")))
 	case "subscribe", "sub", "watch":
 		return p.cmdSubscribe(args.UserId, rest)
 	case "unsubscribe", "unsub", "unwatch":
 		return p.cmdUnsubscribe(args.UserId, rest)
 	case "history", "hist":
-		return p.cmdHistory(rest)
+		return p.cmdHistory(args.UserId, rest)
+	case "quota", "quotas":
+		return p.cmdQuota(args.UserId)
+	case "priority", "prio":
+		return p.cmdPriority(args.UserId, rest)
+	case "approval", "approvers":
+		return p.cmdApproval(args.UserId, rest)
+	case "access", "acl":
+		return p.cmdAccess(args.UserId, rest)
+	case "admin", "managers":
+		return p.cmdAdmin(args.UserId, rest)
+	case "maintenance", "maint":
+		return p.cmdMaintenance(args.UserId, rest)
+	case "groups":
+		return p.cmdGroups(args.UserId)
+	case "group", "grp":
+		return p.cmdGroup(args.UserId, splitQuoted(strings.Join(rest, " ")))
+	case "board":
+		return p.cmdBoard(args.UserId, args.ChannelId, rest)
 	default:
 		return p.cmdHelp(), nil
 	}
@@ -59,125 +91,215 @@ func eph(text string) *model.CommandResponse {
 
 // --- List ---
 
-func (p *Plugin) cmdList() (*model.CommandResponse, *model.AppError) {
-	resources, err := p.store.GetAllResources()
+func (p *Plugin) cmdList(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	filter, ok := parseFilterArgs(args)
+	if !ok {
+		return eph("Использование: `/rq list [tag:<тег>…] [in:<группа>] [free]`"), nil
+	}
+	resources, err := p.visibleResources(userID)
 	if err != nil {
 		return eph("Ошибка: " + err.Error()), nil
 	}
 	if len(resources) == 0 {
 		return eph("Ресурсы не настроены. Администратор может добавить их через GUI (кнопка 🖥️)."), nil
 	}
+	if resources = p.filterResources(resources, filter); len(resources) == 0 {
+		return eph("Нет ресурсов по фильтру " + describeFilter(filter)), nil
+	}
 
+	groups, _ := p.store.GetGroups()
 	attachments := make([]*model.SlackAttachment, 0, len(resources))
-	for _, r := range resources {
-		icon := r.Icon
-		if icon == "" {
-			icon = "🖥️"
+	for _, sec := range groupSections(groups, resources) {
+		if sec.Group != nil {
+			attachments = append(attachments, &model.SlackAttachment{Text: groupHeading(sec)})
 		}
+		for _, r := range sec.Resources {
+			attachments = append(attachments, p.listAttachment(r))
+		}
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeEphemeral,
+		Attachments:  attachments,
+	}, nil
+}
 
-		booking, _ := p.store.GetBooking(r.ID)
-		entries, _ := p.store.GetQueueEntries(r.ID)
+// listAttachment renders one /rq list row with its quick-action buttons.
+func (p *Plugin) listAttachment(r *Resource) *model.SlackAttachment {
+	bookings, _ := p.store.GetBookings(r.ID)
+	entries, _ := p.store.GetQueueEntries(r.ID)
+	return p.listRow(r, bookings, entries)
+}
 
-		var line, color string
-		if booking != nil {
-			left := time.Until(booking.ExpiresAt)
-			parts := []string{
-				fmt.Sprintf("%s **%s**", icon, r.Name),
-			}
-			if r.IP != "" {
-				parts = append(parts, fmt.Sprintf("`%s`", r.IP))
-			}
-			parts = append(parts, fmt.Sprintf("🔴 @%s ⏱%s", p.username(booking.UserID), formatTimeLeft(left)))
-			if booking.Purpose != "" {
-				parts = append(parts, fmt.Sprintf("_%s_", booking.Purpose))
-			}
-			if len(entries) > 0 {
-				parts = append(parts, fmt.Sprintf("👥%d", len(entries)))
+// listRow is listAttachment for bookings and a queue already at hand.
+func (p *Plugin) listRow(r *Resource, bookings []Booking, entries []QueueEntry) *model.SlackAttachment {
+	icon := r.Icon
+	if icon == "" {
+		icon = "🖥️"
+	}
+	seats := r.Seats()
+
+	parts := []string{fmt.Sprintf("%s **%s**", icon, r.Name)}
+	if r.IP != "" {
+		parts = append(parts, fmt.Sprintf("`%s`", r.IP))
+	}
+	if r.Pool != "" {
+		parts = append(parts, fmt.Sprintf("🧩`%s`", r.Pool))
+	}
+	if len(r.Tags) > 0 {
+		parts = append(parts, "🏷 "+strings.Join(r.Tags, ", "))
+	}
+	var color string
+	switch {
+	case inMaintenance(r):
+		parts = append(parts, p.describeMaintenance(r))
+		color = "#757575"
+	case len(bookings) == 0:
+		parts = append(parts, "🟢 Свободен")
+		if seats > 1 {
+			parts = append(parts, fmt.Sprintf("0/%d мест", seats))
+		}
+		color = "#4caf50"
+	case seats == 1:
+		booking := bookings[0]
+		parts = append(parts, p.holderLabel(booking))
+		if booking.Purpose != "" {
+			parts = append(parts, fmt.Sprintf("_%s_", booking.Purpose))
+		}
+		color = "#e53935"
+		if booking.Hold {
+			color = "#ffa000"
+		}
+	default:
+		mark, holders := "🟡", make([]string, 0, len(bookings))
+		color = "#ffa000"
+		if len(bookings) >= seats {
+			mark, color = "🔴", "#e53935"
+		}
+		for _, b := range bookings {
+			if b.Hold {
+				holders = append(holders, "⏳"+p.displayName(b.UserID))
+				continue
 			}
-			line = strings.Join(parts, " · ")
-			color = "#e53935"
-		} else {
-			parts := []string{fmt.Sprintf("%s **%s**", icon, r.Name)}
-			if r.IP != "" {
-				parts = append(parts, fmt.Sprintf("`%s`", r.IP))
-			}
-			parts = append(parts, "🟢 Свободен")
-			line = strings.Join(parts, " · ")
-			color = "#4caf50"
-		}
-
-		var actions []*model.PostAction
-		if booking == nil {
-			actions = []*model.PostAction{
-				{
-					Id: "b10_" + r.ID, Name: "⚡10м", Type: "button",
-					Integration: &model.PostActionIntegration{
-						URL:     actionURL("book"),
-						Context: map[string]interface{}{"resource_id": r.ID, "minutes": 10},
-					},
+			holders = append(holders, p.displayName(b.UserID))
+		}
+		parts = append(parts, fmt.Sprintf("%s %d/%d мест: %s", mark, len(bookings), seats, strings.Join(holders, ", ")))
+	}
+	if (len(bookings) > 0 || inMaintenance(r)) && len(entries) > 0 {
+		parts = append(parts, fmt.Sprintf("👥%d", len(entries)))
+	}
+	line := strings.Join(parts, " · ")
+
+	var actions []*model.PostAction
+	short, long := p.limitsFor(r).quickMinutes()
+	switch {
+	case short == 0 || inMaintenance(r):
+		// no one-click duration fits the resource's policy, or it is out of service
+	case len(bookings) < seats:
+		actions = []*model.PostAction{
+			{
+				Id: fmt.Sprintf("b%d_%s", short, r.ID), Name: "⚡" + shortDuration(short), Type: "button",
+				Integration: &model.PostActionIntegration{
+					URL:     actionURL("book"),
+					Context: map[string]interface{}{"resource_id": r.ID, "minutes": short},
 				},
-				{
-					Id: "b60_" + r.ID, Name: "🔒1ч", Type: "button",
-					Integration: &model.PostActionIntegration{
-						URL:     actionURL("book"),
-						Context: map[string]interface{}{"resource_id": r.ID, "minutes": 60},
-					},
+			},
+		}
+		if long != short {
+			actions = append(actions, &model.PostAction{
+				Id: fmt.Sprintf("b%d_%s", long, r.ID), Name: "🔒" + shortDuration(long), Type: "button",
+				Integration: &model.PostActionIntegration{
+					URL:     actionURL("book"),
+					Context: map[string]interface{}{"resource_id": r.ID, "minutes": long},
 				},
-			}
-		} else {
-			actions = []*model.PostAction{
-				{
-					Id: "q60_" + r.ID, Name: "📋Очередь 1ч", Type: "button",
-					Integration: &model.PostActionIntegration{
-						URL:     actionURL("queue"),
-						Context: map[string]interface{}{"resource_id": r.ID, "minutes": 60},
-					},
+			})
+		}
+	default:
+		actions = []*model.PostAction{
+			{
+				Id: fmt.Sprintf("q%d_%s", long, r.ID), Name: "📋Очередь " + shortDuration(long), Type: "button",
+				Integration: &model.PostActionIntegration{
+					URL:     actionURL("queue"),
+					Context: map[string]interface{}{"resource_id": r.ID, "minutes": long},
 				},
-			}
+			},
 		}
-
-		attachments = append(attachments, &model.SlackAttachment{
-			Text: line, Color: color, Actions: actions,
-		})
 	}
 
-	return &model.CommandResponse{
-		ResponseType: model.CommandResponseTypeEphemeral,
-		Attachments:  attachments,
-	}, nil
+	return &model.SlackAttachment{Text: line, Color: color, Actions: actions}
+}
+
+// shortDuration renders minutes for button labels: "10м", "1ч", "1ч30м".
+func shortDuration(minutes int) string {
+	h, m := minutes/60, minutes%60
+	switch {
+	case h == 0:
+		return fmt.Sprintf("%dм", m)
+	case m == 0:
+		return fmt.Sprintf("%dч", h)
+	}
+	return fmt.Sprintf("%dч%dм", h, m)
 }
 
 // --- Status ---
 
-func (p *Plugin) cmdStatus(args []string) (*model.CommandResponse, *model.AppError) {
-	if len(args) == 0 {
-		resources, err := p.store.GetAllResources()
+func (p *Plugin) cmdStatus(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	if filter, ok := parseFilterArgs(args); ok {
+		resources, err := p.visibleResources(userID)
 		if err != nil {
 			return eph("Ошибка: " + err.Error()), nil
 		}
+		if resources = p.filterResources(resources, filter); len(resources) == 0 && !filter.empty() {
+			return eph("Нет ресурсов по фильтру " + describeFilter(filter)), nil
+		}
 		var sb strings.Builder
+		groups, _ := p.store.GetGroups()
+		for _, sec := range groupSections(groups, resources) {
+			if sec.Group != nil {
+				sb.WriteString("\n" + groupHeading(sec) + "\n")
+			}
+			for _, r := range sec.Resources {
+				sb.WriteString(p.statusLine(r))
+			}
+		}
+		pools := map[string][2]int{}
+		var poolNames []string
 		for _, r := range resources {
-			booking, _ := p.store.GetBooking(r.ID)
-			icon := r.Icon
-			if icon == "" {
-				icon = "🖥️"
+			if r.Pool == "" {
+				continue
 			}
-			if booking != nil {
-				left := time.Until(booking.ExpiresAt)
-				sb.WriteString(fmt.Sprintf("%s **%s** — 🔴 @%s ⏱%s\n", icon, r.Name, p.username(booking.UserID), formatTimeLeft(left)))
-			} else {
-				sb.WriteString(fmt.Sprintf("%s **%s** — 🟢 Свободен\n", icon, r.Name))
+			c, seen := pools[r.Pool]
+			if !seen {
+				poolNames = append(poolNames, r.Pool)
+			}
+			if p.hasFreeSeat(r) {
+				c[0]++
+			}
+			c[1]++
+			pools[r.Pool] = c
+		}
+		sort.Strings(poolNames)
+		for _, name := range poolNames {
+			entries, _ := p.store.GetQueueEntries(poolQueueID(name))
+			sb.WriteString(fmt.Sprintf("🧩 Пул `%s` — свободно %d/%d", name, pools[name][0], pools[name][1]))
+			if len(entries) > 0 {
+				sb.WriteString(fmt.Sprintf(" · 👥%d", len(entries)))
 			}
+			sb.WriteString("\n")
 		}
 		return eph(sb.String()), nil
 	}
 
-	res, err := p.findResource(strings.Join(args, " "))
+	if isPoolRef(args[0]) {
+		return p.cmdStatusPool(userID, args[0])
+	}
+
+	res, err := p.findResource(userID, strings.Join(args, " "))
 	if err != nil {
 		return eph(err.Error()), nil
 	}
 
-	booking, _ := p.store.GetBooking(res.ID)
+	bookings, _ := p.store.GetBookings(res.ID)
 	entries, _ := p.store.GetQueueEntries(res.ID)
 	subs, _ := p.store.GetSubscribers(res.ID)
 
@@ -193,37 +315,225 @@ func (p *Plugin) cmdStatus(args []string) (*model.CommandResponse, *model.AppErr
 	if res.Description != "" {
 		sb.WriteString(fmt.Sprintf("%s\n", res.Description))
 	}
-	if booking != nil {
+	if len(res.Tags) > 0 {
+		sb.WriteString("**Теги:** 🏷 " + strings.Join(res.Tags, ", ") + "\n")
+	}
+	if res.GroupID != "" {
+		if groups, _ := p.store.GetGroups(); groupByID(groups, res.GroupID) != nil {
+			sb.WriteString("**Группа:** 📁 " + groupPath(groups, res.GroupID) + "\n")
+		}
+	}
+	if res.Handoff == HandoffAuto {
+		sb.WriteString("**Очередь:** 🔁 автоматическая передача первому в очереди\n")
+	}
+	if lim := p.describeLimits(res); lim != "" {
+		sb.WriteString("**Лимиты:** " + lim + "\n")
+	}
+	if res.Approval != nil {
+		sb.WriteString(fmt.Sprintf("**Согласование:** 🔐 бронь после одобрения (`/rq approval %s`)\n", res.Name))
+	}
+	if acl := p.describeAccess(res); acl != "" {
+		sb.WriteString("**Доступ:** 🔒 " + acl + "\n")
+	}
+	if who := p.describeManagers(res.Managers); who != "" {
+		sb.WriteString("**Менеджеры:** " + who + "\n")
+	}
+	if res.Maintenance != nil && !inMaintenance(res) {
+		sb.WriteString("**Обслуживание:** " + p.describeMaintenance(res) + "\n")
+	}
+	switch {
+	case inMaintenance(res):
+		sb.WriteString("**Статус:** " + p.describeMaintenance(res) + "\n")
+	case len(bookings) == 0:
+		sb.WriteString("**Статус:** 🟢 Свободен" + p.seatsNote(res) + "\n")
+	case res.Seats() == 1 && bookings[0].Hold:
+		sb.WriteString(fmt.Sprintf("**Статус:** %s\n", p.holderLabel(bookings[0])))
+	case res.Seats() == 1:
+		booking := bookings[0]
 		left := time.Until(booking.ExpiresAt)
-		sb.WriteString(fmt.Sprintf("**Статус:** 🔴 Занят @%s (⏱ %s)\n", p.username(booking.UserID), formatTimeLeft(left)))
+		sb.WriteString(fmt.Sprintf("**Статус:** 🔴 Занят %s (⏱ %s)\n", p.displayName(booking.UserID), formatTimeLeft(left)))
 		if booking.Purpose != "" {
 			sb.WriteString(fmt.Sprintf("**Цель:** %s\n", booking.Purpose))
 		}
-	} else {
-		sb.WriteString("**Статус:** 🟢 Свободен\n")
+		if booking.BookedBy != "" {
+			sb.WriteString(fmt.Sprintf("**Оформил:** %s\n", p.displayName(booking.BookedBy)))
+		}
+	default:
+		mark := "🟡"
+		if len(bookings) >= res.Seats() {
+			mark = "🔴"
+		}
+		sb.WriteString(fmt.Sprintf("**Статус:** %s Занято %d/%d мест\n", mark, len(bookings), res.Seats()))
+		for _, b := range bookings {
+			if b.Hold {
+				sb.WriteString(fmt.Sprintf("  • %s\n", p.holderLabel(b)))
+				continue
+			}
+			sb.WriteString(fmt.Sprintf("  • %s (⏱ %s)", p.displayName(b.UserID), formatTimeLeft(time.Until(b.ExpiresAt))))
+			if b.Purpose != "" {
+				sb.WriteString(fmt.Sprintf(" — %s", b.Purpose))
+			}
+			sb.WriteString("\n")
+		}
 	}
 	if len(entries) > 0 {
 		sb.WriteString(fmt.Sprintf("**Очередь:** %d\n", len(entries)))
 		for i, e := range entries {
-			sb.WriteString(fmt.Sprintf("  %d. @%s", i+1, p.username(e.UserID)))
+			sb.WriteString(fmt.Sprintf("  %d. %s", i+1, p.displayName(e.UserID)))
+			if e.Priority > PriorityNormal {
+				sb.WriteString(" " + priorityLabel(e.Priority))
+			}
 			if e.Purpose != "" {
 				sb.WriteString(fmt.Sprintf(" — %s", e.Purpose))
 			}
 			sb.WriteString("\n")
 		}
 	}
+	if rsvs, _ := p.store.GetReservations(res.ID); len(rsvs) > 0 {
+		sb.WriteString(fmt.Sprintf("**Резервирования:** %d\n", len(rsvs)))
+		for i, r := range rsvs {
+			if i == 5 {
+				sb.WriteString("  …\n")
+				break
+			}
+			sb.WriteString(fmt.Sprintf("  %s–%s %s\n",
+				r.StartsAt.Format("02.01 15:04"), r.EndsAt.Format("15:04"), p.displayName(r.UserID)))
+		}
+	}
 	sb.WriteString(fmt.Sprintf("**Подписчики:** %d\n", len(subs)))
 
 	return eph(sb.String()), nil
 }
 
+// statusLine renders one line of the /rq status overview.
+func (p *Plugin) statusLine(r *Resource) string {
+	bookings, _ := p.store.GetBookings(r.ID)
+	icon := r.Icon
+	if icon == "" {
+		icon = "🖥️"
+	}
+	switch {
+	case inMaintenance(r):
+		return fmt.Sprintf("%s **%s** — %s\n", icon, r.Name, p.describeMaintenance(r))
+	case len(bookings) == 0:
+		return fmt.Sprintf("%s **%s** — 🟢 Свободен%s\n", icon, r.Name, p.seatsNote(r))
+	case r.Seats() == 1:
+		return fmt.Sprintf("%s **%s** — %s\n", icon, r.Name, p.holderLabel(bookings[0]))
+	case len(bookings) < r.Seats():
+		return fmt.Sprintf("%s **%s** — 🟡 занято %d/%d мест\n", icon, r.Name, len(bookings), r.Seats())
+	}
+	return fmt.Sprintf("%s **%s** — 🔴 занято %d/%d мест, ближайшее через ⏱%s\n",
+		icon, r.Name, len(bookings), r.Seats(), formatTimeLeft(time.Until(earliestExpiry(bookings))))
+}
+
+func (p *Plugin) cmdStatusPool(userID, ref string) (*model.CommandResponse, *model.AppError) {
+	pool, members, err := p.findPool(userID, ref)
+	if err != nil {
+		return eph(err.Error()), nil
+	}
+	var sb strings.Builder
+	free := 0
+	for _, m := range members {
+		bookings, _ := p.store.GetBookings(m.ID)
+		switch {
+		case len(bookings) < m.Seats():
+			free++
+			sb.WriteString(fmt.Sprintf("  🟢 **%s**%s\n", m.Name, p.seatsNote(m)))
+		case m.Seats() == 1:
+			b := bookings[0]
+			sb.WriteString(fmt.Sprintf("  **%s** %s\n", m.Name, p.holderLabel(b)))
+		default:
+			sb.WriteString(fmt.Sprintf("  🔴 **%s**%s ⏱%s\n", m.Name, p.seatsNote(m), formatTimeLeft(time.Until(earliestExpiry(bookings)))))
+		}
+	}
+	head := fmt.Sprintf("### 🧩 Пул %s\n**Свободно:** %d/%d\n", pool, free, len(members))
+	entries, _ := p.store.GetQueueEntries(poolQueueID(pool))
+	if len(entries) > 0 {
+		sb.WriteString(fmt.Sprintf("**Очередь:** %d\n", len(entries)))
+		for i, e := range entries {
+			sb.WriteString(fmt.Sprintf("  %d. %s %s\n", i+1, p.displayName(e.UserID), priorityLabel(e.Priority)))
+		}
+	}
+	return eph(head + sb.String()), nil
+}
+
 // --- Book ---
 
 func (p *Plugin) cmdBook(userID string, args []string) (*model.CommandResponse, *model.AppError) {
-	if len(args) < 2 {
-		return eph("Использование: `/rq book <имя> <время> [цель]`"), nil
+	args, forName := splitForArg(args)
+	if len(args) < 1 {
+		return eph("Использование: `/rq book <имя|pool:пул|имя1,имя2,…> [время] [for @user] [цель]`"), nil
+	}
+	if len(args) < 2 && (isBundleRef(args[0]) || isPoolRef(args[0])) {
+		return eph("Использование: `/rq book <имя|pool:пул|имя1,имя2,…> <время> [цель]`"), nil
+	}
+	if forName != "" && (isBundleRef(args[0]) || isPoolRef(args[0])) {
+		return eph("`for @user` работает только для отдельного ресурса"), nil
+	}
+	if isBundleRef(args[0]) {
+		return p.cmdBookBundle(userID, args)
+	}
+	if isPoolRef(args[0]) {
+		return p.cmdBookPool(userID, args)
+	}
+	res, err := p.findResource(userID, args[0])
+	if err != nil {
+		return eph(err.Error()), nil
+	}
+	target := userID
+	if forName != "" {
+		u, appErr := p.API.GetUserByUsername(forName)
+		if appErr != nil {
+			return eph("Пользователь @" + forName + " не найден"), nil
+		}
+		target = u.Id
+	}
+	// Without a duration the resource's default is used.
+	dur := p.limitsFor(res).Default
+	if len(args) > 1 {
+		if dur, err = parseDuration(args[1]); err != nil {
+			return eph(err.Error()), nil
+		}
+	}
+	purpose := ""
+	if len(args) > 2 {
+		purpose = truncate(strings.Join(args[2:], " "), maxPurposeLen)
+	}
+	b, err := p.bookFor(res, userID, target, dur, purpose)
+	if errors.Is(err, errApprovalRequired) {
+		req, err := p.requestApproval(res, userID, dur, purpose)
+		if err != nil {
+			return eph(p.bookErrText(res, err)), nil
+		}
+		return eph(fmt.Sprintf("📨 **%s** требует согласования — запрос на %s отправлен (действует до %s). Бронь оформится, как только его одобрят",
+			res.Name, formatDuration(dur), req.ExpiresAt.Format("02.01 15:04"))), nil
+	}
+	if target != userID && errors.Is(err, ErrHolding) {
+		return eph(fmt.Sprintf("@%s уже занимает **%s**", forName, res.Name)), nil
+	}
+	if err != nil {
+		return eph(p.bookErrText(res, err)), nil
+	}
+	if target != userID {
+		return eph(fmt.Sprintf("✅ **%s** забронирован для @%s на %s (до %s)", res.Name, forName, formatDuration(dur), b.ExpiresAt.Format("15:04"))), nil
+	}
+	return eph(fmt.Sprintf("✅ **%s** забронирован на %s (до %s)", res.Name, formatDuration(dur), b.ExpiresAt.Format("15:04")) +
+		p.reservationWarning(res, userID, b.ExpiresAt)), nil
+}
+
+// splitForArg removes a "for @user" pair from args and returns the username.
+func splitForArg(args []string) ([]string, string) {
+	for i := 1; i+1 < len(args); i++ {
+		if strings.EqualFold(args[i], "for") && strings.HasPrefix(args[i+1], "@") {
+			rest := append(append([]string{}, args[:i]...), args[i+2:]...)
+			return rest, strings.TrimPrefix(args[i+1], "@")
+		}
 	}
-	res, err := p.findResource(args[0])
+	return args, ""
+}
+
+func (p *Plugin) cmdBookPool(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	pool, members, err := p.findPool(userID, args[0])
 	if err != nil {
 		return eph(err.Error()), nil
 	}
@@ -231,97 +541,196 @@ func (p *Plugin) cmdBook(userID string, args []string) (*model.CommandResponse,
 	if err != nil {
 		return eph(err.Error()), nil
 	}
-	maxMin := p.cfgMaxBookingHours() * 60
-	if int(dur.Minutes()) > maxMin {
-		return eph(fmt.Sprintf("Максимум %d часов", p.cfgMaxBookingHours())), nil
+	purpose := ""
+	if len(args) > 2 {
+		purpose = truncate(strings.Join(args[2:], " "), maxPurposeLen)
+	}
+	res, b, err := p.bookFromPool(members, userID, dur, purpose)
+	if errors.Is(err, errNoFreeMember) {
+		return eph(fmt.Sprintf("🔴 Все ресурсы пула `%s` заняты (%d). `/rq queue pool:%s <время>` — встать в общую очередь", pool, len(members), pool)), nil
 	}
-	existing, _ := p.store.GetBooking(res.ID)
-	if existing != nil {
-		return eph(fmt.Sprintf("🔴 **%s** занят @%s (⏱ %s)", res.Name, p.username(existing.UserID), formatTimeLeft(time.Until(existing.ExpiresAt)))), nil
+	if err != nil {
+		if res != nil {
+			return eph(p.bookErrText(res, err)), nil
+		}
+		return eph("Ошибка: " + err.Error()), nil
 	}
+	return eph(fmt.Sprintf("✅ **%s** из пула `%s` забронирован на %s (до %s)", res.Name, pool, formatDuration(dur), b.ExpiresAt.Format("15:04")) +
+		p.reservationWarning(res, userID, b.ExpiresAt)), nil
+}
 
+func (p *Plugin) cmdBookBundle(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	members, err := p.findBundle(userID, args[0])
+	if err != nil {
+		return eph(err.Error()), nil
+	}
+	dur, err := parseDuration(args[1])
+	if err != nil {
+		return eph(err.Error()), nil
+	}
 	purpose := ""
 	if len(args) > 2 {
 		purpose = truncate(strings.Join(args[2:], " "), maxPurposeLen)
 	}
-	b := &Booking{
-		ResourceID: res.ID, UserID: userID, Purpose: purpose,
-		StartedAt: time.Now(), ExpiresAt: time.Now().Add(dur),
+	bundle, err := p.bookBundle(members, userID, dur, purpose)
+	if err != nil {
+		ref := strings.Join(memberRefs(members), ",")
+		return eph(p.bundleErrText(err) + fmt.Sprintf("\n`/rq queue %s %s` — встать в очередь на весь комплект", ref, args[1])), nil
 	}
-	if err := p.store.SaveBooking(b); err != nil {
-		return eph("Ошибка: " + err.Error()), nil
+	var warn string
+	until := time.Now().Add(dur)
+	for _, res := range members {
+		warn += p.reservationWarning(res, userID, until)
 	}
-	p.store.RemoveFromQueue(res.ID, userID)
-	p.notifySubscribers(res.ID, fmt.Sprintf("🔒 **%s** занят @%s на %s", res.Name, p.username(userID), formatDuration(dur)), userID)
-	return eph(fmt.Sprintf("✅ **%s** забронирован на %s (до %s)", res.Name, formatDuration(dur), b.ExpiresAt.Format("15:04"))), nil
+	return eph(fmt.Sprintf("✅ Комплект **%s** забронирован на %s (до %s), ID `%s`",
+		resourceNames(members), formatDuration(dur), until.Format("15:04"), bundle.ID) + warn), nil
 }
 
 // --- Release ---
 
 func (p *Plugin) cmdRelease(userID string, args []string) (*model.CommandResponse, *model.AppError) {
 	if len(args) < 1 {
-		return eph("Использование: `/rq release <имя>`"), nil
+		return eph("Использование: `/rq release <имя> [@user]`"), nil
 	}
-	res, err := p.findResource(args[0])
+	res, err := p.findResource(userID, args[0])
 	if err != nil {
 		return eph(err.Error()), nil
 	}
-	booking, _ := p.store.GetBooking(res.ID)
-	if booking == nil {
-		return eph("**" + res.Name + "** не забронирован"), nil
+	target := ""
+	if len(args) > 1 {
+		u, appErr := p.API.GetUserByUsername(strings.TrimPrefix(args[1], "@"))
+		if appErr != nil {
+			return eph("Пользователь " + args[1] + " не найден"), nil
+		}
+		target = u.Id
+	}
+	booking, err := p.releaseResource(res, userID, target)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNotBooked):
+			return eph("**" + res.Name + "** не забронирован"), nil
+		case errors.Is(err, errNotHolder):
+			return eph("Только текущий пользователь или менеджер ресурса может освободить"), nil
+		}
+		return eph(p.bookErrText(res, err)), nil
+	}
+	if booking.BundleID != "" {
+		return eph(fmt.Sprintf("🔓 Комплект `%s` с **%s** освобождён целиком", booking.BundleID, res.Name)), nil
 	}
-	if booking.UserID != userID && !p.isAdmin(userID) {
-		return eph("Только текущий пользователь или админ может освободить"), nil
+	if booking.UserID != userID {
+		return eph(fmt.Sprintf("🔓 Место @%s на **%s** освобождено", p.username(booking.UserID), res.Name)), nil
 	}
-	p.store.AddHistory(HistoryEntry{
-		UserID: booking.UserID, ResourceID: res.ID, Purpose: booking.Purpose,
-		StartedAt: booking.StartedAt, EndedAt: time.Now(),
-	})
-	p.store.DeleteBooking(res.ID)
-	p.notifySubscribers(res.ID, fmt.Sprintf("🔓 **%s** освобождён", res.Name), "")
-	p.processQueue(res.ID, res.Name)
 	return eph(fmt.Sprintf("🔓 **%s** освобождён", res.Name)), nil
 }
 
+// --- Preempt ---
+
+func (p *Plugin) cmdPreempt(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	if len(args) < 2 {
+		return eph("Использование: `/rq preempt <имя> [@user] <причина>`"), nil
+	}
+	res, err := p.findResource(userID, args[0])
+	if err != nil {
+		return eph(err.Error()), nil
+	}
+	target, rest := "", args[1:]
+	if strings.HasPrefix(rest[0], "@") {
+		u, appErr := p.API.GetUserByUsername(strings.TrimPrefix(rest[0], "@"))
+		if appErr != nil {
+			return eph("Пользователь " + rest[0] + " не найден"), nil
+		}
+		target, rest = u.Id, rest[1:]
+	}
+	if len(rest) == 0 {
+		return eph("Укажите причину вытеснения"), nil
+	}
+	b, err := p.preemptBooking(res, userID, target, truncate(strings.Join(rest, " "), maxPurposeLen))
+	if err != nil {
+		if errors.Is(err, ErrNotBooked) {
+			return eph("**" + res.Name + "** не забронирован"), nil
+		}
+		return eph(p.bookErrText(res, err)), nil
+	}
+	if b.Hold {
+		return eph(fmt.Sprintf("⛔ Придержанное для @%s место на **%s** передано вам", p.username(b.UserID), res.Name)), nil
+	}
+	return eph(fmt.Sprintf("⛔ @%s предупреждён: **%s** перейдёт к вам в %s", p.username(b.UserID), res.Name, b.ExpiresAt.Format("15:04"))), nil
+}
+
+// --- Transfer ---
+
+func (p *Plugin) cmdTransfer(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	if len(args) < 2 {
+		return eph("Использование: `/rq transfer <имя> @user`"), nil
+	}
+	res, err := p.findResource(userID, args[0])
+	if err != nil {
+		return eph(err.Error()), nil
+	}
+	u, appErr := p.API.GetUserByUsername(strings.TrimPrefix(args[1], "@"))
+	if appErr != nil {
+		return eph("Пользователь " + args[1] + " не найден"), nil
+	}
+	if _, err := p.offerTransfer(res, userID, u.Id); err != nil {
+		switch {
+		case errors.Is(err, ErrNotBooked):
+			return eph("Вы не занимаете **" + res.Name + "**"), nil
+		case errors.Is(err, ErrHolding):
+			return eph(fmt.Sprintf("@%s уже занимает **%s**", u.Username, res.Name)), nil
+		}
+		return eph(p.bookErrText(res, err)), nil
+	}
+	return eph(fmt.Sprintf("🤝 @%s получил предложение принять **%s** — бронь остаётся за вами, пока он не согласится", u.Username, res.Name)), nil
+}
+
 // --- Extend ---
 
 func (p *Plugin) cmdExtend(userID string, args []string) (*model.CommandResponse, *model.AppError) {
 	if len(args) < 2 {
 		return eph("Использование: `/rq extend <имя> <время>`"), nil
 	}
-	res, err := p.findResource(args[0])
+	res, err := p.findResource(userID, args[0])
 	if err != nil {
 		return eph(err.Error()), nil
 	}
-	booking, _ := p.store.GetBooking(res.ID)
-	if booking == nil {
-		return eph("**" + res.Name + "** не забронирован"), nil
-	}
-	if booking.UserID != userID {
-		return eph("Только текущий пользователь может продлить"), nil
-	}
 	dur, err := parseDuration(args[1])
 	if err != nil {
 		return eph(err.Error()), nil
 	}
-	newExpiry := booking.ExpiresAt.Add(dur)
-	maxMin := p.cfgMaxBookingHours() * 60
-	if int(newExpiry.Sub(booking.StartedAt).Minutes()) > maxMin {
-		return eph(fmt.Sprintf("Суммарно превышает максимум %d часов", p.cfgMaxBookingHours())), nil
+	booking, err := p.extendBooking(res, userID, dur)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNotBooked):
+			return eph("**" + res.Name + "** не забронирован"), nil
+		case errors.Is(err, errNotHolder):
+			return eph("Только текущий пользователь может продлить"), nil
+		}
+		return eph(p.bookErrText(res, err)), nil
 	}
-	booking.ExpiresAt = newExpiry
-	booking.NotifiedSoon = false
-	p.store.SaveBooking(booking)
-	return eph(fmt.Sprintf("⏳ **%s** продлён на %s (до %s)", res.Name, formatDuration(dur), newExpiry.Format("15:04"))), nil
+	return eph(fmt.Sprintf("⏳ **%s** продлён на %s (до %s)", res.Name, formatDuration(dur), booking.ExpiresAt.Format("15:04")) +
+		p.reservationWarning(res, userID, booking.ExpiresAt)), nil
 }
 
 // --- Queue ---
 
 func (p *Plugin) cmdQueue(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	args, priority, err := splitPriorityArg(args)
+	if err != nil {
+		return eph(err.Error()), nil
+	}
 	if len(args) < 2 {
-		return eph("Использование: `/rq queue <имя> <время> [цель]`"), nil
+		return eph("Использование: `/rq queue <имя|pool:пул|имя1,имя2,…> <время> [priority=high|urgent] [цель]`"), nil
+	}
+	if isBundleRef(args[0]) && priority > PriorityNormal {
+		return eph("Приоритет для очереди на комплект не поддерживается"), nil
+	}
+	if isBundleRef(args[0]) {
+		return p.cmdQueueBundle(userID, args)
 	}
-	res, err := p.findResource(args[0])
+	if isPoolRef(args[0]) {
+		return p.cmdQueuePool(userID, args, priority)
+	}
+	res, err := p.findResource(userID, args[0])
 	if err != nil {
 		return eph(err.Error()), nil
 	}
@@ -329,8 +738,7 @@ func (p *Plugin) cmdQueue(userID string, args []string) (*model.CommandResponse,
 	if err != nil {
 		return eph(err.Error()), nil
 	}
-	booking, _ := p.store.GetBooking(res.ID)
-	if booking != nil && booking.UserID == userID {
+	if own, _ := p.store.GetUserBooking(res.ID, userID); own != nil {
 		return eph("Вы уже занимаете **" + res.Name + "**"), nil
 	}
 
@@ -338,77 +746,361 @@ func (p *Plugin) cmdQueue(userID string, args []string) (*model.CommandResponse,
 	if len(args) > 2 {
 		purpose = truncate(strings.Join(args[2:], " "), maxPurposeLen)
 	}
-	pos, err := p.store.AddToQueue(res.ID, QueueEntry{
-		UserID: userID, DesiredDuration: dur, Purpose: purpose, QueuedAt: time.Now(),
+	pos, err := p.joinQueue(res, QueueEntry{
+		UserID: userID, DesiredDuration: dur, Purpose: purpose, QueuedAt: time.Now(), Priority: priority,
 	})
 	if err != nil {
+		if text := p.limitErrText(res, err); text != "" {
+			return eph(text), nil
+		}
+		if text := p.priorityErrText(userID, err); text != "" {
+			return eph(text), nil
+		}
 		return eph("Ошибка: " + err.Error()), nil
 	}
-	if booking != nil && !booking.NotifiedQueue {
-		p.sendDM(booking.UserID, fmt.Sprintf("👋 @%s встал в очередь на **%s**", p.username(userID), res.Name))
-		booking.NotifiedQueue = true
-		p.store.SaveBooking(booking)
+	if !p.hasFreeSeat(res) {
+		p.notifyHolderQueued(res, userID)
 	}
-	return eph(fmt.Sprintf("✅ Вы в очереди на **%s** (позиция: %d)", res.Name, pos)), nil
+	return eph(queuedText("**"+res.Name+"**", pos, priority)), nil
 }
 
-// --- Leave ---
-
-func (p *Plugin) cmdLeave(userID string, args []string) (*model.CommandResponse, *model.AppError) {
-	if len(args) < 1 {
-		return eph("Использование: `/rq leave <имя>`"), nil
+func (p *Plugin) cmdQueuePool(userID string, args []string, priority int) (*model.CommandResponse, *model.AppError) {
+	pool, members, err := p.findPool(userID, args[0])
+	if err != nil {
+		return eph(err.Error()), nil
 	}
-	res, err := p.findResource(args[0])
+	dur, err := parseDuration(args[1])
 	if err != nil {
 		return eph(err.Error()), nil
 	}
-	p.store.RemoveFromQueue(res.ID, userID)
-	return eph(fmt.Sprintf("Вы покинули очередь на **%s**", res.Name)), nil
+	for _, m := range members {
+		if p.hasFreeSeat(m) {
+			return eph(fmt.Sprintf("**%s** из пула `%s` свободен — `/rq book pool:%s %s`", m.Name, pool, pool, args[1])), nil
+		}
+	}
+	purpose := ""
+	if len(args) > 2 {
+		purpose = truncate(strings.Join(args[2:], " "), maxPurposeLen)
+	}
+	pos, err := p.enqueue(poolQueueID(pool), "пул `"+pool+"`", QueueEntry{
+		UserID: userID, DesiredDuration: dur, Purpose: purpose, QueuedAt: time.Now(), Priority: priority,
+	}, maxQueueSize)
+	if err != nil {
+		if text := p.priorityErrText(userID, err); text != "" {
+			return eph(text), nil
+		}
+		return eph("Ошибка: " + err.Error()), nil
+	}
+	return eph(queuedText("общую очередь пула `"+pool+"`", pos, priority)), nil
 }
 
-// --- Subscribe/Unsubscribe ---
-
-func (p *Plugin) cmdSubscribe(userID string, args []string) (*model.CommandResponse, *model.AppError) {
-	if len(args) < 1 {
-		return eph("Использование: `/rq subscribe <имя>`"), nil
-	}
-	res, err := p.findResource(args[0])
+func (p *Plugin) cmdQueueBundle(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	members, err := p.findBundle(userID, args[0])
 	if err != nil {
 		return eph(err.Error()), nil
 	}
-	if err := p.store.Subscribe(res.ID, userID); err != nil {
+	dur, err := parseDuration(args[1])
+	if err != nil {
 		return eph(err.Error()), nil
 	}
-	return eph(fmt.Sprintf("🔔 Подписка на **%s** оформлена", res.Name)), nil
+	if p.allFree(members) {
+		return eph(fmt.Sprintf("Комплект **%s** свободен — `/rq book %s %s`", resourceNames(members), args[0], args[1])), nil
+	}
+	purpose := ""
+	if len(args) > 2 {
+		purpose = truncate(strings.Join(args[2:], " "), maxPurposeLen)
+	}
+	pos, err := p.queueBundle(members, userID, dur, purpose)
+	var be *BundleError
+	if errors.As(err, &be) {
+		return eph(p.bookErrText(be.Resource, be.Err)), nil
+	}
+	if err != nil {
+		return eph("Ошибка: " + err.Error()), nil
+	}
+	return eph(fmt.Sprintf("✅ Вы в очереди на комплект **%s** (позиция: %d)", resourceNames(members), pos)), nil
 }
 
-func (p *Plugin) cmdUnsubscribe(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+// --- Leave ---
+
+func (p *Plugin) cmdLeave(userID string, args []string) (*model.CommandResponse, *model.AppError) {
 	if len(args) < 1 {
-		return eph("Использование: `/rq unsubscribe <имя>`"), nil
+		return eph("Использование: `/rq leave <имя|pool:пул|имя1,имя2,…>`"), nil
+	}
+	if isBundleRef(args[0]) {
+		members, err := p.findBundle(userID, args[0])
+		if err != nil {
+			return eph(err.Error()), nil
+		}
+		ids := make([]string, len(members))
+		for i, m := range members {
+			ids[i] = m.ID
+		}
+		p.store.RemoveFromBundleQueue(userID, ids)
+		return eph(fmt.Sprintf("Вы покинули очередь на комплект **%s**", resourceNames(members))), nil
 	}
-	res, err := p.findResource(args[0])
+	if isPoolRef(args[0]) {
+		pool, _, err := p.findPool(userID, args[0])
+		if err != nil {
+			return eph(err.Error()), nil
+		}
+		p.store.RemoveFromQueue(poolQueueID(pool), userID)
+		return eph(fmt.Sprintf("Вы покинули очередь пула `%s`", pool)), nil
+	}
+	res, err := p.findResource(userID, args[0])
 	if err != nil {
 		return eph(err.Error()), nil
 	}
-	p.store.Unsubscribe(res.ID, userID)
-	return eph(fmt.Sprintf("🔕 Подписка на **%s** отменена", res.Name)), nil
+	p.store.RemoveFromQueue(res.ID, userID)
+	return eph(fmt.Sprintf("Вы покинули очередь на **%s**", res.Name)), nil
 }
 
-// --- History ---
+// --- Reservations ---
 
-func (p *Plugin) cmdHistory(args []string) (*model.CommandResponse, *model.AppError) {
-	if len(args) < 1 {
-		return eph("Использование: `/rq history <имя>`"), nil
+func (p *Plugin) cmdReserve(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	if len(args) < 3 {
+		return eph("Использование: `/rq reserve <имя> <начало> <время> [цель]`\n**Начало:** `14:00`, `25.12-14:00`, `+2h`"), nil
 	}
-	res, err := p.findResource(args[0])
+	res, err := p.findResource(userID, args[0])
 	if err != nil {
 		return eph(err.Error()), nil
 	}
-	entries, _ := p.store.GetHistory(res.ID, 20)
-	if len(entries) == 0 {
-		return eph("История **" + res.Name + "** пуста"), nil
+	start, err := parseStartTime(args[1], time.Now())
+	if err != nil {
+		return eph(err.Error()), nil
 	}
-	var sb strings.Builder
+	dur, err := parseDuration(args[2])
+	if err != nil {
+		return eph(err.Error()), nil
+	}
+	purpose := ""
+	if len(args) > 3 {
+		purpose = truncate(strings.Join(args[3:], " "), maxPurposeLen)
+	}
+	rsv, err := p.reserveResource(res, userID, start, dur, purpose)
+	if err != nil {
+		return eph(p.reserveErrText(res, err)), nil
+	}
+	return eph(fmt.Sprintf("📅 **%s** зарезервирован %s–%s (id `%s`)",
+		res.Name, rsv.StartsAt.Format("02.01 15:04"), rsv.EndsAt.Format("15:04"), rsv.ID)), nil
+}
+
+func (p *Plugin) cmdReservations(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	if len(args) < 1 {
+		return eph("Использование: `/rq reservations <имя>`"), nil
+	}
+	res, err := p.findResource(userID, args[0])
+	if err != nil {
+		return eph(err.Error()), nil
+	}
+	rsvs, _ := p.store.GetReservations(res.ID)
+	if len(rsvs) == 0 {
+		return eph("У **" + res.Name + "** нет резервирований"), nil
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("### Резервирования — %s\n", res.Name))
+	for _, r := range rsvs {
+		sb.WriteString(fmt.Sprintf("• `%s` %s–%s %s", r.ID,
+			r.StartsAt.Format("02.01 15:04"), r.EndsAt.Format("15:04"), p.displayName(r.UserID)))
+		if r.Purpose != "" {
+			sb.WriteString(fmt.Sprintf(" — %s", r.Purpose))
+		}
+		sb.WriteString("\n")
+	}
+	return eph(sb.String()), nil
+}
+
+func (p *Plugin) cmdUnreserve(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	if len(args) < 2 {
+		return eph("Использование: `/rq unreserve <имя> <id>`"), nil
+	}
+	res, err := p.findResource(userID, args[0])
+	if err != nil {
+		return eph(err.Error()), nil
+	}
+	rsv, err := p.cancelReservation(res, args[1], userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNoReservation):
+			return eph(fmt.Sprintf("Резервирование `%s` не найдено", args[1])), nil
+		case errors.Is(err, errNotHolder):
+			return eph("Только автор резервирования или менеджер ресурса может его отменить"), nil
+		}
+		return eph(p.bookErrText(res, err)), nil
+	}
+	return eph(fmt.Sprintf("🗑 Резервирование **%s** на %s отменено", res.Name, rsv.StartsAt.Format("02.01 15:04"))), nil
+}
+
+// --- Recurring ---
+
+const recurUsage = "Использование:\n" +
+	"`/rq recur add <имя> <daily|weekdays|пн,чт> <ЧЧ:ММ> <время> [until=ГГГГ-ММ-ДД] [цель]`\n" +
+	"`/rq recur add <имя> cron \"<мин час день месяц дн>\" <время> [until=ГГГГ-ММ-ДД] [цель]`\n" +
+	"`/rq recur list <имя>` · `/rq recur delete <имя> <id>` · `/rq recur skip <имя> <id> <ГГГГ-ММ-ДД>`"
+
+func (p *Plugin) cmdRecur(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	if len(args) < 2 {
+		return eph(recurUsage), nil
+	}
+	action := strings.ToLower(args[0])
+	res, err := p.findResource(userID, args[1])
+	if err != nil {
+		return eph(err.Error()), nil
+	}
+	args = args[2:]
+
+	switch action {
+	case "list", "ls":
+		rules, _ := p.store.GetRecurringRules(res.ID)
+		if len(rules) == 0 {
+			return eph("У **" + res.Name + "** нет повторяющихся бронирований"), nil
+		}
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("### Расписание — %s\n", res.Name))
+		for i := range rules {
+			r := &rules[i]
+			sb.WriteString(fmt.Sprintf("• `%s` %s %s", r.ID, r.Describe(), p.displayName(r.UserID)))
+			if r.Purpose != "" {
+				sb.WriteString(fmt.Sprintf(" — %s", r.Purpose))
+			}
+			if len(r.Exceptions) > 0 {
+				sb.WriteString(fmt.Sprintf(" (кроме %s)", strings.Join(r.Exceptions, ", ")))
+			}
+			sb.WriteString("\n")
+		}
+		return eph(sb.String()), nil
+
+	case "delete", "del", "rm":
+		if len(args) < 1 {
+			return eph(recurUsage), nil
+		}
+		if _, err := p.deleteRecurringRule(res, args[0], userID); err != nil {
+			return eph(p.recurErrText(res, err)), nil
+		}
+		return eph(fmt.Sprintf("🗑 Повторяющееся бронирование `%s` на **%s** удалено", args[0], res.Name)), nil
+
+	case "skip":
+		if len(args) < 2 {
+			return eph(recurUsage), nil
+		}
+		if _, err := p.skipRecurringDate(res, args[0], args[1], userID); err != nil {
+			return eph(p.recurErrText(res, err)), nil
+		}
+		return eph(fmt.Sprintf("⏭ %s пропущено для `%s` на **%s**", args[1], args[0], res.Name)), nil
+
+	case "add":
+		rule := RecurringRule{UserID: userID}
+		if len(args) < 3 {
+			return eph(recurUsage), nil
+		}
+		switch kind := strings.ToLower(args[0]); kind {
+		case RecurDaily, RecurWeekdays:
+			rule.Kind, rule.At = kind, args[1]
+		case RecurCron:
+			rule.Kind, rule.Cron = kind, args[1]
+		default:
+			days, err := parseWeekdays(kind)
+			if err != nil {
+				return eph(err.Error()), nil
+			}
+			rule.Kind, rule.Weekdays, rule.At = RecurWeekly, days, args[1]
+		}
+		dur, err := parseDuration(args[2])
+		if err != nil {
+			return eph(err.Error()), nil
+		}
+		rule.Minutes = int(dur.Minutes())
+		args = args[3:]
+		if len(args) > 0 && strings.HasPrefix(strings.ToLower(args[0]), "until=") {
+			rule.Until = args[0][len("until="):]
+			args = args[1:]
+		}
+		rule.Purpose = truncate(strings.Join(args, " "), maxPurposeLen)
+		created, err := p.addRecurringRule(res, rule)
+		if err != nil {
+			return eph(p.recurErrText(res, err)), nil
+		}
+		return eph(fmt.Sprintf("🔁 **%s**: %s (id `%s`)", res.Name, created.Describe(), created.ID)), nil
+	}
+	return eph(recurUsage), nil
+}
+
+func (p *Plugin) recurErrText(res *Resource, err error) string {
+	switch {
+	case errors.Is(err, ErrNoRule):
+		return "Повторяющееся бронирование не найдено"
+	case errors.Is(err, errNotHolder):
+		return "Только автор расписания или менеджер ресурса может его изменить"
+	}
+	if text := quotaErrText(err); text != "" {
+		return text + " — расписание превышает её само по себе"
+	}
+	return err.Error()
+}
+
+// --- Subscribe/Unsubscribe ---
+
+func (p *Plugin) cmdSubscribe(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	if len(args) < 1 {
+		return eph("Использование: `/rq subscribe <имя>|in:<группа>`"), nil
+	}
+	if isGroupRef(args[0]) {
+		groups, _ := p.store.GetGroups()
+		g := findGroup(groups, strings.Join(args, " "))
+		if g == nil {
+			return eph(groupErrText(errNoGroup)), nil
+		}
+		if err := p.store.Subscribe(groupSubsID(g.ID), userID); err != nil {
+			return eph(err.Error()), nil
+		}
+		return eph(fmt.Sprintf("🔔 Подписка на группу 📁 **%s** оформлена: сообщу, когда в ней что-то освободится", groupPath(groups, g.ID))), nil
+	}
+	res, err := p.findResource(userID, args[0])
+	if err != nil {
+		return eph(err.Error()), nil
+	}
+	if err := p.store.Subscribe(res.ID, userID); err != nil {
+		return eph(err.Error()), nil
+	}
+	return eph(fmt.Sprintf("🔔 Подписка на **%s** оформлена", res.Name)), nil
+}
+
+func (p *Plugin) cmdUnsubscribe(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	if len(args) < 1 {
+		return eph("Использование: `/rq unsubscribe <имя>|in:<группа>`"), nil
+	}
+	if isGroupRef(args[0]) {
+		groups, _ := p.store.GetGroups()
+		g := findGroup(groups, strings.Join(args, " "))
+		if g == nil {
+			return eph(groupErrText(errNoGroup)), nil
+		}
+		p.store.Unsubscribe(groupSubsID(g.ID), userID)
+		return eph(fmt.Sprintf("🔕 Подписка на группу 📁 **%s** отменена", groupPath(groups, g.ID))), nil
+	}
+	res, err := p.findResource(userID, args[0])
+	if err != nil {
+		return eph(err.Error()), nil
+	}
+	p.store.Unsubscribe(res.ID, userID)
+	return eph(fmt.Sprintf("🔕 Подписка на **%s** отменена", res.Name)), nil
+}
+
+// --- History ---
+
+func (p *Plugin) cmdHistory(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	if len(args) < 1 {
+		return eph("Использование: `/rq history <имя>`"), nil
+	}
+	res, err := p.findResource(userID, args[0])
+	if err != nil {
+		return eph(err.Error()), nil
+	}
+	entries, _ := p.store.GetHistory(res.ID, 20)
+	if len(entries) == 0 {
+		return eph("История **" + res.Name + "** пуста"), nil
+	}
+	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf("### Последние сессии — %s\n", res.Name))
 	for _, e := range entries {
 		dur := e.EndedAt.Sub(e.StartedAt)
@@ -416,45 +1108,725 @@ func (p *Plugin) cmdHistory(args []string) (*model.CommandResponse, *model.AppEr
 		if e.Purpose != "" {
 			purpose = fmt.Sprintf(" — %s", e.Purpose)
 		}
-		sb.WriteString(fmt.Sprintf("• @%s · %s · %s%s\n",
-			p.username(e.UserID), e.StartedAt.Format("02.01 15:04"), formatDuration(dur), purpose))
+		if e.PreemptedBy != "" {
+			purpose += fmt.Sprintf(" · ⛔ вытеснен %s: %s", p.displayName(e.PreemptedBy), e.PreemptReason)
+		}
+		if e.BookedBy != "" {
+			purpose += fmt.Sprintf(" · 📌 оформил %s", p.displayName(e.BookedBy))
+		}
+		sb.WriteString(fmt.Sprintf("• %s · %s · %s%s\n",
+			p.displayName(e.UserID), e.StartedAt.Format("02.01 15:04"), formatDuration(dur), purpose))
+	}
+	return eph(sb.String()), nil
+}
+
+// --- Quota ---
+
+func (p *Plugin) cmdQuota(userID string) (*model.CommandResponse, *model.AppError) {
+	text, err := p.quotaReport(userID)
+	if err != nil {
+		return eph("Ошибка: " + err.Error()), nil
+	}
+	return eph(text), nil
+}
+
+// --- Priority ---
+
+func (p *Plugin) cmdPriority(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	if len(args) == 0 {
+		classes, err := p.store.GetPriorityClasses()
+		if err != nil {
+			return eph("Ошибка: " + err.Error()), nil
+		}
+		var sb strings.Builder
+		sb.WriteString("### Приоритеты очереди\n")
+		if len(classes) == 0 {
+			sb.WriteString("Классы не настроены — повышенный приоритет доступен только администраторам\n")
+		}
+		for _, c := range classes {
+			var who []string
+			for _, r := range c.Roles {
+				who = append(who, "role:"+r)
+			}
+			for _, g := range c.Groups {
+				who = append(who, "group:"+g)
+			}
+			sb.WriteString(fmt.Sprintf("- %s (`%s`): %s\n", priorityLabel(c.Level), priorityName(c.Level), strings.Join(who, ", ")))
+		}
+		sb.WriteString(fmt.Sprintf("\nВаш максимальный приоритет: `%s`", priorityName(p.maxPriority(userID))))
+		return eph(sb.String()), nil
+	}
+	usage := "Использование: `/rq priority [allow|revoke <high|urgent> role:<роль>|group:<группа>]`"
+	if len(args) < 3 {
+		return eph(usage), nil
+	}
+	if !p.isAdmin(userID) {
+		return eph("Только администратор может настраивать приоритеты"), nil
+	}
+	level, ok := parsePriority(args[1])
+	if !ok || level == PriorityNormal {
+		return eph(usage), nil
+	}
+	kind, name, _ := strings.Cut(args[2], ":")
+	if name == "" || (kind != "role" && kind != "group") {
+		return eph(usage), nil
+	}
+	var allow bool
+	switch args[0] {
+	case "allow", "add":
+		allow = true
+	case "revoke", "remove", "rm":
+	default:
+		return eph(usage), nil
+	}
+	err := p.store.UpdatePriorityClasses(func(classes []PriorityClass) ([]PriorityClass, error) {
+		if allow {
+			c := PriorityClass{Level: level}
+			if kind == "role" {
+				c.Roles = []string{name}
+			} else {
+				c.Groups = []string{name}
+			}
+			return sanitizePriorityClasses(append(classes, c)), nil
+		}
+		for i := range classes {
+			if classes[i].Level != level {
+				continue
+			}
+			if kind == "role" {
+				classes[i].Roles = removeString(classes[i].Roles, name)
+			} else {
+				classes[i].Groups = removeString(classes[i].Groups, name)
+			}
+		}
+		return sanitizePriorityClasses(classes), nil
+	})
+	if err != nil {
+		return eph("Ошибка: " + err.Error()), nil
+	}
+	if allow {
+		return eph(fmt.Sprintf("✅ `%s:%s` может вставать в очередь с приоритетом %s", kind, name, priorityLabel(level))), nil
+	}
+	return eph(fmt.Sprintf("✅ У `%s:%s` больше нет приоритета %s", kind, name, priorityLabel(level))), nil
+}
+
+// --- Approval ---
+
+func (p *Plugin) cmdApproval(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	if len(args) < 1 {
+		return eph("Использование: `/rq approval <имя> [@user… group:<группа>|off]`"), nil
+	}
+	res, err := p.findResource(userID, args[0])
+	if err != nil {
+		return eph(err.Error()), nil
+	}
+	if len(args) == 1 {
+		if res.Approval == nil {
+			return eph(fmt.Sprintf("**%s** бронируется без согласования", res.Name)), nil
+		}
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("### 🔐 Согласование — %s\n", res.Name))
+		var who []string
+		for _, uid := range res.Approval.Users {
+			who = append(who, p.displayName(uid))
+		}
+		if res.Approval.Group != "" {
+			who = append(who, "группа `"+res.Approval.Group+"`")
+		}
+		sb.WriteString("**Согласующие:** " + strings.Join(who, ", ") + "\n")
+		reqs, _ := p.store.GetApprovalRequests(res.ID)
+		if len(reqs) > 0 && p.isApprover(userID, res) {
+			sb.WriteString(fmt.Sprintf("**Ожидают решения:** %d\n", len(reqs)))
+			for _, r := range reqs {
+				sb.WriteString(fmt.Sprintf("  • %s на %s (до %s)", p.displayName(r.UserID), formatDuration(r.Duration), r.ExpiresAt.Format("02.01 15:04")))
+				if r.Purpose != "" {
+					sb.WriteString(" — " + r.Purpose)
+				}
+				sb.WriteString("\n")
+			}
+		}
+		return eph(sb.String()), nil
+	}
+	if !p.canManage(userID, res) {
+		return eph("Только менеджер ресурса может настраивать согласование"), nil
+	}
+	if len(args) == 2 && (args[1] == "off" || args[1] == "none") {
+		res.Approval = nil
+		if err := p.store.SaveResource(res); err != nil {
+			return eph("Ошибка: " + err.Error()), nil
+		}
+		return eph(fmt.Sprintf("✅ **%s** теперь бронируется без согласования", res.Name)), nil
+	}
+	a := &Approval{}
+	for _, arg := range args[1:] {
+		if group, ok := strings.CutPrefix(arg, "group:"); ok {
+			a.Group = group
+			continue
+		}
+		u, appErr := p.API.GetUserByUsername(strings.TrimPrefix(arg, "@"))
+		if appErr != nil {
+			return eph("Пользователь " + arg + " не найден"), nil
+		}
+		a.Users = append(a.Users, u.Id)
+	}
+	if a.Group != "" {
+		if _, appErr := p.API.GetGroupByName(a.Group); appErr != nil {
+			return eph("Группа `" + a.Group + "` не найдена"), nil
+		}
+	}
+	res.Approval = sanitizeApproval(a)
+	if err := p.store.SaveResource(res); err != nil {
+		return eph("Ошибка: " + err.Error()), nil
+	}
+	return eph(fmt.Sprintf("✅ Брони **%s** теперь требуют согласования (`/rq approval %s` — кто согласует)", res.Name, res.Name)), nil
+}
+
+// --- Access ---
+
+func (p *Plugin) cmdAccess(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	usage := "Использование: `/rq access <имя> [team:<команда> channel:<команда>/<канал> group:<группа> @user…|off]`"
+	if len(args) < 1 {
+		return eph(usage), nil
+	}
+	res, err := p.findResource(userID, args[0])
+	if err != nil {
+		return eph(err.Error()), nil
+	}
+	if !p.canManage(userID, res) {
+		return eph("Только менеджер ресурса может настраивать доступ"), nil
+	}
+	if len(args) == 1 {
+		if acl := p.describeAccess(res); acl != "" {
+			return eph(fmt.Sprintf("🔒 **%s** доступен: %s", res.Name, acl)), nil
+		}
+		return eph(fmt.Sprintf("**%s** доступен всем", res.Name)), nil
+	}
+	if len(args) == 2 && (args[1] == "off" || args[1] == "all") {
+		res.Access = nil
+		if err := p.store.SaveResource(res); err != nil {
+			return eph("Ошибка: " + err.Error()), nil
+		}
+		return eph(fmt.Sprintf("✅ **%s** теперь доступен всем", res.Name)), nil
+	}
+	a := &Access{}
+	for _, arg := range args[1:] {
+		kind, name, _ := strings.Cut(arg, ":")
+		switch {
+		case strings.HasPrefix(arg, "@"):
+			u, appErr := p.API.GetUserByUsername(strings.TrimPrefix(arg, "@"))
+			if appErr != nil {
+				return eph("Пользователь " + arg + " не найден"), nil
+			}
+			a.Users = append(a.Users, u.Id)
+		case kind == "team" && name != "":
+			t, appErr := p.API.GetTeamByName(name)
+			if appErr != nil {
+				return eph("Команда `" + name + "` не найдена"), nil
+			}
+			a.Teams = append(a.Teams, t.Id)
+		case kind == "channel" && name != "":
+			teamName, chName, ok := strings.Cut(name, "/")
+			if !ok {
+				return eph(usage), nil
+			}
+			t, appErr := p.API.GetTeamByName(teamName)
+			if appErr != nil {
+				return eph("Команда `" + teamName + "` не найдена"), nil
+			}
+			ch, appErr := p.API.GetChannelByName(t.Id, strings.TrimPrefix(chName, "~"), false)
+			if appErr != nil {
+				return eph("Канал `" + name + "` не найден"), nil
+			}
+			a.Channels = append(a.Channels, ch.Id)
+		case kind == "group" && name != "":
+			if _, appErr := p.API.GetGroupByName(name); appErr != nil {
+				return eph("Группа `" + name + "` не найдена"), nil
+			}
+			a.Groups = append(a.Groups, name)
+		default:
+			return eph(usage), nil
+		}
+	}
+	res.Access = sanitizeAccess(a)
+	if err := p.store.SaveResource(res); err != nil {
+		return eph("Ошибка: " + err.Error()), nil
+	}
+	return eph(fmt.Sprintf("✅ Доступ к **%s**: %s", res.Name, p.describeAccess(res))), nil
+}
+
+// --- Managers ---
+
+func (p *Plugin) cmdAdmin(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	usage := "Использование: `/rq admin [grant|revoke [<имя>] @user|group:<группа>]` или `/rq admin kick <имя> @user`"
+	if len(args) == 0 {
+		var sb strings.Builder
+		sb.WriteString("### 🛠 Менеджеры ресурсов\n")
+		global, _ := p.store.GetManagers()
+		if who := p.describeManagers(global); who != "" {
+			sb.WriteString("**Глобальные:** " + who + "\n")
+		} else {
+			sb.WriteString("**Глобальные:** только системные администраторы\n")
+		}
+		resources, _ := p.visibleResources(userID)
+		manages := p.managerChecker(userID)
+		for _, r := range resources {
+			if who := p.describeManagers(r.Managers); who != "" {
+				sb.WriteString(fmt.Sprintf("• **%s**: %s\n", r.Name, who))
+			}
+		}
+		var own []string
+		for _, r := range resources {
+			if manages(r) {
+				own = append(own, r.Name)
+			}
+		}
+		switch {
+		case p.canManage(userID, nil):
+			sb.WriteString("\nВы управляете всеми ресурсами")
+		case len(own) > 0:
+			sb.WriteString("\nВы управляете: " + strings.Join(own, ", "))
+		}
+		return eph(sb.String()), nil
+	}
+	switch args[0] {
+	case "kick":
+		if len(args) != 3 {
+			return eph(usage), nil
+		}
+		res, err := p.findResource(userID, args[1])
+		if err != nil {
+			return eph(err.Error()), nil
+		}
+		u, appErr := p.API.GetUserByUsername(strings.TrimPrefix(args[2], "@"))
+		if appErr != nil {
+			return eph("Пользователь " + args[2] + " не найден"), nil
+		}
+		switch err := p.kickFromQueue(res, userID, u.Id); {
+		case errors.Is(err, errNotManager):
+			return eph("Только менеджер ресурса может менять очередь"), nil
+		case errors.Is(err, errNotQueued):
+			return eph(fmt.Sprintf("@%s не стоит в очереди на **%s**", u.Username, res.Name)), nil
+		case err != nil:
+			return eph("Ошибка: " + err.Error()), nil
+		}
+		return eph(fmt.Sprintf("✅ @%s убран из очереди на **%s**", u.Username, res.Name)), nil
+	case "grant", "add", "revoke", "remove", "rm":
+	default:
+		return eph(usage), nil
+	}
+	if len(args) != 2 && len(args) != 3 {
+		return eph(usage), nil
+	}
+	grant := args[0] == "grant" || args[0] == "add"
+	target := args[len(args)-1]
+	m := &Managers{}
+	label := target
+	if group, ok := strings.CutPrefix(target, "group:"); ok {
+		if _, appErr := p.API.GetGroupByName(group); appErr != nil {
+			return eph("Группа `" + group + "` не найдена"), nil
+		}
+		m.Groups = []string{group}
+		label = "группа `" + group + "`"
+	} else {
+		u, appErr := p.API.GetUserByUsername(strings.TrimPrefix(target, "@"))
+		if appErr != nil {
+			return eph("Пользователь " + target + " не найден"), nil
+		}
+		m.Users = []string{u.Id}
+		label = "@" + u.Username
+	}
+	apply := func(cur *Managers) *Managers {
+		if cur == nil {
+			cur = &Managers{}
+		}
+		if grant {
+			return sanitizeManagers(&Managers{
+				Users:  append(cur.Users, m.Users...),
+				Groups: append(cur.Groups, m.Groups...),
+			})
+		}
+		for _, uid := range m.Users {
+			cur.Users = removeString(cur.Users, uid)
+		}
+		for _, g := range m.Groups {
+			cur.Groups = removeString(cur.Groups, g)
+		}
+		return sanitizeManagers(cur)
+	}
+
+	if len(args) == 2 {
+		if !p.isAdmin(userID) {
+			return eph("Только системный администратор может назначать глобальных менеджеров"), nil
+		}
+		if err := p.store.UpdateManagers(func(cur *Managers) (*Managers, error) {
+			return apply(cur), nil
+		}); err != nil {
+			return eph("Ошибка: " + err.Error()), nil
+		}
+		if grant {
+			return eph(fmt.Sprintf("✅ %s теперь управляет всеми ресурсами", label)), nil
+		}
+		return eph(fmt.Sprintf("✅ %s больше не глобальный менеджер", label)), nil
+	}
+	res, err := p.findResource(userID, args[1])
+	if err != nil {
+		return eph(err.Error()), nil
+	}
+	if !p.canManage(userID, res) {
+		return eph("Только менеджер ресурса может назначать менеджеров"), nil
+	}
+	res.Managers = apply(res.Managers)
+	if err := p.store.SaveResource(res); err != nil {
+		return eph("Ошибка: " + err.Error()), nil
+	}
+	if grant {
+		return eph(fmt.Sprintf("✅ %s теперь управляет **%s**", label, res.Name)), nil
+	}
+	return eph(fmt.Sprintf("✅ %s больше не управляет **%s**", label, res.Name)), nil
+}
+
+// --- Maintenance ---
+
+func (p *Plugin) cmdMaintenance(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	usage := "Использование: `/rq maintenance <имя> [from=<начало>] [until=<конец>|for=<время>] [причина]` или `/rq maintenance <имя> off`"
+	if len(args) < 1 {
+		return eph(usage), nil
+	}
+	res, err := p.findResource(userID, args[0])
+	if err != nil {
+		return eph(err.Error()), nil
+	}
+	if len(args) == 1 {
+		if text := p.describeMaintenance(res); text != "" {
+			return eph(fmt.Sprintf("**%s**: %s", res.Name, text)), nil
+		}
+		return eph(fmt.Sprintf("**%s** в строю, обслуживание не запланировано", res.Name)), nil
+	}
+	if len(args) == 2 && (args[1] == "off" || args[1] == "end") {
+		if res.Maintenance == nil {
+			return eph(fmt.Sprintf("**%s** не на обслуживании", res.Name)), nil
+		}
+		if err := p.endMaintenance(res, userID); err != nil {
+			if errors.Is(err, errNotManager) {
+				return eph("Только менеджер ресурса может управлять обслуживанием"), nil
+			}
+			return eph("Ошибка: " + err.Error()), nil
+		}
+		return eph(fmt.Sprintf("✅ **%s** снова в строю", res.Name)), nil
+	}
+	now := time.Now()
+	var start, end time.Time
+	var length time.Duration
+	var reason []string
+	for _, arg := range args[1:] {
+		key, val, _ := strings.Cut(arg, "=")
+		switch {
+		case key == "from" && val != "":
+			if start, err = parseStartTime(val, now); err != nil {
+				return eph(err.Error()), nil
+			}
+		case key == "until" && val != "":
+			if end, err = parseStartTime(val, now); err != nil {
+				return eph(err.Error()), nil
+			}
+		case key == "for" && val != "":
+			if length, err = parseDuration(val); err != nil {
+				return eph(err.Error()), nil
+			}
+		default:
+			reason = append(reason, arg)
+		}
+	}
+	if length > 0 {
+		end = start
+		if end.IsZero() {
+			end = now
+		}
+		end = end.Add(length)
+	}
+	switch err := p.scheduleMaintenance(res, userID, strings.Join(reason, " "), start, end); {
+	case errors.Is(err, errNotManager):
+		return eph("Только менеджер ресурса может управлять обслуживанием"), nil
+	case errors.Is(err, errBadMaintenance):
+		return eph("Конец обслуживания должен быть позже начала"), nil
+	case err != nil:
+		return eph("Ошибка: " + err.Error()), nil
+	}
+	return eph(fmt.Sprintf("✅ **%s**: %s", res.Name, p.describeMaintenance(res))), nil
+}
+
+// --- Groups ---
+
+func (p *Plugin) cmdGroups(userID string) (*model.CommandResponse, *model.AppError) {
+	groups, err := p.store.GetGroups()
+	if err != nil {
+		return eph("Ошибка: " + err.Error()), nil
+	}
+	if len(groups) == 0 {
+		return eph("Группы ресурсов не настроены. Менеджер может добавить их: `/rq group add <имя>`"), nil
+	}
+	resources, _ := p.visibleResources(userID)
+	manager := p.canManage(userID, nil)
+	var sb strings.Builder
+	var walk func(parentID string, depth int)
+	walk = func(parentID string, depth int) {
+		var level []ResourceGroup
+		for _, g := range groups {
+			if g.ParentID == parentID {
+				level = append(level, g)
+			}
+		}
+		sort.Slice(level, func(i, j int) bool { return level[i].Name < level[j].Name })
+		for _, g := range level {
+			in := subtreeIDs(groups, g.ID)
+			free, total := 0, 0
+			for _, r := range resources {
+				if in[r.GroupID] {
+					total++
+					if p.hasFreeSeat(r) {
+						free++
+					}
+				}
+			}
+			if total == 0 && !manager {
+				continue
+			}
+			icon := g.Icon
+			if icon == "" {
+				icon = "📁"
+			}
+			sb.WriteString(fmt.Sprintf("%s%s **%s** `in:%s` — свободно %d/%d", strings.Repeat("    ", depth), icon, g.Name, groupSlug(g.Name), free, total))
+			if p.store.IsSubscribed(groupSubsID(g.ID), userID) {
+				sb.WriteString(" 🔔")
+			}
+			if g.Description != "" {
+				sb.WriteString(" — _" + g.Description + "_")
+			}
+			sb.WriteString("\n")
+			if depth+1 < maxGroupDepth {
+				walk(g.ID, depth+1)
+			}
+		}
+	}
+	walk("", 0)
+	if sb.Len() == 0 {
+		return eph("Нет доступных вам групп ресурсов"), nil
 	}
 	return eph(sb.String()), nil
 }
 
+func (p *Plugin) cmdGroup(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	usage := "Использование: `/rq group add <имя> [in:<родитель>] [icon:<эмодзи>] [описание]`, " +
+		"`/rq group move <группа> <родитель>|none`, `/rq group delete <группа>` или `/rq group set <ресурс> <группа>|none`"
+	if len(args) < 2 {
+		return eph(usage), nil
+	}
+	groups, err := p.store.GetGroups()
+	if err != nil {
+		return eph("Ошибка: " + err.Error()), nil
+	}
+	reply := func(err error) *model.CommandResponse {
+		if text := groupErrText(err); text != "" {
+			return eph(text)
+		}
+		return eph("Ошибка: " + err.Error())
+	}
+	switch strings.ToLower(args[0]) {
+	case "add", "create":
+		g := ResourceGroup{Name: args[1]}
+		var desc []string
+		for _, arg := range args[2:] {
+			switch {
+			case isGroupRef(arg):
+				parent := findGroup(groups, arg)
+				if parent == nil {
+					return reply(errNoGroup), nil
+				}
+				g.ParentID = parent.ID
+			case strings.HasPrefix(strings.ToLower(arg), "icon:"):
+				g.Icon = arg[len("icon:"):]
+			default:
+				desc = append(desc, arg)
+			}
+		}
+		g.Description = strings.Join(desc, " ")
+		created, err := p.createGroup(userID, g)
+		if err != nil {
+			return reply(err), nil
+		}
+		return eph(fmt.Sprintf("✅ Группа 📁 **%s** создана: `in:%s`", groupPath(append(groups, *created), created.ID), groupSlug(created.Name))), nil
+	case "delete", "del", "rm":
+		g := findGroup(groups, args[1])
+		if g == nil {
+			return reply(errNoGroup), nil
+		}
+		if _, err := p.deleteGroup(userID, g.ID); err != nil {
+			return reply(err), nil
+		}
+		return eph(fmt.Sprintf("🗑 Группа **%s** удалена, её ресурсы и подгруппы перенесены уровнем выше", g.Name)), nil
+	case "move", "mv":
+		if len(args) < 3 {
+			return eph(usage), nil
+		}
+		g := findGroup(groups, args[1])
+		if g == nil {
+			return reply(errNoGroup), nil
+		}
+		upd := *g
+		upd.ParentID = ""
+		if args[2] != "none" {
+			parent := findGroup(groups, args[2])
+			if parent == nil {
+				return reply(errNoGroup), nil
+			}
+			upd.ParentID = parent.ID
+		}
+		moved, err := p.updateGroup(userID, g.ID, upd)
+		if err != nil {
+			return reply(err), nil
+		}
+		groups, _ = p.store.GetGroups()
+		return eph(fmt.Sprintf("✅ Группа перенесена: 📁 **%s**", groupPath(groups, moved.ID))), nil
+	case "set":
+		if len(args) < 3 {
+			return eph(usage), nil
+		}
+		res, err := p.findResource(userID, args[1])
+		if err != nil {
+			return eph(err.Error()), nil
+		}
+		g, err := p.setResourceGroup(res, userID, args[2])
+		switch {
+		case errors.Is(err, errNotManager):
+			return eph("Только менеджер ресурса может менять его группу"), nil
+		case err != nil:
+			return reply(err), nil
+		case g == nil:
+			return eph(fmt.Sprintf("✅ **%s** больше не входит ни в одну группу", res.Name)), nil
+		}
+		return eph(fmt.Sprintf("✅ **%s** теперь в группе 📁 **%s**", res.Name, groupPath(groups, g.ID))), nil
+	}
+	return eph(usage), nil
+}
+
+// --- Boards ---
+
+func (p *Plugin) cmdBoard(userID, channelID string, args []string) (*model.CommandResponse, *model.AppError) {
+	usage := "Использование: `/rq board [tag:<тег>…] [in:<группа>] [free]`, `/rq board list` или `/rq board delete [<ID>]`"
+	reply := func(err error) *model.CommandResponse {
+		if text := boardErrText(err); text != "" {
+			return eph(text)
+		}
+		return eph("Ошибка: " + err.Error())
+	}
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "list", "ls":
+			boards, err := p.channelBoards(channelID)
+			if err != nil {
+				return reply(err), nil
+			}
+			if len(boards) == 0 {
+				return eph("В этом канале нет досок. Создать: `/rq board [фильтр]`"), nil
+			}
+			var sb strings.Builder
+			sb.WriteString("### Доски канала\n")
+			for _, b := range boards {
+				filter := "все ресурсы"
+				if f, _ := parseFilterArgs(b.Filter); !f.empty() {
+					filter = describeFilter(f)
+				}
+				sb.WriteString(fmt.Sprintf("• `%s` %s · создал %s %s\n",
+					b.PostID[:8], filter, p.displayName(b.CreatedBy), b.CreatedAt.Format("02.01 15:04")))
+			}
+			return eph(sb.String()), nil
+		case "delete", "del", "rm", "off":
+			if len(args) > 2 {
+				return eph(usage), nil
+			}
+			ref := ""
+			if len(args) == 2 {
+				ref = args[1]
+			}
+			if _, err := p.deleteBoard(userID, channelID, ref); err != nil {
+				return reply(err), nil
+			}
+			return eph("🗑 Доска удалена"), nil
+		}
+	}
+	if _, ok := parseFilterArgs(args); !ok {
+		return eph(usage), nil
+	}
+	if _, err := p.createBoard(userID, channelID, args); err != nil {
+		return reply(err), nil
+	}
+	return eph("📋 Доска создана и закреплена в канале; она обновляется сама. Удалить: `/rq board delete` или удалите сообщение"), nil
+}
+
 // --- Help ---
 
 func (p *Plugin) cmdHelp() *model.CommandResponse {
 	return eph(`### Resource Queue
 | Команда | Описание |
 |---|---|
-| ` + "`/rq list`" + ` | Список ресурсов с кнопками |
-| ` + "`/rq status [имя]`" + ` | Подробный статус |
-| ` + "`/rq book <имя> <время> [цель]`" + ` | Забронировать |
-| ` + "`/rq release <имя>`" + ` | Освободить |
+| ` + "`/rq list [tag:<тег>…] [in:<группа>] [free]`" + ` | Список ресурсов с кнопками по группам (с фильтром по тегам, группе и свободным) |
+| ` + "`/rq status [имя|tag:<тег>… in:<группа> free]`" + ` | Подробный статус |
+| ` + "`/rq book <имя> [время] [цель]`" + ` | Забронировать |
+| ` + "`/rq book <имя> [время] for @user [цель]`" + ` | Забронировать для другого (менеджер) |
+| ` + "`/rq book pool:<пул> <время> [цель]`" + ` | Занять любой свободный из пула |
+| ` + "`/rq book <имя1>,<имя2>,… <время> [цель]`" + ` | Занять комплект целиком (всё или ничего) |
+| ` + "`/rq release <имя> [@user]`" + ` | Освободить (менеджер — чужое место) |
+| ` + "`/rq transfer <имя> @user`" + ` | Передать свою бронь коллеге |
+| ` + "`/rq preempt <имя> [@user] <причина>`" + ` | Вытеснить держателя (админ/дежурный) |
 | ` + "`/rq extend <имя> <время>`" + ` | Продлить |
-| ` + "`/rq queue <имя> <время> [цель]`" + ` | Встать в очередь |
+| ` + "`/rq queue <имя|pool:пул|имя1,имя2,…> <время> [цель]`" + ` | Встать в очередь |
 | ` + "`/rq leave <имя>`" + ` | Покинуть очередь |
-| ` + "`/rq subscribe <имя>`" + ` | Подписка на уведомления |
+| ` + "`/rq reserve <имя> <начало> <время> [цель]`" + ` | Зарезервировать на будущее |
+| ` + "`/rq reservations <имя>`" + ` | Резервирования ресурса |
+| ` + "`/rq unreserve <имя> <id>`" + ` | Отменить резервирование |
+| ` + "`/rq recur add|list|delete|skip <имя> ...`" + ` | Повторяющиеся бронирования |
+| ` + "`/rq subscribe <имя>|in:<группа>`" + ` | Подписка на уведомления (по группе — когда в ней что-то освободится) |
+| ` + "`/rq board [tag:<тег>…] [in:<группа>] [free]`" + ` | Закреплённая доска ресурсов в канале, обновляется сама (` + "`list`" + `, ` + "`delete [<ID>]`" + `) |
+| ` + "`/rq groups`" + ` | Дерево групп ресурсов |
+| ` + "`/rq group add|move|delete|set ...`" + ` | Группы ресурсов (менеджер) |
 | ` + "`/rq history <имя>`" + ` | История |
-**Время:** ` + "`30m` `1h` `2h30m`" + ` или число минут`)
+| ` + "`/rq quota`" + ` | Ваши квоты и остаток |
+| ` + "`/rq priority`" + ` | Классы приоритетов очереди (админ: ` + "`allow|revoke <high|urgent> role:<роль>|group:<группа>`" + `) |
+| ` + "`/rq approval <имя>`" + ` | Согласующие и ожидающие запросы (менеджер: ` + "`@user… group:<группа>|off`" + `) |
+| ` + "`/rq access <имя> team:<команда> channel:<команда>/<канал> group:<группа> @user…|off`" + ` | Ограничить доступ к ресурсу (менеджер) |
+| ` + "`/rq admin [grant|revoke [<имя>] @user|group:<группа>]`" + ` | Менеджеры ресурсов (глобальных назначает системный админ) |
+| ` + "`/rq admin kick <имя> @user`" + ` | Убрать из очереди (менеджер) |
+| ` + "`/rq maintenance <имя> [from=<начало>] [until=<конец>|for=<время>] [причина]|off`" + ` | Обслуживание: бронь и очередь закрыты (менеджер) |
+**Время:** ` + "`30m` `1h` `2h30m`" + ` или число минут
+**Начало:** ` + "`14:00` `25.12-14:00` `+2h`")
 }
 
 // --- Helpers ---
 
-func (p *Plugin) findResource(nameOrID string) (*Resource, error) {
-	resources, err := p.store.GetAllResources()
+func (p *Plugin) findResource(userID, nameOrID string) (*Resource, error) {
+	resources, err := p.visibleResources(userID)
 	if err != nil {
 		return nil, err
 	}
 	q := strings.ToLower(strings.TrimSpace(nameOrID))
 	var matches []*Resource
-	for _, r := range resources {
-		if strings.ToLower(r.ID) == q || strings.ToLower(r.Name) == q {
-			return r, nil
+	if tag, ok := strings.CutPrefix(q, "tag:"); ok {
+		// Only by tag: the one resource carrying it.
+		matches = p.filterResources(resources, resourceFilter{Tags: []string{normalizeTag(tag)}})
+	} else {
+		for _, r := range resources {
+			if strings.ToLower(r.ID) == q || strings.ToLower(r.Name) == q {
+				return r, nil
+			}
+			if strings.Contains(strings.ToLower(r.Name), q) || strings.HasPrefix(r.ID, q) {
+				matches = append(matches, r)
+			}
 		}
-		if strings.Contains(strings.ToLower(r.Name), q) || strings.HasPrefix(r.ID, q) {
-			matches = append(matches, r)
+	}
+	if len(matches) == 0 {
+		// Fall back to tags, so "/rq book gpu 1h" works with one GPU box.
+		if t := normalizeTag(q); t != "" {
+			matches = p.filterResources(resources, resourceFilter{Tags: []string{t}})
 		}
 	}
 	if len(matches) == 1 {
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// WebSocket events. Every change to a resource's indexed state — bookings,
+// queue, subscriptions, the resource itself, including expiries taken by the
+// scheduler — is pushed to open sidebars instead of them polling /status.
+// Changes are collected for eventDelay so that one action touching several
+// keys sends one event per resource.
+//
+// status_changed carries the resource's status as seen by nobody in
+// particular, JSON-encoded, and its subscriber_ids: the sidebar works out the
+// per-user flags itself. Resources with access restrictions get only their
+// ID, and clients that may see them fetch /status/{id}, which does the access
+// check. resource_deleted and groups_changed tell clients to drop a resource
+// or reload the tree.
+//
+// Status boards (see boards.go) are refreshed with every flush.
+
+const (
+	eventStatusChanged   = "status_changed"
+	eventResourceDeleted = "resource_deleted"
+	eventGroupsChanged   = "groups_changed"
+
+	eventDelay = 200 * time.Millisecond
+)
+
+type eventQueue struct {
+	mu      sync.Mutex
+	pending map[string]bool
+	timer   *time.Timer
+}
+
+// statusChanged schedules a status_changed event for resource id.
+func (p *Plugin) statusChanged(id string) {
+	q := &p.events
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending == nil {
+		q.pending = map[string]bool{}
+	}
+	q.pending[id] = true
+	p.scheduleFlush()
+}
+
+// scheduleFlush arms the flush timer; the caller holds p.events.mu.
+func (p *Plugin) scheduleFlush() {
+	if q := &p.events; q.timer == nil {
+		q.timer = time.AfterFunc(eventDelay, p.flushEvents)
+	}
+}
+
+// stopEvents drops events not sent yet; used on deactivation.
+func (p *Plugin) stopEvents() {
+	q := &p.events
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.timer != nil {
+		q.timer.Stop()
+		q.timer = nil
+	}
+	q.pending = nil
+}
+
+func (p *Plugin) flushEvents() {
+	q := &p.events
+	q.mu.Lock()
+	ids := q.pending
+	q.pending, q.timer = nil, nil
+	q.mu.Unlock()
+	for id := range ids {
+		p.publishStatus(id)
+	}
+	p.refreshBoards()
+}
+
+func (p *Plugin) publishStatus(id string) {
+	e, err := p.store.IndexEntry(id)
+	if err != nil {
+		p.API.LogWarn("publishStatus", "resource", id, "err", err.Error())
+		return
+	}
+	if e == nil {
+		p.publish(eventResourceDeleted, map[string]any{"resource_id": id})
+		return
+	}
+	payload := map[string]any{"resource_id": id}
+	if e.Resource.Access == nil {
+		st := p.makeStatus(&e.Resource, e.active(), e.Queue, e.Subscribers, "")
+		data, err := json.Marshal(st)
+		if err != nil {
+			return
+		}
+		subs, _ := json.Marshal(e.Subscribers)
+		payload["status"] = string(data)
+		payload["subscriber_ids"] = string(subs)
+	}
+	p.publish(eventStatusChanged, payload)
+}
+
+func (p *Plugin) groupsChanged() {
+	p.publish(eventGroupsChanged, map[string]any{})
+	p.events.mu.Lock()
+	p.scheduleFlush() // for the boards
+	p.events.mu.Unlock()
+}
+
+func (p *Plugin) publish(event string, payload map[string]any) {
+	p.API.PublishWebSocketEvent(event, payload, &model.WebsocketBroadcast{})
+}
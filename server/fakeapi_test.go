@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+// fakeAPI is an in-memory plugin.API with the KV store, configuration and
+// the few user and team calls the store and quota code make. Anything else
+// panics on the nil embedded interface.
+type fakeAPI struct {
+	plugin.API
+
+	mu    sync.Mutex
+	kv    map[string][]byte
+	cfg   configuration
+	teams map[string][]*model.Team // by user ID
+
+	// beforeSet, if set, runs before every atomic set, outside the lock;
+	// tests use it to play a concurrent writer.
+	beforeSet func(key string)
+}
+
+func newFakeAPI() *fakeAPI {
+	return &fakeAPI{kv: map[string][]byte{}, teams: map[string][]*model.Team{}}
+}
+
+// newTestPlugin returns a plugin on a fresh fakeAPI with cfg as its settings.
+func newTestPlugin(cfg configuration) (*Plugin, *fakeAPI) {
+	api := newFakeAPI()
+	api.cfg = cfg
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.store = NewStore(api)
+	p.users = newUserCache()
+	return p, api
+}
+
+func (f *fakeAPI) KVGet(key string) ([]byte, *model.AppError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.kv[key], nil
+}
+
+func (f *fakeAPI) KVSet(key string, value []byte) *model.AppError {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if value == nil {
+		delete(f.kv, key)
+	} else {
+		f.kv[key] = value
+	}
+	return nil
+}
+
+func (f *fakeAPI) KVSetWithOptions(key string, value []byte, options model.PluginKVSetOptions) (bool, *model.AppError) {
+	if f.beforeSet != nil {
+		f.beforeSet(key)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if options.Atomic {
+		cur, ok := f.kv[key]
+		if options.OldValue == nil && ok || options.OldValue != nil && !bytes.Equal(cur, options.OldValue) {
+			return false, nil
+		}
+	}
+	if value == nil {
+		delete(f.kv, key)
+	} else {
+		f.kv[key] = value
+	}
+	return true, nil
+}
+
+func (f *fakeAPI) KVDelete(key string) *model.AppError {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.kv, key)
+	return nil
+}
+
+func (f *fakeAPI) KVList(page, perPage int) ([]string, *model.AppError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := make([]string, 0, len(f.kv))
+	for k := range f.kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	from := min(page*perPage, len(keys))
+	return keys[from:min(from+perPage, len(keys))], nil
+}
+
+func (f *fakeAPI) LoadPluginConfiguration(dest any) error {
+	*dest.(*configuration) = f.cfg
+	return nil
+}
+
+func (f *fakeAPI) GetTeamsForUser(userID string) ([]*model.Team, *model.AppError) {
+	return f.teams[userID], nil
+}
+
+func (f *fakeAPI) GetTeamMember(teamID, userID string) (*model.TeamMember, *model.AppError) {
+	for _, t := range f.teams[userID] {
+		if t.Id == teamID {
+			return &model.TeamMember{TeamId: teamID, UserId: userID}, nil
+		}
+	}
+	return nil, model.NewAppError("GetTeamMember", "not_found", nil, "", 404)
+}
+
+func (f *fakeAPI) LogDebug(msg string, keyValuePairs ...any) {}
+func (f *fakeAPI) LogInfo(msg string, keyValuePairs ...any)  {}
+func (f *fakeAPI) LogWarn(msg string, keyValuePairs ...any)  {}
+func (f *fakeAPI) LogError(msg string, keyValuePairs ...any) {}
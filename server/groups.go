@@ -0,0 +1,421 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Resource groups. Groups nest (a lab holds racks, a rack holds machines)
+// and all of them live in one list under keyGroups; a resource belongs to at
+// most one group through Resource.GroupID. Listings and the status payload
+// follow the tree, "in:<группа>" filters by a group and everything below it,
+// and group subscribers hear when anything in the subtree frees up. Their
+// subscriptions live next to the per-resource ones under a "grp:" pseudo ID,
+// like pool queues do. Groups are global managers' business; a resource's own
+// managers may move it between groups.
+
+const (
+	maxGroups     = 100
+	maxGroupDepth = 6
+	groupPrefix   = "in:"
+)
+
+var (
+	errNoGroup    = errors.New("resource group not found")
+	errGroupCycle = errors.New("a group cannot be placed inside itself")
+	errGroupDepth = fmt.Errorf("groups nest at most %d levels deep", maxGroupDepth)
+)
+
+func groupSubsID(groupID string) string {
+	return "grp:" + groupID
+}
+
+// isGroupRef reports whether a command argument refers to a group ("in:lab-2").
+func isGroupRef(arg string) bool {
+	return strings.HasPrefix(strings.ToLower(arg), groupPrefix)
+}
+
+// groupSlug is how groups are named in commands: lower case, dashes for spaces.
+func groupSlug(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), "-")
+}
+
+// findGroup resolves a group by ID or by name, where dashes stand for spaces.
+func findGroup(groups []ResourceGroup, ref string) *ResourceGroup {
+	ref = strings.TrimPrefix(strings.TrimSpace(ref), groupPrefix)
+	for i := range groups {
+		if groups[i].ID == ref || groupSlug(groups[i].Name) == groupSlug(ref) {
+			return &groups[i]
+		}
+	}
+	return nil
+}
+
+// groupByID returns the group with id, or nil.
+func groupByID(groups []ResourceGroup, id string) *ResourceGroup {
+	for i := range groups {
+		if groups[i].ID == id {
+			return &groups[i]
+		}
+	}
+	return nil
+}
+
+// subtreeIDs returns id and the IDs of every group below it.
+func subtreeIDs(groups []ResourceGroup, id string) map[string]bool {
+	ids := map[string]bool{id: true}
+	for grew := true; grew; {
+		grew = false
+		for _, g := range groups {
+			if g.ParentID != "" && ids[g.ParentID] && !ids[g.ID] {
+				ids[g.ID] = true
+				grew = true
+			}
+		}
+	}
+	return ids
+}
+
+// ancestorIDs returns id and the IDs of the groups above it, innermost first.
+func ancestorIDs(groups []ResourceGroup, id string) []string {
+	var out []string
+	for id != "" && len(out) <= maxGroupDepth {
+		g := groupByID(groups, id)
+		if g == nil {
+			break
+		}
+		out = append(out, g.ID)
+		id = g.ParentID
+	}
+	return out
+}
+
+// groupPath renders "Lab 2 › Rack 1" for group id.
+func groupPath(groups []ResourceGroup, id string) string {
+	ids := ancestorIDs(groups, id)
+	names := make([]string, len(ids))
+	for i, gid := range ids {
+		names[len(ids)-1-i] = groupByID(groups, gid).Name
+	}
+	return strings.Join(names, " › ")
+}
+
+// checkGroupParent validates placing group id under parentID.
+func checkGroupParent(groups []ResourceGroup, id, parentID string) error {
+	if parentID == "" {
+		return nil
+	}
+	if groupByID(groups, parentID) == nil {
+		return errNoGroup
+	}
+	if id != "" && subtreeIDs(groups, id)[parentID] {
+		return errGroupCycle
+	}
+	depth := len(ancestorIDs(groups, parentID)) + 1
+	if id != "" {
+		depth += subtreeDepth(groups, id) - 1
+	}
+	if depth > maxGroupDepth {
+		return errGroupDepth
+	}
+	return nil
+}
+
+// subtreeDepth counts the levels of the subtree rooted at id, itself included.
+func subtreeDepth(groups []ResourceGroup, id string) int {
+	depth := 1
+	for _, g := range groups {
+		if g.ParentID == id {
+			if d := subtreeDepth(groups, g.ID) + 1; d > depth {
+				depth = d
+			}
+		}
+	}
+	return depth
+}
+
+// sanitizeGroup trims admin input in place.
+func sanitizeGroup(g *ResourceGroup) {
+	g.Name = truncate(strings.TrimSpace(g.Name), maxNameLen)
+	g.Icon = truncate(strings.TrimSpace(g.Icon), 10)
+	g.Description = truncate(strings.TrimSpace(g.Description), maxDescLen)
+	g.ParentID = strings.TrimSpace(g.ParentID)
+}
+
+// createGroup adds a group on behalf of actorID, a global manager.
+func (p *Plugin) createGroup(actorID string, g ResourceGroup) (*ResourceGroup, error) {
+	if !p.canManage(actorID, nil) {
+		return nil, errNotManager
+	}
+	sanitizeGroup(&g)
+	if g.Name == "" {
+		return nil, errors.New("name required")
+	}
+	g.ID = model.NewId()[:8]
+	g.CreatedAt = time.Now()
+	g.CreatedBy = actorID
+	err := p.store.UpdateGroups(func(groups []ResourceGroup) ([]ResourceGroup, error) {
+		if len(groups) >= maxGroups {
+			return nil, fmt.Errorf("max groups limit (%d) reached", maxGroups)
+		}
+		if findGroup(groups, g.Name) != nil {
+			return nil, fmt.Errorf("group %q already exists", g.Name)
+		}
+		if err := checkGroupParent(groups, "", g.ParentID); err != nil {
+			return nil, err
+		}
+		return append(groups, g), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// updateGroup replaces the editable fields of group id with upd's.
+func (p *Plugin) updateGroup(actorID, id string, upd ResourceGroup) (*ResourceGroup, error) {
+	if !p.canManage(actorID, nil) {
+		return nil, errNotManager
+	}
+	sanitizeGroup(&upd)
+	if upd.Name == "" {
+		return nil, errors.New("name required")
+	}
+	var out ResourceGroup
+	err := p.store.UpdateGroups(func(groups []ResourceGroup) ([]ResourceGroup, error) {
+		g := groupByID(groups, id)
+		if g == nil {
+			return nil, errNoGroup
+		}
+		if other := findGroup(groups, upd.Name); other != nil && other.ID != id {
+			return nil, fmt.Errorf("group %q already exists", upd.Name)
+		}
+		if err := checkGroupParent(groups, id, upd.ParentID); err != nil {
+			return nil, err
+		}
+		g.Name, g.Icon, g.Description, g.ParentID = upd.Name, upd.Icon, upd.Description, upd.ParentID
+		out = *g
+		return groups, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// deleteGroup removes group id; its subgroups and resources move up to its
+// parent.
+func (p *Plugin) deleteGroup(actorID, id string) (*ResourceGroup, error) {
+	if !p.canManage(actorID, nil) {
+		return nil, errNotManager
+	}
+	var deleted ResourceGroup
+	err := p.store.UpdateGroups(func(groups []ResourceGroup) ([]ResourceGroup, error) {
+		g := groupByID(groups, id)
+		if g == nil {
+			return nil, errNoGroup
+		}
+		deleted = *g
+		out := make([]ResourceGroup, 0, len(groups))
+		for _, other := range groups {
+			if other.ID == id {
+				continue
+			}
+			if other.ParentID == id {
+				other.ParentID = deleted.ParentID
+			}
+			out = append(out, other)
+		}
+		return out, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	resources, _ := p.store.GetAllResources()
+	for _, r := range resources {
+		if r.GroupID == id {
+			r.GroupID = deleted.ParentID
+			if err := p.store.SaveResource(r); err != nil {
+				p.API.LogWarn("deleteGroup: SaveResource", "resource", r.ID, "err", err.Error())
+			}
+		}
+	}
+	p.store.del(prefixSubs + groupSubsID(id))
+	return &deleted, nil
+}
+
+// setResourceGroup moves res into the group ref ("" or "none" for top level)
+// on behalf of actorID, a manager of res.
+func (p *Plugin) setResourceGroup(res *Resource, actorID, ref string) (*ResourceGroup, error) {
+	if !p.canManage(actorID, res) {
+		return nil, errNotManager
+	}
+	var g *ResourceGroup
+	if ref != "" && ref != "none" {
+		groups, err := p.store.GetGroups()
+		if err != nil {
+			return nil, err
+		}
+		if g = findGroup(groups, ref); g == nil {
+			return nil, errNoGroup
+		}
+		res.GroupID = g.ID
+	} else {
+		res.GroupID = ""
+	}
+	return g, p.store.SaveResource(res)
+}
+
+// notifyFreed tells the subscribers of res, and of every group above it who
+// does not already follow res, that a seat of res has freed up.
+func (p *Plugin) notifyFreed(res *Resource, text string) {
+	p.notifySubscribers(res.ID, text, "")
+	if res.GroupID == "" {
+		return
+	}
+	told := map[string]bool{}
+	subs, _ := p.store.GetSubscribers(res.ID)
+	for _, uid := range subs {
+		told[uid] = true
+	}
+	groups, _ := p.store.GetGroups()
+	for _, gid := range ancestorIDs(groups, res.GroupID) {
+		gsubs, _ := p.store.GetSubscribers(groupSubsID(gid))
+		for _, uid := range gsubs {
+			if told[uid] || !p.canAccess(uid, res) {
+				continue
+			}
+			told[uid] = true
+			p.sendDM(uid, fmt.Sprintf("%s · 📁 %s", text, groupPath(groups, res.GroupID)))
+		}
+	}
+}
+
+// groupSection is a run of resources under one group heading in a listing.
+type groupSection struct {
+	Group     *ResourceGroup // nil for ungrouped resources
+	Path      string
+	Depth     int
+	Resources []*Resource
+}
+
+// groupSections orders resources by the group tree: ungrouped resources
+// first, then each group depth first with its own resources before its
+// subgroups. Groups without any of the resources in their subtree are left out.
+func groupSections(groups []ResourceGroup, resources []*Resource) []groupSection {
+	byGroup := map[string][]*Resource{}
+	for _, r := range resources {
+		gid := r.GroupID
+		if gid != "" && groupByID(groups, gid) == nil {
+			gid = "" // dangling reference: show it at the top level
+		}
+		byGroup[gid] = append(byGroup[gid], r)
+	}
+	children := map[string][]ResourceGroup{}
+	for _, g := range groups {
+		children[g.ParentID] = append(children[g.ParentID], g)
+	}
+	for _, c := range children {
+		sort.Slice(c, func(i, j int) bool { return c[i].Name < c[j].Name })
+	}
+	var count func(id string) int
+	count = func(id string) int {
+		n := len(byGroup[id])
+		for _, c := range children[id] {
+			n += count(c.ID)
+		}
+		return n
+	}
+	var out []groupSection
+	if len(byGroup[""]) > 0 {
+		out = append(out, groupSection{Resources: byGroup[""]})
+	}
+	var walk func(parentID string, depth int)
+	walk = func(parentID string, depth int) {
+		for i := range children[parentID] {
+			g := &children[parentID][i]
+			if depth >= maxGroupDepth || count(g.ID) == 0 {
+				continue
+			}
+			out = append(out, groupSection{Group: g, Path: groupPath(groups, g.ID), Depth: depth, Resources: byGroup[g.ID]})
+			walk(g.ID, depth+1)
+		}
+	}
+	walk("", 0)
+	return out
+}
+
+// groupHeading renders the heading of a listing section: "📁 **Lab 2 › Rack 1**".
+func groupHeading(sec groupSection) string {
+	icon := sec.Group.Icon
+	if icon == "" {
+		icon = "📁"
+	}
+	text := fmt.Sprintf("%s **%s**", icon, sec.Path)
+	if sec.Group.Description != "" {
+		text += " — _" + sec.Group.Description + "_"
+	}
+	return text
+}
+
+// buildGroupTree arranges resources into the group tree.
+func (p *Plugin) buildGroupTree(groups []ResourceGroup, resources []*Resource, isFree func(*Resource) bool, currentUserID string) []GroupNode {
+	byGroup := map[string][]*Resource{}
+	for _, r := range resources {
+		if r.GroupID != "" {
+			byGroup[r.GroupID] = append(byGroup[r.GroupID], r)
+		}
+	}
+	var build func(parentID string, depth int) []GroupNode
+	build = func(parentID string, depth int) []GroupNode {
+		nodes := []GroupNode{}
+		if depth >= maxGroupDepth {
+			return nodes
+		}
+		for _, g := range groups {
+			if g.ParentID != parentID {
+				continue
+			}
+			node := GroupNode{Group: g, ResourceIDs: []string{}, Children: build(g.ID, depth+1)}
+			for _, r := range byGroup[g.ID] {
+				node.ResourceIDs = append(node.ResourceIDs, r.ID)
+				node.Total++
+				if isFree(r) {
+					node.Free++
+				}
+			}
+			for _, c := range node.Children {
+				node.Free += c.Free
+				node.Total += c.Total
+			}
+			if node.Total == 0 {
+				continue
+			}
+			node.IsSubscribed = p.store.IsSubscribed(groupSubsID(g.ID), currentUserID)
+			nodes = append(nodes, node)
+		}
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i].Group.Name < nodes[j].Group.Name })
+		return nodes
+	}
+	return build("", 0)
+}
+
+// groupErrText renders group failures for chat responses, or "".
+func groupErrText(err error) string {
+	switch {
+	case errors.Is(err, errNoGroup):
+		return "Группа ресурсов не найдена"
+	case errors.Is(err, errGroupCycle):
+		return "Группу нельзя вложить в саму себя или в свою подгруппу"
+	case errors.Is(err, errGroupDepth):
+		return fmt.Sprintf("Группы вкладываются не глубже %d уровней", maxGroupDepth)
+	case errors.Is(err, errNotManager):
+		return "🚫 Группами ресурсов управляют глобальные менеджеры"
+	}
+	return ""
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// Resource index. Listing N resources used to take a KV read per resource and
+// three more per status, which does not scale past a few hundred. The index
+// keeps a compact copy of what listings and the scheduler need — the resource,
+// its bookings, queue and subscribers, and how much scheduled work it has — in
+// indexShards KV values picked by a hash of the resource ID, so a full listing
+// is indexShards reads however many resources there are.
+//
+// Every store mutation refreshes the part of the entry it changed. The refresh
+// re-reads the source key inside the shard's compare-and-set, so of two
+// concurrent writers the later refresh always sees the later value. A refresh
+// that still fails, say after casRetries on a busy shard, puts the resource on
+// a dirty list, and the scheduler rebuilds listed entries at the start of its
+// next tick; an entry is stale until then at most. The per-resource keys stay
+// the source of truth: single-resource paths keep reading them, and the index
+// is rebuilt from them, found with KVList, whenever indexVersion changes.
+
+const (
+	prefixIndex     = "idx:"
+	keyIndexVersion = "idx_version"
+	keyIndexDirty   = "idx_dirty"
+	indexVersion    = 1
+	indexShards     = 64
+	kvListPage      = 1000
+)
+
+// indexEntry is the indexed state of one resource. Bookings include expired
+// ones not yet taken by the scheduler, like GetBookingsRaw.
+type indexEntry struct {
+	Resource     Resource     `json:"r"`
+	Bookings     []Booking    `json:"b,omitempty"`
+	Queue        []QueueEntry `json:"q,omitempty"`
+	Subscribers  []string     `json:"s,omitempty"`
+	Reservations int          `json:"rsv,omitempty"`
+	Rules        int          `json:"rec,omitempty"`
+	Approvals    int          `json:"apr,omitempty"`
+}
+
+// active returns the bookings that still occupy a seat.
+func (e *indexEntry) active() []Booking {
+	bs := bookingSet{Bookings: e.Bookings}
+	return bs.active()
+}
+
+// free reports whether the resource can take one more holder right now; the
+// index counterpart of hasFreeSeat.
+func (e *indexEntry) free() bool {
+	return !inMaintenance(&e.Resource) && len(e.active()) < e.Resource.Seats()
+}
+
+type indexShard struct {
+	Entries map[string]*indexEntry `json:"e"`
+}
+
+// shardOf returns the index shard holding resource id.
+func shardOf(id string) int {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() % indexShards)
+}
+
+func shardKey(n int) string {
+	return fmt.Sprintf("%s%02d", prefixIndex, n)
+}
+
+// errNotIndexed aborts an index refresh for IDs that are not resources: pool
+// queues and group subscriptions share the queue and subscription keys.
+var errNotIndexed = errors.New("not indexed")
+
+// reindex refreshes the entry of resource id with fn, which re-reads whatever
+// source key changed. The mutation itself has succeeded by then, so a failure
+// is not returned but marks the entry dirty for RepairIndex.
+func (s *Store) reindex(id string, fn func(e *indexEntry) error) {
+	err := update(s, shardKey(shardOf(id)), func(sh *indexShard) (*indexShard, error) {
+		if sh == nil || sh.Entries[id] == nil {
+			return nil, errNotIndexed
+		}
+		if err := fn(sh.Entries[id]); err != nil {
+			return nil, err
+		}
+		return sh, nil
+	})
+	switch {
+	case err == nil:
+		s.resourceChanged(id)
+	case !errors.Is(err, errNotIndexed):
+		s.api.LogWarn("reindex", "resource", id, "err", err.Error())
+		s.markDirty(id)
+	}
+}
+
+// markDirty lists resource id for RepairIndex.
+func (s *Store) markDirty(id string) {
+	err := update(s, keyIndexDirty, func(ids *[]string) (*[]string, error) {
+		if ids == nil {
+			ids = &[]string{}
+		}
+		if !containsString(*ids, id) {
+			*ids = append(*ids, id)
+		}
+		return ids, nil
+	})
+	if err != nil {
+		s.api.LogError("Resource index entry left stale", "resource", id, "err", err.Error())
+	}
+}
+
+// RepairIndex rebuilds the entries marked dirty by failed refreshes. The list
+// is taken before rebuilding, so a resource marked again meanwhile is
+// repaired on the next call; one whose rebuild fails goes back on the list.
+func (s *Store) RepairIndex() error {
+	var dirty []string
+	err := update(s, keyIndexDirty, func(ids *[]string) (*[]string, error) {
+		if ids != nil {
+			dirty = *ids
+		}
+		return nil, nil
+	})
+	if err != nil || len(dirty) == 0 {
+		return err
+	}
+	byShard := map[int][]string{}
+	for _, id := range dirty {
+		byShard[shardOf(id)] = append(byShard[shardOf(id)], id)
+	}
+	for n, ids := range byShard {
+		if _, err := s.rebuildShard(n, ids); err != nil {
+			for _, id := range ids {
+				s.markDirty(id)
+			}
+			return err
+		}
+		for _, id := range ids {
+			s.resourceChanged(id)
+		}
+	}
+	return nil
+}
+
+func (s *Store) resourceChanged(id string) {
+	if s.OnResourceChange != nil {
+		s.OnResourceChange(id)
+	}
+}
+
+// indexResource adds or replaces the resource in its entry, or drops the entry
+// if the resource is gone.
+func (s *Store) indexResource(id string) error {
+	err := update(s, shardKey(shardOf(id)), func(sh *indexShard) (*indexShard, error) {
+		r, err := s.GetResource(id)
+		if err != nil {
+			return nil, err
+		}
+		if sh == nil {
+			sh = &indexShard{}
+		}
+		if sh.Entries == nil {
+			sh.Entries = map[string]*indexEntry{}
+		}
+		switch e := sh.Entries[id]; {
+		case r == nil:
+			delete(sh.Entries, id)
+		case e == nil:
+			if sh.Entries[id], err = s.loadIndexEntry(r); err != nil {
+				return nil, err
+			}
+		default:
+			e.Resource = *r
+		}
+		if len(sh.Entries) == 0 {
+			return nil, nil
+		}
+		return sh, nil
+	})
+	if err != nil {
+		s.markDirty(id)
+		return err
+	}
+	s.resourceChanged(id)
+	return nil
+}
+
+func (s *Store) indexBookings(id string) {
+	s.reindex(id, func(e *indexEntry) (err error) {
+		e.Bookings, err = s.GetBookingsRaw(id)
+		return err
+	})
+}
+
+func (s *Store) indexQueue(id string) {
+	s.reindex(id, func(e *indexEntry) (err error) {
+		e.Queue, err = s.GetQueueEntries(id)
+		return err
+	})
+}
+
+func (s *Store) indexSubs(id string) {
+	s.reindex(id, func(e *indexEntry) (err error) {
+		e.Subscribers, err = s.GetSubscribers(id)
+		return err
+	})
+}
+
+func (s *Store) indexReservations(id string) {
+	s.reindex(id, func(e *indexEntry) error {
+		rsvs, err := s.GetReservations(id)
+		e.Reservations = len(rsvs)
+		return err
+	})
+}
+
+func (s *Store) indexRules(id string) {
+	s.reindex(id, func(e *indexEntry) error {
+		rules, err := s.GetRecurringRules(id)
+		e.Rules = len(rules)
+		return err
+	})
+}
+
+func (s *Store) indexApprovals(id string) {
+	s.reindex(id, func(e *indexEntry) error {
+		reqs, err := s.GetApprovalRequests(id)
+		e.Approvals = len(reqs)
+		return err
+	})
+}
+
+// loadIndexEntry reads every indexed part of r from its source keys.
+func (s *Store) loadIndexEntry(r *Resource) (*indexEntry, error) {
+	e := &indexEntry{Resource: *r}
+	var err error
+	if e.Bookings, err = s.GetBookingsRaw(r.ID); err != nil {
+		return nil, err
+	}
+	if e.Queue, err = s.GetQueueEntries(r.ID); err != nil {
+		return nil, err
+	}
+	if e.Subscribers, err = s.GetSubscribers(r.ID); err != nil {
+		return nil, err
+	}
+	rsvs, err := s.GetReservations(r.ID)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := s.GetRecurringRules(r.ID)
+	if err != nil {
+		return nil, err
+	}
+	reqs, err := s.GetApprovalRequests(r.ID)
+	if err != nil {
+		return nil, err
+	}
+	e.Reservations, e.Rules, e.Approvals = len(rsvs), len(rules), len(reqs)
+	return e, nil
+}
+
+// IndexEntry returns the indexed state of resource id, or nil if there is no
+// such resource.
+func (s *Store) IndexEntry(id string) (*indexEntry, error) {
+	var sh indexShard
+	if err := s.get(shardKey(shardOf(id)), &sh); err != nil {
+		return nil, err
+	}
+	return sh.Entries[id], nil
+}
+
+// IndexEntries returns the indexed state of every resource, ordered by name.
+func (s *Store) IndexEntries() ([]*indexEntry, error) {
+	var out []*indexEntry
+	for i := 0; i < indexShards; i++ {
+		var sh indexShard
+		if err := s.get(shardKey(i), &sh); err != nil {
+			return nil, err
+		}
+		for _, e := range sh.Entries {
+			out = append(out, e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := strings.ToLower(out[i].Resource.Name), strings.ToLower(out[j].Resource.Name)
+		if a != b {
+			return a < b
+		}
+		return out[i].Resource.ID < out[j].Resource.ID
+	})
+	return out, nil
+}
+
+// EnsureIndex rebuilds the index if it was built by another version of the
+// plugin, or never. Nodes activating together may both rebuild; the shard
+// writes are compare-and-set, so that only costs time.
+func (s *Store) EnsureIndex() error {
+	var version int
+	if err := s.get(keyIndexVersion, &version); err != nil {
+		return err
+	}
+	if version == indexVersion {
+		return nil
+	}
+	n, err := s.RebuildIndex()
+	if err != nil {
+		return err
+	}
+	s.api.LogInfo("Resource index rebuilt", "resources", n)
+	return update(s, keyIndexVersion, func(cur *int) (*int, error) {
+		v := indexVersion
+		return &v, nil
+	})
+}
+
+// RebuildIndex rewrites every shard from the resources found in the KV store
+// and returns how many there are. The scan only collects IDs: each shard is
+// then rebuilt inside its compare-and-set from the source keys, together with
+// entries that were added while scanning, so concurrent mutations are not
+// lost.
+func (s *Store) RebuildIndex() (int, error) {
+	ids := make([][]string, indexShards)
+	for page := 0; ; page++ {
+		keys, appErr := s.api.KVList(page, kvListPage)
+		if appErr != nil {
+			return 0, fmt.Errorf("kvlist: %v", appErr)
+		}
+		for _, key := range keys {
+			if id, ok := strings.CutPrefix(key, prefixResource); ok {
+				n := shardOf(id)
+				ids[n] = append(ids[n], id)
+			}
+		}
+		if len(keys) < kvListPage {
+			break
+		}
+	}
+	count := 0
+	for n := range ids {
+		built, err := s.rebuildShard(n, ids[n])
+		if err != nil {
+			return 0, err
+		}
+		count += built
+	}
+	s.del(keyResourceList) // superseded by the index
+	return count, nil
+}
+
+// rebuildShard rewrites shard n from the source keys of ids and of the
+// entries already in it, inside the shard's compare-and-set, and returns how
+// many entries it holds.
+func (s *Store) rebuildShard(n int, ids []string) (int, error) {
+	var built int
+	err := update(s, shardKey(n), func(sh *indexShard) (*indexShard, error) {
+		seen := map[string]bool{}
+		want := ids
+		if sh != nil {
+			for id := range sh.Entries {
+				want = append(want[:len(want):len(want)], id)
+			}
+		}
+		out := &indexShard{Entries: map[string]*indexEntry{}}
+		for _, id := range want {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			r, err := s.GetResource(id)
+			if err != nil || r == nil {
+				continue
+			}
+			e, err := s.loadIndexEntry(r)
+			if err != nil {
+				return nil, err
+			}
+			out.Entries[id] = e
+		}
+		built = len(out.Entries)
+		if built == 0 {
+			return nil, nil
+		}
+		return out, nil
+	})
+	return built, err
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Maintenance mode. A manager takes a resource out of service, now or from a
+// set time, with a reason and an optional end. While it lasts the resource
+// cannot be booked, queued for, reserved or requested; the queue is kept and
+// served once maintenance ends. Scheduling it ahead warns the holders whose
+// bookings run past the start; at the start their bookings are cut short. The
+// scheduler enters and leaves maintenance and tells subscribers both times.
+// Only the Maintenance field is written, in a compare-and-set on the stored
+// resource, so neither side undoes a concurrent edit of the other.
+
+var (
+	errMaintenance    = errors.New("resource is under maintenance")
+	errBadMaintenance = errors.New("maintenance must end after it starts")
+	// errMaintenanceGone aborts a scheduled start or end that a manager has
+	// changed in the meantime.
+	errMaintenanceGone = errors.New("maintenance changed")
+)
+
+// inMaintenance reports whether res is out of service right now.
+func inMaintenance(res *Resource) bool {
+	return res.Maintenance.Active(time.Now())
+}
+
+// scheduleMaintenance puts res into maintenance from start (now if zero) until
+// end (open-ended if zero) on behalf of actorID.
+func (p *Plugin) scheduleMaintenance(res *Resource, actorID, reason string, start, end time.Time) error {
+	if !p.canManage(actorID, res) {
+		return errNotManager
+	}
+	now := time.Now()
+	if start.Before(now) {
+		start = now
+	}
+	if !end.IsZero() && !end.After(start) {
+		return errBadMaintenance
+	}
+	m := &Maintenance{
+		Reason: truncate(reason, maxDescLen), StartsAt: start, EndsAt: end, By: actorID,
+	}
+	updated, err := p.store.UpdateResource(res.ID, func(cur *Resource) error {
+		cur.Maintenance = m
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	*res = *updated
+	if !start.After(now) {
+		p.beginMaintenance(res)
+		return nil
+	}
+	bookings, _ := p.store.GetBookings(res.ID)
+	for _, b := range bookings {
+		if b.ExpiresAt.After(start) {
+			p.sendDM(b.UserID, fmt.Sprintf("🛠 С %s **%s** уходит на обслуживание%s — ваша бронь будет прервана.",
+				start.Format("02.01 15:04"), res.Name, maintenanceReason(res.Maintenance)))
+		}
+	}
+	return nil
+}
+
+// beginMaintenance ends every booking of res and tells its holders and
+// subscribers. A pending hold goes back to the head of the queue.
+func (p *Plugin) beginMaintenance(res *Resource) {
+	updated, err := p.store.UpdateResource(res.ID, func(cur *Resource) error {
+		m := cur.Maintenance
+		if m == nil || m.Started || time.Now().Before(m.StartsAt) {
+			return errMaintenanceGone
+		}
+		m.Started = true
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, errMaintenanceGone) {
+			p.API.LogWarn("beginMaintenance: UpdateResource", "resource", res.ID, "err", err.Error())
+		}
+		return
+	}
+	*res = *updated
+	m := res.Maintenance
+	bookings, _ := p.store.GetBookings(res.ID)
+	for _, b := range bookings {
+		taken, err := p.store.TakeBooking(res.ID, b.UserID, func(cur *Booking) error {
+			if !cur.StartedAt.Equal(b.StartedAt) {
+				return ErrConflict
+			}
+			return nil
+		})
+		if err != nil {
+			continue
+		}
+		if taken.Hold {
+			entry := QueueEntry{UserID: taken.UserID, DesiredDuration: taken.Desired, Purpose: taken.Purpose, QueuedAt: taken.StartedAt}
+			if entries, _ := p.store.GetQueueEntries(res.ID); len(entries) > 0 && entries[0].QueuedAt.Before(entry.QueuedAt) {
+				entry.QueuedAt = entries[0].QueuedAt.Add(-time.Millisecond)
+			}
+			p.store.AddToQueue(res.ID, entry, p.limitsFor(res).QueueLimit+1)
+			p.sendDM(taken.UserID, fmt.Sprintf("🛠 **%s** ушёл на обслуживание%s. Вы остаётесь первым в очереди.",
+				res.Name, maintenanceReason(m)))
+			continue
+		}
+		p.store.AddHistory(taken.History(time.Now()))
+		if taken.BundleID != "" {
+			p.cleanupBundle(taken.BundleID)
+		}
+		p.sendDM(taken.UserID, fmt.Sprintf("⛔ Бронирование **%s** прервано: ресурс ушёл на обслуживание%s.",
+			res.Name, maintenanceReason(m)))
+	}
+	p.notifySubscribers(res.ID, fmt.Sprintf("🛠 **%s** на обслуживании%s%s", res.Name, maintenanceUntil(m), maintenanceReason(m)), "")
+}
+
+// endMaintenance returns res to service and offers its free seats to the queue.
+func (p *Plugin) endMaintenance(res *Resource, actorID string) error {
+	if actorID != "" && !p.canManage(actorID, res) {
+		return errNotManager
+	}
+	var started bool
+	updated, err := p.store.UpdateResource(res.ID, func(cur *Resource) error {
+		m := cur.Maintenance
+		// The scheduler only ends maintenance that is still due to end.
+		if m == nil || (actorID == "" && (m.EndsAt.IsZero() || time.Now().Before(m.EndsAt))) {
+			return errMaintenanceGone
+		}
+		started = m.Started
+		cur.Maintenance = nil
+		return nil
+	})
+	if errors.Is(err, errMaintenanceGone) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	*res = *updated
+	if !started {
+		return nil // called off before it began; nobody was told it had
+	}
+	p.notifyFreed(res, fmt.Sprintf("✅ **%s** снова в строю", res.Name))
+	for i := 0; i < res.Seats() && p.hasFreeSeat(res); i++ {
+		p.processQueue(res.ID, res.Name)
+	}
+	return nil
+}
+
+// checkMaintenance enters or leaves maintenance on schedule. Called by the
+// scheduler.
+func (p *Plugin) checkMaintenance(res *Resource) {
+	m := res.Maintenance
+	if m == nil {
+		return
+	}
+	now := time.Now()
+	if !m.EndsAt.IsZero() && !now.Before(m.EndsAt) {
+		if err := p.endMaintenance(res, ""); err != nil {
+			p.API.LogWarn("checkMaintenance: endMaintenance", "resource", res.ID, "err", err.Error())
+		}
+		return
+	}
+	if !m.Started && !now.Before(m.StartsAt) {
+		p.beginMaintenance(res)
+	}
+}
+
+// maintenanceWarning returns a chat note if a booking of res lasting until
+// `until` runs into scheduled maintenance, or "" otherwise.
+func maintenanceWarning(res *Resource, until time.Time) string {
+	m := res.Maintenance
+	if m == nil || m.Started || !m.StartsAt.Before(until) {
+		return ""
+	}
+	return fmt.Sprintf("\n⚠️ С %s ресурс уходит на обслуживание — ваша бронь будет прервана.", m.StartsAt.Format("02.01 15:04"))
+}
+
+// describeMaintenance renders the maintenance state of res for chat, or "".
+func (p *Plugin) describeMaintenance(res *Resource) string {
+	m := res.Maintenance
+	if m == nil {
+		return ""
+	}
+	if !inMaintenance(res) {
+		return fmt.Sprintf("🛠 запланировано с %s%s%s", m.StartsAt.Format("02.01 15:04"), maintenanceUntil(m), maintenanceReason(m))
+	}
+	return fmt.Sprintf("🛠 На обслуживании%s%s (%s)", maintenanceUntil(m), maintenanceReason(m), p.displayName(m.By))
+}
+
+func maintenanceUntil(m *Maintenance) string {
+	if m.EndsAt.IsZero() {
+		return ""
+	}
+	return " до " + m.EndsAt.Format("02.01 15:04")
+}
+
+func maintenanceReason(m *Maintenance) string {
+	if m.Reason == "" {
+		return ""
+	}
+	return ": " + m.Reason
+}
@@ -3,17 +3,23 @@ package main
 import "time"
 
 const (
-	pluginID     = "com.scientia.resource-queue"
-	botUsername  = "resource-queue"
-	maxHistory   = 200
-	maxQueueSize = 50
-	maxResources = 100
-	maxVarKeyLen = 64
-	maxVarValLen = 256
-	maxNameLen   = 100
-	maxIPLen     = 45 // IPv6
-	maxDescLen   = 500
-	maxPurposeLen = 200
+	pluginID        = "com.scientia.resource-queue"
+	botUsername     = "resource-queue"
+	maxHistory      = 200
+	maxQueueSize    = 50
+	maxVarKeyLen    = 64
+	maxVarValLen    = 256
+	maxNameLen      = 100
+	maxIPLen        = 45 // IPv6
+	maxDescLen      = 500
+	maxPurposeLen   = 200
+	maxReservations = 100
+	maxReserveAhead = 90 * 24 * time.Hour
+	maxRecurring    = 20
+	maxCapacity     = 100
+	maxBundleSize   = 10
+	maxPerPage      = 200
+	recurLookahead  = 24 * time.Hour
 )
 
 type Resource struct {
@@ -23,8 +29,132 @@ type Resource struct {
 	Icon        string            `json:"icon,omitempty"`
 	Description string            `json:"description,omitempty"`
 	Variables   map[string]string `json:"variables,omitempty"`
-	CreatedAt   time.Time         `json:"created_at"`
-	CreatedBy   string            `json:"created_by"`
+	// Pool groups interchangeable resources that can be booked as "any free".
+	Pool string `json:"pool,omitempty"`
+	// Tags are normalized free-form labels used to filter listings.
+	Tags []string `json:"tags,omitempty"`
+	// GroupID places the resource in a resource group; empty means top level.
+	GroupID string `json:"group_id,omitempty"`
+	// Capacity is the number of concurrent holders (seats); 0 means 1.
+	Capacity int `json:"capacity,omitempty"`
+	// Handoff is what happens to a freed seat: HandoffClaim holds it for the
+	// queue head, HandoffAuto books it for them right away.
+	Handoff string `json:"handoff,omitempty"`
+	// Policy overrides the global booking limits for this resource.
+	Policy *Policy `json:"policy,omitempty"`
+	// Approval, if set, makes bookings wait for an approver's decision.
+	Approval *Approval `json:"approval,omitempty"`
+	// Access, if set, limits who sees and books the resource.
+	Access *Access `json:"access,omitempty"`
+	// Managers may edit the resource and act on its bookings and queue.
+	Managers *Managers `json:"managers,omitempty"`
+	// Maintenance, if set, takes the resource out of service for a while.
+	Maintenance *Maintenance `json:"maintenance,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	CreatedBy   string       `json:"created_by"`
+}
+
+// Policy holds per-resource booking limits. Zero fields fall back to the
+// plugin settings (or built-in defaults).
+type Policy struct {
+	MaxMinutes        int   `json:"max_minutes,omitempty"`        // longest booking, extensions included
+	MaxExtendMinutes  int   `json:"max_extend_minutes,omitempty"` // total time extensions may add
+	WarnBeforeMinutes int   `json:"warn_before_minutes,omitempty"`
+	DefaultMinutes    int   `json:"default_minutes,omitempty"`
+	Presets           []int `json:"presets,omitempty"` // if set, the only durations allowed
+	QueueLimit        int   `json:"queue_limit,omitempty"`
+	// TransferReset gives a transferred booking a fresh default duration
+	// instead of keeping the remaining time.
+	TransferReset bool `json:"transfer_reset,omitempty"`
+}
+
+// Approval lists who may approve bookings of a resource: individual users
+// and the members of a Mattermost group.
+type Approval struct {
+	Users []string `json:"users,omitempty"` // user IDs
+	Group string   `json:"group,omitempty"` // group name
+}
+
+// Access lists who may see and use a resource: members of the teams,
+// channels and groups, and individual users. Admins always may.
+type Access struct {
+	Teams    []string `json:"teams,omitempty"`    // team IDs
+	Channels []string `json:"channels,omitempty"` // channel IDs
+	Groups   []string `json:"groups,omitempty"`   // group names
+	Users    []string `json:"users,omitempty"`    // user IDs
+}
+
+// Managers are the users and groups holding the resource manager role,
+// either for one resource or, stored globally, for all of them.
+type Managers struct {
+	Users  []string `json:"users,omitempty"`  // user IDs
+	Groups []string `json:"groups,omitempty"` // group names
+}
+
+// ResourceGroup organizes resources into a tree, such as a lab holding racks
+// holding machines. Resources point at their group with Resource.GroupID.
+type ResourceGroup struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Icon        string    `json:"icon,omitempty"`
+	Description string    `json:"description,omitempty"`
+	ParentID    string    `json:"parent_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	CreatedBy   string    `json:"created_by"`
+}
+
+// Board is a channel post the plugin keeps rewriting with the current
+// /rq list, narrowed by the filter arguments in Filter.
+type Board struct {
+	PostID    string    `json:"post_id"`
+	ChannelID string    `json:"channel_id"`
+	TeamID    string    `json:"team_id,omitempty"`
+	Filter    []string  `json:"filter,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	CreatedBy string    `json:"created_by"`
+}
+
+// Maintenance is a period when a resource cannot be booked or queued for,
+// from StartsAt until EndsAt, or until ended by hand if EndsAt is zero.
+// Started records that the resource has entered it and the holders were cut off.
+type Maintenance struct {
+	Reason   string    `json:"reason,omitempty"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	By       string    `json:"by"`
+	Started  bool      `json:"started,omitempty"`
+}
+
+// Active reports whether the maintenance is under way at t.
+func (m *Maintenance) Active(t time.Time) bool {
+	return m != nil && !t.Before(m.StartsAt) && (m.EndsAt.IsZero() || t.Before(m.EndsAt))
+}
+
+// ApprovalRequest is a booking waiting for an approver. Posts maps each
+// approver to the DM with the Approve/Reject buttons they were sent.
+type ApprovalRequest struct {
+	ID          string            `json:"id"`
+	ResourceID  string            `json:"resource_id"`
+	UserID      string            `json:"user_id"`
+	Duration    time.Duration     `json:"duration"`
+	Purpose     string            `json:"purpose,omitempty"`
+	RequestedAt time.Time         `json:"requested_at"`
+	ExpiresAt   time.Time         `json:"expires_at"`
+	Posts       map[string]string `json:"posts,omitempty"`
+}
+
+// Handoff policies for a freed seat.
+const (
+	HandoffClaim = ""
+	HandoffAuto  = "auto"
+)
+
+// Seats returns how many users may hold the resource at the same time.
+func (r *Resource) Seats() int {
+	if r.Capacity < 1 {
+		return 1
+	}
+	return r.Capacity
 }
 
 type Booking struct {
@@ -35,17 +165,142 @@ type Booking struct {
 	ExpiresAt     time.Time `json:"expires_at"`
 	NotifiedSoon  bool      `json:"notified_soon"`
 	NotifiedQueue bool      `json:"notified_queue"`
+	// ReservationID is set when the booking was started from a reservation.
+	ReservationID string `json:"reservation_id,omitempty"`
+	// BundleID links bookings made together as one bundle.
+	BundleID string `json:"bundle_id,omitempty"`
+	// Hold marks a seat kept for the head of the queue during the claim
+	// window; ExpiresAt is the claim deadline and Desired the duration the
+	// booking gets once claimed.
+	Hold    bool          `json:"hold,omitempty"`
+	Desired time.Duration `json:"desired,omitempty"`
+	// Handoff is set when the booking was handed over automatically from the
+	// queue (HandoffAuto resources).
+	Handoff bool `json:"handoff,omitempty"`
+	// Extended is the time added by extensions so far.
+	Extended time.Duration `json:"extended,omitempty"`
+	// PreemptedBy is set while the booking is being preempted: it ends at
+	// ExpiresAt, the end of the grace period, and the seat goes to
+	// PreemptedBy. PreemptPostID is the holder's countdown DM.
+	PreemptedBy   string `json:"preempted_by,omitempty"`
+	PreemptReason string `json:"preempt_reason,omitempty"`
+	PreemptPostID string `json:"preempt_post_id,omitempty"`
+	// TransferTo is the user a pending transfer offer was sent to;
+	// TransferredFrom the previous holder of a transferred booking.
+	TransferTo      string `json:"transfer_to,omitempty"`
+	TransferredFrom string `json:"transferred_from,omitempty"`
+	// BookedBy is the admin or manager who booked for UserID, if not
+	// UserID themselves; ApprovedBy the approver of a booking request.
+	BookedBy   string `json:"booked_by,omitempty"`
+	ApprovedBy string `json:"approved_by,omitempty"`
+	// Ended is set by the scheduler on an expired booking before recording
+	// its history, so a tick cut short after that can redo the rest.
+	Ended bool `json:"ended,omitempty"`
 }
 
 func (b *Booking) IsExpired() bool {
 	return time.Now().After(b.ExpiresAt)
 }
 
+// History returns the history record for b ending at ended.
+func (b *Booking) History(ended time.Time) HistoryEntry {
+	return HistoryEntry{
+		UserID: b.UserID, ResourceID: b.ResourceID, Purpose: b.Purpose,
+		StartedAt: b.StartedAt, EndedAt: ended, BundleID: b.BundleID,
+		Handoff: b.Handoff, PreemptedBy: b.PreemptedBy, PreemptReason: b.PreemptReason,
+		TransferredFrom: b.TransferredFrom, BookedBy: b.BookedBy, ApprovedBy: b.ApprovedBy,
+	}
+}
+
+// Bundle is a set of resources booked, extended and released as one unit.
+type Bundle struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	ResourceIDs []string  `json:"resource_ids"`
+	Purpose     string    `json:"purpose,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// BundleQueueEntry waits for every resource of a set to be free at once.
+type BundleQueueEntry struct {
+	UserID          string        `json:"user_id"`
+	ResourceIDs     []string      `json:"resource_ids"`
+	DesiredDuration time.Duration `json:"desired_duration"`
+	Purpose         string        `json:"purpose,omitempty"`
+	QueuedAt        time.Time     `json:"queued_at"`
+}
+
 type QueueEntry struct {
 	UserID          string        `json:"user_id"`
 	DesiredDuration time.Duration `json:"desired_duration"`
 	Purpose         string        `json:"purpose,omitempty"`
 	QueuedAt        time.Time     `json:"queued_at"`
+	// Priority orders the queue before QueuedAt: PriorityNormal, PriorityHigh
+	// or PriorityUrgent.
+	Priority int `json:"priority,omitempty"`
+}
+
+// Queue priorities.
+const (
+	PriorityNormal = iota
+	PriorityHigh
+	PriorityUrgent
+)
+
+// PriorityClass lets users with one of the system roles or in one of the
+// user groups queue with priorities up to Level.
+type PriorityClass struct {
+	Level  int      `json:"level"`
+	Roles  []string `json:"roles,omitempty"`
+	Groups []string `json:"groups,omitempty"` // group names
+}
+
+// Reservation is a booking scheduled for the future. The scheduler turns it
+// into a live Booking at StartsAt.
+type Reservation struct {
+	ID         string    `json:"id"`
+	ResourceID string    `json:"resource_id"`
+	UserID     string    `json:"user_id"`
+	Purpose    string    `json:"purpose,omitempty"`
+	StartsAt   time.Time `json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	// RuleID is set when the reservation was expanded from a RecurringRule.
+	RuleID string `json:"rule_id,omitempty"`
+}
+
+func (r *Reservation) Overlaps(start, end time.Time) bool {
+	return r.StartsAt.Before(end) && start.Before(r.EndsAt)
+}
+
+// Recurrence kinds of a RecurringRule.
+const (
+	RecurDaily    = "daily"
+	RecurWeekdays = "weekdays"
+	RecurWeekly   = "weekly"
+	RecurCron     = "cron"
+)
+
+// RecurringRule books a resource on a repeating schedule. The scheduler
+// expands it into concrete Reservations recurLookahead in advance.
+type RecurringRule struct {
+	ID         string `json:"id"`
+	ResourceID string `json:"resource_id"`
+	UserID     string `json:"user_id"`
+	Purpose    string `json:"purpose,omitempty"`
+	Kind       string `json:"kind"`
+	// At is the local start time "15:04" for daily, weekdays and weekly rules.
+	At       string         `json:"at,omitempty"`
+	Weekdays []time.Weekday `json:"weekdays,omitempty"`
+	// Cron is a 5-field "min hour dom month dow" expression for cron rules.
+	Cron    string `json:"cron,omitempty"`
+	Minutes int    `json:"minutes"`
+	// Until and Exceptions are local dates "2006-01-02"; Until is inclusive.
+	Until      string    `json:"until,omitempty"`
+	Exceptions []string  `json:"exceptions,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	// ExpandedUntil marks how far ahead reservations have been created.
+	ExpandedUntil time.Time `json:"expanded_until"`
 }
 
 type HistoryEntry struct {
@@ -54,34 +309,100 @@ type HistoryEntry struct {
 	Purpose    string    `json:"purpose,omitempty"`
 	StartedAt  time.Time `json:"started_at"`
 	EndedAt    time.Time `json:"ended_at"`
+	BundleID   string    `json:"bundle_id,omitempty"`
+	Handoff    bool      `json:"handoff,omitempty"`
+	// PreemptedBy and PreemptReason are set when the session was cut short
+	// by a preemption.
+	PreemptedBy   string `json:"preempted_by,omitempty"`
+	PreemptReason string `json:"preempt_reason,omitempty"`
+	// TransferredTo ends a session handed over to another user;
+	// TransferredFrom starts one.
+	TransferredTo   string `json:"transferred_to,omitempty"`
+	TransferredFrom string `json:"transferred_from,omitempty"`
+	BookedBy        string `json:"booked_by,omitempty"`
+	ApprovedBy      string `json:"approved_by,omitempty"`
 }
 
 // API response types
 
 type BookingView struct {
 	Booking
-	Username string `json:"username"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
 }
 
 type QueueView struct {
 	QueueEntry
-	Username string `json:"username"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+}
+
+type ReservationView struct {
+	Reservation
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
 }
 
 type ResourceStatus struct {
-	Resource     Resource     `json:"resource"`
-	Booking      *BookingView `json:"booking,omitempty"`
-	Queue        []QueueView  `json:"queue"`
-	Subscribers  int          `json:"subscribers"`
-	IsSubscribed bool         `json:"is_subscribed"`
-	IsHolder     bool         `json:"is_holder"`
-	InQueue      bool         `json:"in_queue"`
+	Resource Resource `json:"resource"`
+	// Booking is the current user's booking if they hold a seat, otherwise
+	// the earliest one; Bookings lists every holder.
+	Booking      *BookingView  `json:"booking,omitempty"`
+	Bookings     []BookingView `json:"bookings"`
+	Capacity     int           `json:"capacity"`
+	Queue        []QueueView   `json:"queue"`
+	Subscribers  int           `json:"subscribers"`
+	IsSubscribed bool          `json:"is_subscribed"`
+	IsHolder     bool          `json:"is_holder"`
+	HeldForYou   bool          `json:"held_for_you"` // a claim-window hold waits for the current user
+	// TransferForYou is set when a holder offers their booking to the current user.
+	TransferForYou bool `json:"transfer_for_you"`
+	InQueue        bool `json:"in_queue"`
+	// ApprovalPending is set while the current user's booking request waits
+	// for an approver.
+	ApprovalPending bool `json:"approval_pending"`
+	// CanManage is set when the current user manages the resource.
+	CanManage bool `json:"can_manage"`
+	// InMaintenance is set while the resource is out of service.
+	InMaintenance bool `json:"in_maintenance"`
+}
+
+type PoolStatus struct {
+	Name    string      `json:"name"`
+	Free    int         `json:"free"`
+	Total   int         `json:"total"`
+	Queue   []QueueView `json:"queue"`
+	InQueue bool        `json:"in_queue"`
+}
+
+// GroupNode is a resource group in the status tree: the IDs of its own
+// resources, its subgroups, and seat counts over the whole subtree.
+type GroupNode struct {
+	Group        ResourceGroup `json:"group"`
+	ResourceIDs  []string      `json:"resource_ids"`
+	Children     []GroupNode   `json:"children"`
+	Free         int           `json:"free"`
+	Total        int           `json:"total"`
+	IsSubscribed bool          `json:"is_subscribed"`
 }
 
 type StatusResponse struct {
-	UserID   string           `json:"user_id"`
-	IsAdmin  bool             `json:"is_admin"`
-	Statuses []ResourceStatus `json:"statuses"`
+	UserID  string `json:"user_id"`
+	IsAdmin bool   `json:"is_admin"`
+	// CanManage is set when the user manages any resource, CanCreate when
+	// they may add new ones (admins and global managers).
+	CanManage bool             `json:"can_manage"`
+	CanCreate bool             `json:"can_create"`
+	Statuses  []ResourceStatus `json:"statuses"`
+	Pools     []PoolStatus     `json:"pools"`
+	// Groups are the top-level resource groups holding any matching
+	// resource; resources outside every group are ungrouped.
+	Groups []GroupNode `json:"groups"`
+	// Total counts the matching resources; Statuses holds page Page of them,
+	// PerPage at a time (all of them if PerPage is 0).
+	Total   int `json:"total"`
+	Page    int `json:"page"`
+	PerPage int `json:"per_page"`
 }
 
 type DurationPreset struct {
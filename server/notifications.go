@@ -8,19 +8,24 @@ import (
 )
 
 func (p *Plugin) sendDM(userID, text string) {
+	p.sendDMPost(userID, &model.Post{Message: text})
+}
+
+// sendDMPost sends post from the bot to userID and returns the created post.
+func (p *Plugin) sendDMPost(userID string, post *model.Post) *model.Post {
 	channel, err := p.API.GetDirectChannel(userID, p.botUserID)
 	if err != nil {
 		p.API.LogWarn("sendDM: GetDirectChannel", "user", userID, "err", err.Error())
-		return
+		return nil
 	}
-	post := &model.Post{
-		UserId:    p.botUserID,
-		ChannelId: channel.Id,
-		Message:   text,
-	}
-	if _, err := p.API.CreatePost(post); err != nil {
+	post.UserId = p.botUserID
+	post.ChannelId = channel.Id
+	created, err := p.API.CreatePost(post)
+	if err != nil {
 		p.API.LogWarn("sendDM: CreatePost", "user", userID, "err", err.Error())
+		return nil
 	}
+	return created
 }
 
 func (p *Plugin) notifySubscribers(resourceID, text, excludeUserID string) {
@@ -32,14 +37,18 @@ func (p *Plugin) notifySubscribers(resourceID, text, excludeUserID string) {
 	}
 }
 
+// processQueue offers a freed seat to whoever has waited longest: a bundle
+// waiter whose whole set is now free, or the head of the resource or pool
+// queue. Either gets an exclusive hold for the claim window.
 func (p *Plugin) processQueue(resourceID, resourceName string) {
-	entry, err := p.store.PopQueue(resourceID)
-	if err != nil || entry == nil {
+	res, _ := p.store.GetResource(resourceID)
+	if res == nil {
+		res = &Resource{ID: resourceID, Name: resourceName}
+	}
+	if p.serveBundleQueue(res) {
 		return
 	}
-	p.sendDM(entry.UserID, fmt.Sprintf(
-		"🎉 **%s** свободен! Вы следующий в очереди.\nИспользуйте `/rq book %s %s` чтобы занять.",
-		resourceName, resourceName, formatDuration(entry.DesiredDuration)))
+	p.offerHold(res)
 }
 
 // --- formatting ---
@@ -5,7 +5,6 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/gorilla/mux"
 	"github.com/mattermost/mattermost/server/public/model"
@@ -14,15 +13,26 @@ import (
 
 type Plugin struct {
 	plugin.MattermostPlugin
-	mu        sync.RWMutex
 	store     *Store
 	router    *mux.Router
 	scheduler *Scheduler
+	users     *userCache
+	events    eventQueue
+	boards    boardState
 	botUserID string
 }
 
 func (p *Plugin) OnActivate() error {
 	p.store = NewStore(p.API)
+	p.users = newUserCache()
+	if err := p.store.EnsureIndex(); err != nil {
+		return fmt.Errorf("resource index: %w", err)
+	}
+	if err := p.store.EnsureUsage(); err != nil {
+		return fmt.Errorf("quota usage: %w", err)
+	}
+	p.store.OnResourceChange = p.statusChanged
+	p.store.OnGroupsChange = p.groupsChanged
 
 	botID, err := p.ensureBot()
 	if err != nil {
@@ -38,7 +48,9 @@ func (p *Plugin) OnActivate() error {
 	p.initRoutes()
 
 	p.scheduler = NewScheduler(p)
-	p.scheduler.Start()
+	if err := p.scheduler.Start(); err != nil {
+		return fmt.Errorf("start scheduler: %w", err)
+	}
 
 	return nil
 }
@@ -47,6 +59,7 @@ func (p *Plugin) OnDeactivate() error {
 	if p.scheduler != nil {
 		p.scheduler.Stop()
 	}
+	p.stopEvents()
 	return nil
 }
 
@@ -84,10 +97,20 @@ type configuration struct {
 	NotifyBeforeMinutes  string `json:"NotifyBeforeMinutes"`
 	MaxBookingHours      string `json:"MaxBookingHours"`
 	CheckIntervalSeconds string `json:"CheckIntervalSeconds"`
+	ClaimWindowMinutes   string `json:"ClaimWindowMinutes"`
+	// Quotas; 0 or empty disables each of them.
+	MaxConcurrentBookings string `json:"MaxConcurrentBookings"`
+	MaxHoursPerDay        string `json:"MaxHoursPerDay"`
+	MaxHoursPerWeek       string `json:"MaxHoursPerWeek"`
+	TeamMaxHoursPerDay    string `json:"TeamMaxHoursPerDay"`
+	TeamMaxHoursPerWeek   string `json:"TeamMaxHoursPerWeek"`
+	RebookCooldownMinutes string `json:"RebookCooldownMinutes"`
+	PreemptGraceMinutes   string `json:"PreemptGraceMinutes"`
+	ApprovalHours         string `json:"ApprovalHours"`
 }
 
 func (p *Plugin) getConfig() *configuration {
-	cfg := &configuration{NotifyBeforeMinutes: "10", MaxBookingHours: "24", CheckIntervalSeconds: "30"}
+	cfg := &configuration{NotifyBeforeMinutes: "10", MaxBookingHours: "24", CheckIntervalSeconds: "30", ClaimWindowMinutes: "10", PreemptGraceMinutes: "5", ApprovalHours: "24"}
 	_ = p.API.LoadPluginConfiguration(cfg)
 	return cfg
 }
@@ -95,11 +118,33 @@ func (p *Plugin) getConfig() *configuration {
 func (p *Plugin) cfgNotifyMinutes() int  { v, _ := strconv.Atoi(p.getConfig().NotifyBeforeMinutes); if v <= 0 { return 10 }; return v }
 func (p *Plugin) cfgMaxBookingHours() int { v, _ := strconv.Atoi(p.getConfig().MaxBookingHours); if v <= 0 { return 24 }; return v }
 func (p *Plugin) cfgCheckSeconds() int   { v, _ := strconv.Atoi(p.getConfig().CheckIntervalSeconds); if v <= 0 { return 30 }; return v }
+func (p *Plugin) cfgClaimMinutes() int   { v, _ := strconv.Atoi(p.getConfig().ClaimWindowMinutes); if v <= 0 { return 10 }; return v }
+
+// cfgPreemptGraceMinutes is how long a preempted holder keeps the booking;
+// 0 ends it at once.
+func (p *Plugin) cfgPreemptGraceMinutes() int { return cfgLimit(p.getConfig().PreemptGraceMinutes) }
+
+// cfgApprovalHours is how long a booking request waits for an approver.
+func (p *Plugin) cfgApprovalHours() int {
+	if v := cfgLimit(p.getConfig().ApprovalHours); v > 0 {
+		return v
+	}
+	return 24
+}
+
+// cfgLimit parses an optional limit setting; anything invalid means no limit.
+func cfgLimit(s string) int {
+	v, _ := strconv.Atoi(strings.TrimSpace(s))
+	if v < 0 {
+		return 0
+	}
+	return v
+}
 
 // --- user helpers ---
 
 func (p *Plugin) isAdmin(userID string) bool {
-	u, err := p.API.GetUser(userID)
+	u, err := p.authUser(userID)
 	if err != nil {
 		return false
 	}
@@ -107,7 +152,7 @@ func (p *Plugin) isAdmin(userID string) bool {
 }
 
 func (p *Plugin) username(userID string) string {
-	u, err := p.API.GetUser(userID)
+	u, err := p.getUser(userID)
 	if err != nil {
 		return "unknown"
 	}
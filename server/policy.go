@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Per-resource limits. A Resource.Policy overrides the plugin settings field
+// by field; limitsFor resolves the effective values so callers never have to
+// look at the global config themselves.
+
+const (
+	defaultBookMinutes = 60
+	maxPolicyPresets   = 10
+	maxPolicyMinutes   = 7 * 24 * 60 // a week
+	maxQueueLimit      = 500
+)
+
+var (
+	errNotPreset      = errors.New("duration is not an allowed preset")
+	errExtendExceeded = errors.New("max total extension exceeded")
+)
+
+// limits are the effective booking limits of a resource.
+type limits struct {
+	MaxBooking time.Duration
+	MaxExtend  time.Duration // 0: only MaxBooking applies
+	WarnBefore time.Duration
+	Default    time.Duration
+	Presets    []int // minutes; empty: any duration up to MaxBooking
+	QueueLimit int
+}
+
+func (p *Plugin) limitsFor(res *Resource) limits {
+	l := limits{
+		MaxBooking: time.Duration(p.cfgMaxBookingHours()) * time.Hour,
+		WarnBefore: time.Duration(p.cfgNotifyMinutes()) * time.Minute,
+		Default:    defaultBookMinutes * time.Minute,
+		QueueLimit: maxQueueSize,
+	}
+	pol := res.Policy
+	if pol == nil {
+		return l
+	}
+	if pol.MaxMinutes > 0 {
+		l.MaxBooking = time.Duration(pol.MaxMinutes) * time.Minute
+	}
+	if pol.MaxExtendMinutes > 0 {
+		l.MaxExtend = time.Duration(pol.MaxExtendMinutes) * time.Minute
+	}
+	if pol.WarnBeforeMinutes > 0 {
+		l.WarnBefore = time.Duration(pol.WarnBeforeMinutes) * time.Minute
+	}
+	if pol.DefaultMinutes > 0 {
+		l.Default = time.Duration(pol.DefaultMinutes) * time.Minute
+	}
+	if l.Default > l.MaxBooking {
+		l.Default = l.MaxBooking
+	}
+	l.Presets = pol.Presets
+	if pol.QueueLimit > 0 {
+		l.QueueLimit = pol.QueueLimit
+	}
+	return l
+}
+
+// checkBooking validates the length of a new booking.
+func (l limits) checkBooking(dur time.Duration) error {
+	if dur > l.MaxBooking {
+		return fmt.Errorf("%w: max %d minutes", errMaxExceeded, int(l.MaxBooking.Minutes()))
+	}
+	if len(l.Presets) > 0 && !containsInt(l.Presets, int(dur.Minutes())) {
+		return fmt.Errorf("%w: allowed %v minutes", errNotPreset, l.Presets)
+	}
+	return nil
+}
+
+// checkExtend validates extending b by dur.
+func (l limits) checkExtend(b *Booking, dur time.Duration) error {
+	if b.ExpiresAt.Add(dur).Sub(b.StartedAt) > l.MaxBooking {
+		return fmt.Errorf("%w: max %d minutes", errMaxExceeded, int(l.MaxBooking.Minutes()))
+	}
+	if l.MaxExtend > 0 && b.Extended+dur > l.MaxExtend {
+		return fmt.Errorf("%w: max %d minutes", errExtendExceeded, int(l.MaxExtend.Minutes()))
+	}
+	return nil
+}
+
+// presetViews returns the duration presets offered for res.
+func (l limits) presetViews() []DurationPreset {
+	if len(l.Presets) > 0 {
+		out := make([]DurationPreset, 0, len(l.Presets))
+		for _, m := range l.Presets {
+			out = append(out, DurationPreset{Label: formatDuration(time.Duration(m) * time.Minute), Minutes: m})
+		}
+		return out
+	}
+	out := make([]DurationPreset, 0, len(DefaultPresets))
+	for _, pr := range DefaultPresets {
+		if time.Duration(pr.Minutes)*time.Minute <= l.MaxBooking {
+			out = append(out, pr)
+		}
+	}
+	return out
+}
+
+// quickMinutes picks the durations of the one-click buttons in /rq list:
+// 10 minutes and an hour when allowed, otherwise the nearest presets.
+// Returns zeros when no duration fits.
+func (l limits) quickMinutes() (short, long int) {
+	short, long = 10, 60
+	views := l.presetViews()
+	if l.checkBooking(time.Duration(short)*time.Minute) != nil {
+		if len(views) == 0 {
+			return 0, 0
+		}
+		short = views[0].Minutes
+	}
+	if l.checkBooking(time.Duration(long)*time.Minute) != nil {
+		if len(views) == 0 {
+			return 0, 0
+		}
+		long = views[len(views)-1].Minutes
+	}
+	return short, long
+}
+
+// limitErrText renders a limit violation for chat responses, or "" if err
+// is not one.
+func (p *Plugin) limitErrText(res *Resource, err error) string {
+	l := p.limitsFor(res)
+	switch {
+	case errors.Is(err, errMaxExceeded):
+		return fmt.Sprintf("Максимум для **%s** — %s", res.Name, formatDuration(l.MaxBooking))
+	case errors.Is(err, errExtendExceeded):
+		return fmt.Sprintf("Продлевать **%s** можно суммарно не больше чем на %s", res.Name, formatDuration(l.MaxExtend))
+	case errors.Is(err, errNotPreset):
+		return fmt.Sprintf("Для **%s** разрешены только: %s", res.Name, presetList(l.Presets))
+	}
+	return ""
+}
+
+// describeLimits summarizes limits that differ from the global settings.
+func (p *Plugin) describeLimits(res *Resource) string {
+	if res.Policy == nil {
+		return ""
+	}
+	l := p.limitsFor(res)
+	parts := []string{"до " + formatDuration(l.MaxBooking)}
+	if l.MaxExtend > 0 {
+		parts = append(parts, "продление до +"+formatDuration(l.MaxExtend))
+	}
+	if len(l.Presets) > 0 {
+		parts = append(parts, "варианты: "+presetList(l.Presets))
+	}
+	if res.Policy.DefaultMinutes > 0 {
+		parts = append(parts, "по умолчанию "+formatDuration(l.Default))
+	}
+	if res.Policy.WarnBeforeMinutes > 0 {
+		parts = append(parts, "напоминание за "+formatDuration(l.WarnBefore))
+	}
+	if res.Policy.QueueLimit > 0 {
+		parts = append(parts, fmt.Sprintf("очередь до %d", l.QueueLimit))
+	}
+	if res.Policy.TransferReset {
+		parts = append(parts, "при передаче срок начинается заново")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sanitizePolicy clamps admin input; an all-zero policy becomes nil.
+func sanitizePolicy(pol *Policy) *Policy {
+	if pol == nil {
+		return nil
+	}
+	out := &Policy{
+		MaxMinutes:        clampNonNeg(pol.MaxMinutes, maxPolicyMinutes),
+		MaxExtendMinutes:  clampNonNeg(pol.MaxExtendMinutes, maxPolicyMinutes),
+		WarnBeforeMinutes: clampNonNeg(pol.WarnBeforeMinutes, 24*60),
+		DefaultMinutes:    clampNonNeg(pol.DefaultMinutes, maxPolicyMinutes),
+		QueueLimit:        clampNonNeg(pol.QueueLimit, maxQueueLimit),
+		TransferReset:     pol.TransferReset,
+	}
+	seen := map[int]bool{}
+	for _, m := range pol.Presets {
+		if m > 0 && m <= maxPolicyMinutes && !seen[m] && len(out.Presets) < maxPolicyPresets {
+			seen[m] = true
+			out.Presets = append(out.Presets, m)
+		}
+	}
+	sort.Ints(out.Presets)
+	if out.MaxMinutes == 0 && out.MaxExtendMinutes == 0 && out.WarnBeforeMinutes == 0 &&
+		out.DefaultMinutes == 0 && out.QueueLimit == 0 && len(out.Presets) == 0 && !out.TransferReset {
+		return nil
+	}
+	return out
+}
+
+func clampNonNeg(v, max int) int {
+	if v < 0 {
+		return 0
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+func presetList(presets []int) string {
+	parts := make([]string, len(presets))
+	for i, m := range presets {
+		parts[i] = formatDuration(time.Duration(m) * time.Minute)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Pools group interchangeable resources. A pool has no record of its own: it
+// is the set of resources sharing the same Resource.Pool name. Users can book
+// "any free member" and queue on the pool as a whole; the shared queue lives
+// next to the per-resource queues under a "pool:" pseudo resource ID.
+
+const (
+	poolPrefix = "pool:"
+	maxPoolLen = 50
+)
+
+var errNoFreeMember = errors.New("no free pool member")
+
+func poolQueueID(pool string) string {
+	return poolPrefix + pool
+}
+
+// normalizePool turns user input into a pool name: lower case, dashes for spaces.
+func normalizePool(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.Join(strings.Fields(s), "-")
+	return truncate(s, maxPoolLen)
+}
+
+// isPoolRef reports whether a command argument refers to a pool ("pool:name").
+func isPoolRef(arg string) bool {
+	return strings.HasPrefix(strings.ToLower(arg), poolPrefix)
+}
+
+// poolMembers returns the resources of a pool ordered by name.
+func (p *Plugin) poolMembers(pool string) ([]*Resource, error) {
+	resources, err := p.store.GetAllResources()
+	if err != nil {
+		return nil, err
+	}
+	var members []*Resource
+	for _, r := range resources {
+		if r.Pool == pool {
+			members = append(members, r)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	return members, nil
+}
+
+// findPool resolves "pool:name" to the pool name and its members that
+// userID may access.
+func (p *Plugin) findPool(userID, ref string) (string, []*Resource, error) {
+	pool := normalizePool(ref[len(poolPrefix):])
+	all, err := p.poolMembers(pool)
+	if err != nil {
+		return "", nil, err
+	}
+	allowed := p.accessChecker(userID)
+	var members []*Resource
+	for _, r := range all {
+		if allowed(r) {
+			members = append(members, r)
+		}
+	}
+	if pool == "" || len(members) == 0 {
+		return "", nil, fmt.Errorf("пул `%s` не найден", pool)
+	}
+	return pool, members, nil
+}
+
+// bookFromPool books a seat on the first member of the pool with one free. Members without an
+// upcoming reservation in the booked window are preferred. On errors other than
+// errNoFreeMember the member that refused the booking is returned with the error.
+func (p *Plugin) bookFromPool(members []*Resource, userID string, dur time.Duration, purpose string) (*Resource, *Booking, error) {
+	until := time.Now().Add(dur)
+	var fallback []*Resource
+	// A member whose policy rejects dur, or that requires approval, is
+	// skipped; its error is reported only if no other member could be booked.
+	var limited *Resource
+	var limitErr error
+	for _, pass := range []bool{true, false} {
+		candidates := members
+		if !pass {
+			candidates = fallback
+		}
+		for _, res := range candidates {
+			if !p.hasFreeSeat(res) {
+				continue
+			}
+			if pass && p.reservationWarning(res, userID, until) != "" {
+				fallback = append(fallback, res)
+				continue
+			}
+			b, err := p.bookResource(res, userID, dur, purpose)
+			if errors.Is(err, ErrBusy) || errors.Is(err, ErrConflict) {
+				continue // someone was faster, try the next member
+			}
+			if p.limitErrText(res, err) != "" || errors.Is(err, errApprovalRequired) {
+				limited, limitErr = res, err
+				continue
+			}
+			if err != nil {
+				return res, nil, err
+			}
+			return res, b, nil
+		}
+	}
+	if limitErr != nil {
+		return limited, nil, limitErr
+	}
+	return nil, nil, errNoFreeMember
+}
+
+// buildPoolStatuses summarizes the pools of resources.
+func (p *Plugin) buildPoolStatuses(resources []*Resource, isFree func(*Resource) bool, currentUserID string) []PoolStatus {
+	byName := map[string]*PoolStatus{}
+	var names []string
+	for _, r := range resources {
+		pool := r.Pool
+		if pool == "" {
+			continue
+		}
+		ps, ok := byName[pool]
+		if !ok {
+			ps = &PoolStatus{Name: pool}
+			byName[pool] = ps
+			names = append(names, pool)
+		}
+		ps.Total++
+		if isFree(r) {
+			ps.Free++
+		}
+	}
+	sort.Strings(names)
+	out := make([]PoolStatus, 0, len(names))
+	for _, name := range names {
+		ps := byName[name]
+		entries, _ := p.store.GetQueueEntries(poolQueueID(name))
+		ps.Queue = make([]QueueView, 0, len(entries))
+		for _, e := range entries {
+			ps.Queue = append(ps.Queue, QueueView{QueueEntry: e, Username: p.username(e.UserID), DisplayName: p.plainName(e.UserID)})
+			if e.UserID == currentUserID {
+				ps.InQueue = true
+			}
+		}
+		out = append(out, *ps)
+	}
+	return out
+}
+
+// peekNextInLine returns whoever has waited longest for res: the head of the
+// resource's own queue or the first in its pool's shared queue who may use
+// res without approval, together with the ID of the queue the entry is in.
+func (p *Plugin) peekNextInLine(res *Resource) (*QueueEntry, string) {
+	own, _ := p.store.GetQueueEntries(res.ID)
+	var shared *QueueEntry
+	if res.Pool != "" {
+		entries, _ := p.store.GetQueueEntries(poolQueueID(res.Pool))
+		for i := range entries {
+			if p.canAccess(entries[i].UserID, res) && !p.needsApproval(res, entries[i].UserID) {
+				shared = &entries[i]
+				break
+			}
+		}
+	}
+	if shared != nil && (len(own) == 0 || queueBefore(*shared, own[0])) {
+		return shared, poolQueueID(res.Pool)
+	}
+	if len(own) > 0 {
+		return &own[0], res.ID
+	}
+	return nil, ""
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Preemption lets an admin or an on-call user (one allowed to queue as
+// urgent) take a seat from its holder. The holder keeps the booking for a
+// grace period to save their work: the booking gets PreemptedBy set and its
+// ExpiresAt cut to the end of the grace period, and a DM counts down the time
+// left. When the booking ends, by expiry or by an early release, the history
+// records the preemption and the seat goes straight to the preemptor instead
+// of the queue. Claim-window holds are taken over at once.
+
+var (
+	errPreemptDenied = errors.New("preemption not allowed")
+	errPreempted     = errors.New("booking is being preempted")
+	errSeatFree      = errors.New("resource has a free seat")
+)
+
+// mayPreempt reports whether userID may preempt bookings.
+func (p *Plugin) mayPreempt(userID string) bool {
+	return p.maxPriority(userID) >= PriorityUrgent
+}
+
+// preemptBooking starts preempting a seat of res for actorID. targetUserID
+// selects the holder; if empty it is the only holder, or the booking that
+// would end first. Returns the preempted booking.
+func (p *Plugin) preemptBooking(res *Resource, actorID, targetUserID, reason string) (*Booking, error) {
+	if !p.mayPreempt(actorID) {
+		return nil, errPreemptDenied
+	}
+	if own, _ := p.store.GetUserBooking(res.ID, actorID); own != nil {
+		return nil, ErrHolding
+	}
+	bookings, err := p.store.GetBookings(res.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(bookings) < res.Seats() {
+		return nil, errSeatFree
+	}
+	if targetUserID == "" {
+		var target *Booking
+		for i := range bookings {
+			b := &bookings[i]
+			if b.PreemptedBy != "" || b.UserID == actorID {
+				continue
+			}
+			if target == nil || b.ExpiresAt.Before(target.ExpiresAt) {
+				target = b
+			}
+		}
+		if target == nil {
+			return nil, errPreempted
+		}
+		targetUserID = target.UserID
+	}
+
+	if cur, _ := p.store.GetUserBooking(res.ID, targetUserID); cur != nil && cur.Hold {
+		taken, err := p.store.TakeBooking(res.ID, targetUserID, func(b *Booking) error {
+			if !b.Hold {
+				return ErrConflict
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		taken.PreemptedBy, taken.PreemptReason = actorID, reason
+		p.sendDM(taken.UserID, fmt.Sprintf("⛔ @%s забрал придержанный для вас **%s**: %s",
+			p.username(actorID), res.Name, reason))
+		p.completePreemption(res.ID, res.Name, taken)
+		return taken, nil
+	}
+
+	end := time.Now().Add(time.Duration(p.cfgPreemptGraceMinutes()) * time.Minute)
+	var bundleID string
+	b, err := p.store.UpdateBooking(res.ID, targetUserID, func(b *Booking) error {
+		if b.PreemptedBy != "" {
+			return errPreempted
+		}
+		b.PreemptedBy = actorID
+		b.PreemptReason = reason
+		if b.ExpiresAt.After(end) {
+			b.ExpiresAt = end
+		}
+		b.NotifiedSoon = true // the countdown replaces the usual warning
+		// The seat leaves its bundle: the rest of the set stays booked.
+		bundleID, b.BundleID = b.BundleID, ""
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if bundleID != "" {
+		p.cleanupBundle(bundleID)
+	}
+
+	if post := p.sendDMPost(b.UserID, p.preemptPost(res, b)); post != nil {
+		updated, err := p.store.UpdateBooking(res.ID, b.UserID, func(cur *Booking) error {
+			if cur.PreemptedBy != actorID {
+				return ErrConflict
+			}
+			cur.PreemptPostID = post.Id
+			return nil
+		})
+		if err == nil {
+			b = updated
+		}
+	}
+	p.notifySubscribers(res.ID, fmt.Sprintf("⛔ @%s вытесняет @%s с **%s** (%s), освобождение в %s",
+		p.username(actorID), p.username(targetUserID), res.Name, reason, end.Format("15:04")), actorID)
+	return b, nil
+}
+
+// preemptPost is the countdown DM to a preempted holder.
+func (p *Plugin) preemptPost(res *Resource, b *Booking) *model.Post {
+	left := time.Until(b.ExpiresAt)
+	if left < 0 {
+		left = 0
+	}
+	post := &model.Post{}
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{{
+		Color: "#e53935",
+		Text: fmt.Sprintf("⛔ @%s вытесняет вас с **%s**: %s\nСохраните работу — бронь закончится в %s (осталось %s), затем ресурс перейдёт к @%s.",
+			p.username(b.PreemptedBy), res.Name, b.PreemptReason, b.ExpiresAt.Format("15:04"),
+			formatTimeLeft(left), p.username(b.PreemptedBy)),
+		Actions: []*model.PostAction{{
+			Id: "release", Name: "🔓 Освободить сейчас", Type: "button",
+			Integration: &model.PostActionIntegration{
+				URL: actionURL("release"), Context: map[string]interface{}{"resource_id": res.ID},
+			},
+		}},
+	}})
+	return post
+}
+
+// updatePreemptCountdown refreshes the time left in the holder's DM.
+func (p *Plugin) updatePreemptCountdown(res *Resource, b *Booking) {
+	if b.PreemptPostID == "" {
+		return
+	}
+	post, appErr := p.API.GetPost(b.PreemptPostID)
+	if appErr != nil {
+		return
+	}
+	post.Props = p.preemptPost(res, b).Props
+	if _, appErr := p.API.UpdatePost(post); appErr != nil {
+		p.API.LogWarn("updatePreemptCountdown: UpdatePost", "post", post.Id, "err", appErr.Error())
+	}
+}
+
+// completePreemption hands the seat of a finished preempted booking old to
+// the preemptor, for the resource's default duration and within their quota.
+// History has already been recorded by the caller.
+func (p *Plugin) completePreemption(resourceID, name string, old *Booking) {
+	if old.PreemptPostID != "" {
+		if post, appErr := p.API.GetPost(old.PreemptPostID); appErr == nil {
+			post.Message = fmt.Sprintf("⛔ Бронь **%s** завершена: ресурс передан @%s (%s)",
+				name, p.username(old.PreemptedBy), old.PreemptReason)
+			post.Props = nil
+			p.API.UpdatePost(post)
+		}
+	}
+	res, _ := p.store.GetResource(resourceID)
+	if res == nil {
+		return
+	}
+	now := time.Now()
+	b := &Booking{
+		ResourceID: res.ID, UserID: old.PreemptedBy, Purpose: old.PreemptReason,
+		StartedAt: now, ExpiresAt: now.Add(p.limitsFor(res).Default),
+	}
+	err := p.checkQuota(b.UserID, []*Resource{res}, b.ExpiresAt.Sub(now))
+	if err == nil {
+		err = p.store.CreateBooking(b, res.Seats())
+	}
+	if err != nil {
+		if !errors.Is(err, ErrHolding) {
+			p.sendDM(old.PreemptedBy, fmt.Sprintf("⚠️ Не удалось занять **%s** после вытеснения: %s", res.Name, p.bookErrText(res, err)))
+			p.processQueue(res.ID, res.Name)
+		}
+		return
+	}
+	p.store.RemoveFromQueue(res.ID, b.UserID)
+	if res.Pool != "" {
+		p.store.RemoveFromQueue(poolQueueID(res.Pool), b.UserID)
+	}
+	p.sendDM(b.UserID, fmt.Sprintf("✅ **%s** освобождён и забронирован за вами на %s (до %s)",
+		res.Name, formatDuration(b.ExpiresAt.Sub(now)), b.ExpiresAt.Format("15:04")))
+	p.notifySubscribers(res.ID, fmt.Sprintf("🔒 **%s** занят @%s после вытеснения%s",
+		res.Name, p.username(b.UserID), p.seatsNote(res)), b.UserID)
+}
+
+// preemptErrText renders preemption failures for chat responses, or "".
+func preemptErrText(res *Resource, err error) string {
+	switch {
+	case errors.Is(err, errPreemptDenied):
+		return "🚫 Вытеснять брони могут только администраторы и дежурные (с доступом к приоритету urgent)"
+	case errors.Is(err, errSeatFree):
+		return fmt.Sprintf("**%s** свободен — просто забронируйте его: `/rq book %s`", res.Name, res.Name)
+	case errors.Is(err, errPreempted):
+		return fmt.Sprintf("Бронь **%s** уже вытесняется", res.Name)
+	}
+	return ""
+}
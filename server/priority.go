@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Queue priorities. Entries are ordered by priority, then by waiting time, so
+// an urgent entry jumps ahead of everyone with a lower priority; the users it
+// overtakes get a DM with their new position. Who may use which level is set
+// by admins as priority classes matching system roles or user groups; system
+// admins may always queue as urgent.
+
+var errPriorityDenied = errors.New("priority not allowed")
+
+var priorityNames = []string{"normal", "high", "urgent"}
+
+// parsePriority accepts a level name in English or Russian.
+func parsePriority(s string) (int, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "normal", "обычный":
+		return PriorityNormal, true
+	case "high", "высокий":
+		return PriorityHigh, true
+	case "urgent", "срочный":
+		return PriorityUrgent, true
+	}
+	return 0, false
+}
+
+func priorityName(level int) string {
+	if level < 0 || level >= len(priorityNames) {
+		return priorityNames[PriorityNormal]
+	}
+	return priorityNames[level]
+}
+
+// priorityLabel renders a level for chat; "" for normal.
+func priorityLabel(level int) string {
+	switch level {
+	case PriorityHigh:
+		return "⚡ высокий"
+	case PriorityUrgent:
+		return "🔥 срочный"
+	}
+	return ""
+}
+
+// splitPriorityArg removes a "priority=<level>" argument from args.
+func splitPriorityArg(args []string) ([]string, int, error) {
+	out := make([]string, 0, len(args))
+	level := PriorityNormal
+	for _, a := range args {
+		if v, ok := strings.CutPrefix(strings.ToLower(a), "priority="); ok {
+			l, ok := parsePriority(v)
+			if !ok {
+				return nil, 0, fmt.Errorf("неизвестный приоритет `%s` — normal, high или urgent", v)
+			}
+			level = l
+			continue
+		}
+		out = append(out, a)
+	}
+	return out, level, nil
+}
+
+// maxPriority returns the highest level userID may queue with.
+func (p *Plugin) maxPriority(userID string) int {
+	if p.isAdmin(userID) {
+		return PriorityUrgent
+	}
+	classes, _ := p.store.GetPriorityClasses()
+	if len(classes) == 0 {
+		return PriorityNormal
+	}
+	u, err := p.authUser(userID)
+	if err != nil {
+		return PriorityNormal
+	}
+	roles := strings.Fields(u.Roles)
+	groups := p.userGroups(userID)
+	best := PriorityNormal
+	for _, c := range classes {
+		if c.Level <= best {
+			continue
+		}
+		if intersects(c.Roles, roles) || intersects(c.Groups, groups) {
+			best = c.Level
+		}
+	}
+	return best
+}
+
+func removeString(list []string, s string) []string {
+	out := list[:0]
+	for _, v := range list {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		if containsString(b, x) {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueue adds entry to the queue queueID (a resource ID or pool queue),
+// checking that the user may use its priority, and tells the users it was
+// put ahead of. label names the queue in those messages.
+func (p *Plugin) enqueue(queueID, label string, entry QueueEntry, limit int) (int, error) {
+	if entry.Priority > p.maxPriority(entry.UserID) {
+		return -1, errPriorityDenied
+	}
+	pos, pushed, err := p.store.AddToQueue(queueID, entry, limit)
+	if err != nil {
+		return -1, err
+	}
+	for i, uid := range pushed {
+		p.sendDM(uid, fmt.Sprintf("⬇️ @%s встал в очередь на %s с приоритетом %s. Ваша позиция теперь: %d",
+			p.username(entry.UserID), label, priorityLabel(entry.Priority), pos+i+1))
+	}
+	return pos, nil
+}
+
+// priorityErrText renders errPriorityDenied for chat responses, or "".
+func (p *Plugin) priorityErrText(userID string, err error) string {
+	if !errors.Is(err, errPriorityDenied) {
+		return ""
+	}
+	if max := p.maxPriority(userID); max > PriorityNormal {
+		return fmt.Sprintf("🚫 Вам доступен приоритет не выше «%s»", priorityName(max))
+	}
+	return "🚫 Вам не разрешено вставать в очередь с приоритетом — обратитесь к администратору"
+}
+
+// sanitizePriorityClasses drops invalid levels and empty classes and merges
+// classes of the same level.
+func sanitizePriorityClasses(in []PriorityClass) []PriorityClass {
+	byLevel := map[int]*PriorityClass{}
+	for _, c := range in {
+		if c.Level <= PriorityNormal || c.Level > PriorityUrgent {
+			continue
+		}
+		out, ok := byLevel[c.Level]
+		if !ok {
+			out = &PriorityClass{Level: c.Level}
+			byLevel[c.Level] = out
+		}
+		out.Roles = mergeNames(out.Roles, c.Roles)
+		out.Groups = mergeNames(out.Groups, c.Groups)
+	}
+	var classes []PriorityClass
+	for level := PriorityHigh; level <= PriorityUrgent; level++ {
+		if c := byLevel[level]; c != nil && (len(c.Roles) > 0 || len(c.Groups) > 0) {
+			classes = append(classes, *c)
+		}
+	}
+	return classes
+}
+
+func mergeNames(dst, src []string) []string {
+	for _, s := range src {
+		s = strings.TrimPrefix(strings.TrimSpace(s), "@")
+		if s != "" && !containsString(dst, s) && len(s) <= maxNameLen {
+			dst = append(dst, s)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Fairness quotas from the plugin settings, checked on every path that creates
+// or lengthens a booking: booking, claiming a hold, extending, handoffs from
+// the queue, reservations starting and preemptions completing. Reservations
+// and recurring rules are also checked when they are set up, so a slot that
+// can never fit is refused right away. The cooldown applies only to bookings
+// the user takes themselves. Usage is summed on demand from the
+// live bookings in the index and the finished sessions in the user's and
+// teams' usage records (see usage.go) rather than kept in counters, so
+// releases, expiries and admin actions can never leave a counter out of sync.
+// Booked time is counted per resource and only the part inside the day or
+// week counts towards it; claim-window holds are not bookings and never count.
+
+var errQuota = errors.New("quota exceeded")
+
+// Kinds of QuotaError.
+const (
+	quotaConcurrent = "concurrent"
+	quotaDay        = "day"
+	quotaWeek       = "week"
+	quotaTeamDay    = "team_day"
+	quotaTeamWeek   = "team_week"
+	quotaCooldown   = "cooldown"
+)
+
+// QuotaError says which quota a booking would break and when it resets.
+type QuotaError struct {
+	Kind     string
+	Limit    int       // bookings, hours or minutes, depending on Kind
+	Team     string    // team display name for team quotas
+	Resource string    // resource name for the cooldown
+	ResetAt  time.Time // zero when it frees up only as a booking ends
+}
+
+func (e *QuotaError) Error() string {
+	var msg string
+	switch e.Kind {
+	case quotaConcurrent:
+		msg = fmt.Sprintf("max %d concurrent bookings", e.Limit)
+	case quotaDay, quotaWeek:
+		msg = fmt.Sprintf("%s quota of %d hours", periodName(e.Kind), e.Limit)
+	case quotaTeamDay, quotaTeamWeek:
+		msg = fmt.Sprintf("team %s %s quota of %d hours", e.Team, periodName(e.Kind), e.Limit)
+	case quotaCooldown:
+		msg = fmt.Sprintf("cooldown of %d minutes for %s", e.Limit, e.Resource)
+	}
+	if !e.ResetAt.IsZero() {
+		msg += ", resets at " + e.ResetAt.Format(time.RFC3339)
+	}
+	return errQuota.Error() + ": " + msg
+}
+
+func (e *QuotaError) Unwrap() error { return errQuota }
+
+func periodName(kind string) string {
+	if kind == quotaDay || kind == quotaTeamDay {
+		return "daily"
+	}
+	return "weekly"
+}
+
+// quotas are the configured limits; zero fields are disabled.
+type quotas struct {
+	Concurrent    int
+	DayHours      int
+	WeekHours     int
+	TeamDayHours  int
+	TeamWeekHours int
+	Cooldown      time.Duration
+}
+
+func (p *Plugin) quotas() quotas {
+	cfg := p.getConfig()
+	return quotas{
+		Concurrent:    cfgLimit(cfg.MaxConcurrentBookings),
+		DayHours:      cfgLimit(cfg.MaxHoursPerDay),
+		WeekHours:     cfgLimit(cfg.MaxHoursPerWeek),
+		TeamDayHours:  cfgLimit(cfg.TeamMaxHoursPerDay),
+		TeamWeekHours: cfgLimit(cfg.TeamMaxHoursPerWeek),
+		Cooldown:      time.Duration(cfgLimit(cfg.RebookCooldownMinutes)) * time.Minute,
+	}
+}
+
+func (q quotas) enabled() bool {
+	return q.Concurrent > 0 || q.DayHours > 0 || q.WeekHours > 0 ||
+		q.TeamDayHours > 0 || q.TeamWeekHours > 0 || q.Cooldown > 0
+}
+
+// quotaWindows returns the current local day and week (from Monday).
+func quotaWindows(now time.Time) (dayStart, dayEnd, weekStart, weekEnd time.Time) {
+	dayStart = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	dayEnd = dayStart.AddDate(0, 0, 1)
+	weekStart = dayStart.AddDate(0, 0, -((int(now.Weekday()) + 6) % 7))
+	weekEnd = weekStart.AddDate(0, 0, 7)
+	return
+}
+
+// overlap returns how much of [start, end) falls inside [from, to).
+func overlap(start, end, from, to time.Time) time.Duration {
+	if start.Before(from) {
+		start = from
+	}
+	if end.After(to) {
+		end = to
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+// quotaUsage is a user's booked time in a day and week, the number
+// of bookings they hold right now and, when team quotas are on, the same sums
+// for each of their teams.
+type quotaUsage struct {
+	Concurrent int
+	Day, Week  time.Duration
+	Teams      []userTeam
+}
+
+// userTeam is a team the user belongs to, with the members' usage summed.
+type userTeam struct {
+	Name      string
+	Day, Week time.Duration
+}
+
+// quotaUsage sums the live bookings from the index and the finished sessions
+// from the usage records of userID and, if withTeams, of their teams, within
+// the day and week of at.
+func (p *Plugin) quotaUsage(userID string, withTeams bool, at time.Time) (*quotaUsage, error) {
+	dayStart, dayEnd, weekStart, weekEnd := quotaWindows(at)
+	add := func(day, week *time.Duration, start, end time.Time) {
+		*day += overlap(start, end, dayStart, dayEnd)
+		*week += overlap(start, end, weekStart, weekEnd)
+	}
+	entries, err := p.store.IndexEntries()
+	if err != nil {
+		return nil, err
+	}
+	var live []Booking
+	for _, e := range entries {
+		for _, b := range e.Bookings {
+			if !b.Hold {
+				live = append(live, b)
+			}
+		}
+	}
+
+	u := &quotaUsage{}
+	bundles := map[string]bool{}
+	for _, b := range live {
+		if b.UserID != userID {
+			continue
+		}
+		add(&u.Day, &u.Week, b.StartedAt, b.ExpiresAt)
+		// A bundle is one booking however many resources it spans.
+		if b.BundleID == "" || !bundles[b.BundleID] {
+			bundles[b.BundleID] = true
+			u.Concurrent++
+		}
+	}
+	spans, err := p.store.GetUsage(userUsageKey(userID))
+	if err != nil {
+		return nil, err
+	}
+	for _, sp := range spans {
+		add(&u.Day, &u.Week, sp.Start, sp.End)
+	}
+	if !withTeams {
+		return u, nil
+	}
+
+	teams, appErr := p.API.GetTeamsForUser(userID)
+	if appErr != nil {
+		return u, nil
+	}
+	for _, team := range teams {
+		t := userTeam{Name: team.DisplayName}
+		spans, err := p.store.GetUsage(teamUsageKey(team.Id))
+		if err != nil {
+			return nil, err
+		}
+		for _, sp := range spans {
+			add(&t.Day, &t.Week, sp.Start, sp.End)
+		}
+		members := map[string]bool{userID: true}
+		for _, b := range live {
+			in, ok := members[b.UserID]
+			if !ok {
+				m, appErr := p.API.GetTeamMember(team.Id, b.UserID)
+				in = appErr == nil && m != nil && m.DeleteAt == 0
+				members[b.UserID] = in
+			}
+			if in {
+				add(&t.Day, &t.Week, b.StartedAt, b.ExpiresAt)
+			}
+		}
+		u.Teams = append(u.Teams, t)
+	}
+	return u, nil
+}
+
+// checkQuota reports whether userID may book members (one resource, or the
+// resources of a bundle) for dur starting now.
+func (p *Plugin) checkQuota(userID string, members []*Resource, dur time.Duration) error {
+	q := p.quotas()
+	if !q.enabled() {
+		return nil
+	}
+	now := time.Now()
+	if q.Cooldown > 0 {
+		for _, res := range members {
+			if until := p.cooldownUntil(res, userID, q.Cooldown, now); !until.IsZero() {
+				return &QuotaError{Kind: quotaCooldown, Limit: int(q.Cooldown.Minutes()), Resource: res.Name, ResetAt: until}
+			}
+		}
+	}
+	return p.checkQuotaSpan(userID, members, now, now.Add(dur), true)
+}
+
+// checkQuotaSpan reports whether userID may have members booked from start
+// to end on top of what they use already, counting the part inside the day
+// and week of start. Extensions and reservations pass the time they add;
+// fresh is set for a booking that will count as one more concurrent one.
+func (p *Plugin) checkQuotaSpan(userID string, members []*Resource, start, end time.Time, fresh bool) error {
+	q := p.quotas()
+	if q.Concurrent == 0 && q.DayHours == 0 && q.WeekHours == 0 && q.TeamDayHours == 0 && q.TeamWeekHours == 0 {
+		return nil
+	}
+	u, err := p.quotaUsage(userID, q.TeamDayHours > 0 || q.TeamWeekHours > 0, start)
+	if err != nil {
+		return err
+	}
+	return q.check(u, len(members), start, end, fresh)
+}
+
+// check reports whether n bookings from start to end fit in the limits on
+// top of usage u, measured in the day and week of start.
+func (q quotas) check(u *quotaUsage, n int, start, end time.Time, fresh bool) error {
+	if fresh && q.Concurrent > 0 && u.Concurrent >= q.Concurrent {
+		return &QuotaError{Kind: quotaConcurrent, Limit: q.Concurrent}
+	}
+	dayStart, dayEnd, weekStart, weekEnd := quotaWindows(start)
+	addDay := overlap(start, end, dayStart, dayEnd) * time.Duration(n)
+	addWeek := overlap(start, end, weekStart, weekEnd) * time.Duration(n)
+	if exceeds(q.DayHours, u.Day+addDay) {
+		return &QuotaError{Kind: quotaDay, Limit: q.DayHours, ResetAt: dayEnd}
+	}
+	if exceeds(q.WeekHours, u.Week+addWeek) {
+		return &QuotaError{Kind: quotaWeek, Limit: q.WeekHours, ResetAt: weekEnd}
+	}
+	for _, t := range u.Teams {
+		if exceeds(q.TeamDayHours, t.Day+addDay) {
+			return &QuotaError{Kind: quotaTeamDay, Limit: q.TeamDayHours, Team: t.Name, ResetAt: dayEnd}
+		}
+		if exceeds(q.TeamWeekHours, t.Week+addWeek) {
+			return &QuotaError{Kind: quotaTeamWeek, Limit: q.TeamWeekHours, Team: t.Name, ResetAt: weekEnd}
+		}
+	}
+	return nil
+}
+
+// checkRule reports whether the occurrences of rule alone, over the next two
+// weeks from now, break a day or week limit of their owner or team; such a
+// rule would fail at every activation. Usage does not count here, as nobody
+// knows it in advance, so the error carries no reset time.
+func (q quotas) checkRule(rule *RecurringRule, now time.Time) error {
+	dayLimit := minLimit(q.DayHours, q.TeamDayHours)
+	weekLimit := minLimit(q.WeekHours, q.TeamWeekHours)
+	if dayLimit == 0 && weekLimit == 0 {
+		return nil
+	}
+	dur := time.Duration(rule.Minutes) * time.Minute
+	days := map[time.Time]time.Duration{}
+	weeks := map[time.Time]time.Duration{}
+	for _, start := range rule.Occurrences(now, now.AddDate(0, 0, 14)) {
+		dayStart, dayEnd, weekStart, weekEnd := quotaWindows(start)
+		days[dayStart] += overlap(start, start.Add(dur), dayStart, dayEnd)
+		weeks[weekStart] += overlap(start, start.Add(dur), weekStart, weekEnd)
+	}
+	for _, d := range days {
+		if exceeds(dayLimit, d) {
+			return &QuotaError{Kind: quotaDay, Limit: dayLimit}
+		}
+	}
+	for _, w := range weeks {
+		if exceeds(weekLimit, w) {
+			return &QuotaError{Kind: quotaWeek, Limit: weekLimit}
+		}
+	}
+	return nil
+}
+
+// minLimit returns the smaller of two limits, where zero is no limit.
+func minLimit(a, b int) int {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+func exceeds(limitHours int, used time.Duration) bool {
+	return limitHours > 0 && used > time.Duration(limitHours)*time.Hour
+}
+
+// cooldownUntil returns when userID may book res again, or zero if now.
+func (p *Plugin) cooldownUntil(res *Resource, userID string, cooldown time.Duration, now time.Time) time.Time {
+	history, _ := p.store.GetHistory(res.ID, 0)
+	var last time.Time
+	for _, h := range history {
+		if h.UserID == userID && h.EndedAt.After(last) {
+			last = h.EndedAt
+		}
+	}
+	if last.IsZero() || !last.Add(cooldown).After(now) {
+		return time.Time{}
+	}
+	return last.Add(cooldown)
+}
+
+// quotaErrText renders a quota violation for chat responses, or "" if err is
+// not one.
+func quotaErrText(err error) string {
+	var qe *QuotaError
+	if !errors.As(err, &qe) {
+		return ""
+	}
+	var msg string
+	switch qe.Kind {
+	case quotaConcurrent:
+		return fmt.Sprintf("🚫 У вас уже %d активных броней — это максимум. Освободите один из ресурсов", qe.Limit)
+	case quotaDay:
+		msg = fmt.Sprintf("🚫 Превышена дневная квота: %dч в день", qe.Limit)
+	case quotaWeek:
+		msg = fmt.Sprintf("🚫 Превышена недельная квота: %dч в неделю", qe.Limit)
+	case quotaTeamDay:
+		msg = fmt.Sprintf("🚫 Превышена дневная квота команды **%s**: %dч в день", qe.Team, qe.Limit)
+	case quotaTeamWeek:
+		msg = fmt.Sprintf("🚫 Превышена недельная квота команды **%s**: %dч в неделю", qe.Team, qe.Limit)
+	case quotaCooldown:
+		msg = fmt.Sprintf("🚫 Повторно занять **%s** можно не раньше чем через %s после окончания брони", qe.Resource, formatDuration(time.Duration(qe.Limit)*time.Minute))
+	}
+	if qe.ResetAt.IsZero() {
+		return msg
+	}
+	return msg + ". Сброс: " + formatResetAt(qe.ResetAt)
+}
+
+// formatResetAt renders a reset time as "15:04", adding the date if it is
+// not today.
+func formatResetAt(t time.Time) string {
+	now := time.Now()
+	if t.Year() == now.Year() && t.YearDay() == now.YearDay() {
+		return t.Format("15:04")
+	}
+	return t.Format("02.01 15:04")
+}
+
+// quotaReport renders userID's remaining allowance for /rq quota.
+func (p *Plugin) quotaReport(userID string) (string, error) {
+	q := p.quotas()
+	if !q.enabled() {
+		return "Квоты не настроены — ограничений нет", nil
+	}
+	now := time.Now()
+	u, err := p.quotaUsage(userID, q.TeamDayHours > 0 || q.TeamWeekHours > 0, now)
+	if err != nil {
+		return "", err
+	}
+	_, dayEnd, _, weekEnd := quotaWindows(now)
+	var sb strings.Builder
+	sb.WriteString("### 📊 Ваши квоты\n")
+	if q.Concurrent > 0 {
+		sb.WriteString(fmt.Sprintf("**Одновременные брони:** %d из %d\n", u.Concurrent, q.Concurrent))
+	}
+	line := func(title string, used time.Duration, limitHours int, reset time.Time) {
+		left := time.Duration(limitHours)*time.Hour - used
+		if left < 0 {
+			left = 0
+		}
+		sb.WriteString(fmt.Sprintf("**%s:** занято %s из %dч, осталось %s (сброс %s)\n",
+			title, formatDuration(used), limitHours, formatDuration(left), formatResetAt(reset)))
+	}
+	if q.DayHours > 0 {
+		line("Сегодня", u.Day, q.DayHours, dayEnd)
+	}
+	if q.WeekHours > 0 {
+		line("Эта неделя", u.Week, q.WeekHours, weekEnd)
+	}
+	for _, t := range u.Teams {
+		if q.TeamDayHours > 0 {
+			line("Команда "+t.Name+", сегодня", t.Day, q.TeamDayHours, dayEnd)
+		}
+		if q.TeamWeekHours > 0 {
+			line("Команда "+t.Name+", неделя", t.Week, q.TeamWeekHours, weekEnd)
+		}
+	}
+	if q.Cooldown > 0 {
+		sb.WriteString(fmt.Sprintf("**Пауза перед повторной бронью того же ресурса:** %s\n", formatDuration(q.Cooldown)))
+		// Only resources the user has used lately can still be cooling down.
+		spans, _ := p.store.GetUsage(userUsageKey(userID))
+		seen := map[string]bool{}
+		for _, sp := range spans {
+			if seen[sp.ResourceID] {
+				continue
+			}
+			seen[sp.ResourceID] = true
+			res, err := p.store.GetResource(sp.ResourceID)
+			if err != nil || res == nil {
+				continue
+			}
+			if until := p.cooldownUntil(res, userID, q.Cooldown, now); !until.IsZero() {
+				sb.WriteString(fmt.Sprintf("  • **%s** — доступен с %s\n", res.Name, formatResetAt(until)))
+			}
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+func TestQuotaWindows(t *testing.T) {
+	tests := []struct {
+		at        string
+		day, week string
+	}{
+		{"2026-10-07 10:00", "2026-10-07 00:00", "2026-10-05 00:00"},
+		{"2026-10-05 00:00", "2026-10-05 00:00", "2026-10-05 00:00"},
+		{"2026-10-11 23:59", "2026-10-11 00:00", "2026-10-05 00:00"},
+		{"2026-11-01 12:00", "2026-11-01 00:00", "2026-10-26 00:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.at, func(t *testing.T) {
+			dayStart, dayEnd, weekStart, weekEnd := quotaWindows(local(t, tt.at))
+			if want := local(t, tt.day); !dayStart.Equal(want) || !dayEnd.Equal(want.AddDate(0, 0, 1)) {
+				t.Errorf("day = [%v, %v), want from %v", dayStart, dayEnd, want)
+			}
+			if want := local(t, tt.week); !weekStart.Equal(want) || !weekEnd.Equal(want.AddDate(0, 0, 7)) {
+				t.Errorf("week = [%v, %v), want from %v", weekStart, weekEnd, want)
+			}
+		})
+	}
+}
+
+func TestQuotasCheck(t *testing.T) {
+	q := quotas{Concurrent: 2, DayHours: 8, WeekHours: 20, TeamDayHours: 12}
+	tests := []struct {
+		name     string
+		u        quotaUsage
+		n        int
+		from, to string
+		fresh    bool
+		wantKind string
+		wantTeam string
+	}{
+		{name: "fits", n: 1, from: "2026-10-07 10:00", to: "2026-10-07 14:00", fresh: true},
+		{name: "day limit is inclusive", u: quotaUsage{Day: 4 * time.Hour}, n: 1, from: "2026-10-07 10:00", to: "2026-10-07 14:00"},
+		{name: "concurrent", u: quotaUsage{Concurrent: 2}, n: 1, from: "2026-10-07 10:00", to: "2026-10-07 11:00", fresh: true, wantKind: quotaConcurrent},
+		{name: "concurrent ignored when not fresh", u: quotaUsage{Concurrent: 2}, n: 1, from: "2026-10-07 10:00", to: "2026-10-07 11:00"},
+		{name: "day", u: quotaUsage{Day: 6 * time.Hour, Week: 6 * time.Hour}, n: 1, from: "2026-10-07 10:00", to: "2026-10-07 13:00", wantKind: quotaDay},
+		{name: "bundle counts every member", n: 3, from: "2026-10-07 10:00", to: "2026-10-07 13:00", wantKind: quotaDay},
+		{name: "only today's part counts towards the day", u: quotaUsage{Day: 6 * time.Hour, Week: 6 * time.Hour}, n: 1, from: "2026-10-07 22:00", to: "2026-10-08 04:00"},
+		{name: "week", u: quotaUsage{Day: 3 * time.Hour, Week: 17 * time.Hour}, n: 1, from: "2026-10-07 10:00", to: "2026-10-07 14:00", wantKind: quotaWeek},
+		{
+			name: "team day", u: quotaUsage{Teams: []userTeam{{Name: "A"}, {Name: "B", Day: 10 * time.Hour}}},
+			n: 1, from: "2026-10-07 10:00", to: "2026-10-07 13:00", wantKind: quotaTeamDay, wantTeam: "B",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := q.check(&tt.u, tt.n, local(t, tt.from), local(t, tt.to), tt.fresh)
+			if tt.wantKind == "" {
+				if err != nil {
+					t.Fatalf("err = %v, want nil", err)
+				}
+				return
+			}
+			var qe *QuotaError
+			if !errors.As(err, &qe) || qe.Kind != tt.wantKind || qe.Team != tt.wantTeam {
+				t.Fatalf("err = %v, want %s quota error", err, tt.wantKind)
+			}
+			if !errors.Is(err, errQuota) {
+				t.Errorf("err does not wrap errQuota")
+			}
+		})
+	}
+}
+
+func TestCheckQuotaSpan(t *testing.T) {
+	span := func(from, to string) usageSpan {
+		return usageSpan{UserID: "u1", ResourceID: "r0", Start: local(t, from), End: local(t, to)}
+	}
+	res := []*Resource{{ID: "r1", Name: "gpu-1"}}
+	tests := []struct {
+		name      string
+		user      []usageSpan
+		team      []usageSpan
+		from, to  string
+		wantKind  string
+		wantReset string
+	}{
+		{name: "no usage", from: "2026-10-07 10:00", to: "2026-10-07 14:00"},
+		{
+			name: "day", user: []usageSpan{span("2026-10-07 01:00", "2026-10-07 07:00")},
+			from: "2026-10-07 10:00", to: "2026-10-07 13:00", wantKind: quotaDay, wantReset: "2026-10-08 00:00",
+		},
+		{
+			name: "yesterday does not count towards the day", user: []usageSpan{span("2026-10-06 01:00", "2026-10-06 07:00")},
+			from: "2026-10-07 10:00", to: "2026-10-07 13:00",
+		},
+		{
+			name: "a session over midnight counts its part", user: []usageSpan{span("2026-10-06 22:00", "2026-10-07 04:00")},
+			from: "2026-10-07 10:00", to: "2026-10-07 15:00", wantKind: quotaDay, wantReset: "2026-10-08 00:00",
+		},
+		{
+			name: "a session over midnight fits to the limit", user: []usageSpan{span("2026-10-06 22:00", "2026-10-07 04:00")},
+			from: "2026-10-07 10:00", to: "2026-10-07 14:00",
+		},
+		{
+			name: "week",
+			user: []usageSpan{
+				span("2026-10-05 09:00", "2026-10-05 16:00"),
+				span("2026-10-06 09:00", "2026-10-06 16:00"),
+				span("2026-10-07 06:00", "2026-10-07 09:00"),
+			},
+			from: "2026-10-07 10:00", to: "2026-10-07 14:00", wantKind: quotaWeek, wantReset: "2026-10-12 00:00",
+		},
+		{
+			name: "last week does not count",
+			user: []usageSpan{
+				span("2026-10-02 09:00", "2026-10-02 16:00"),
+				span("2026-10-03 09:00", "2026-10-03 16:00"),
+				span("2026-10-04 09:00", "2026-10-04 16:00"),
+			},
+			from: "2026-10-07 10:00", to: "2026-10-07 14:00",
+		},
+		{
+			name: "team day",
+			team: []usageSpan{{UserID: "u2", ResourceID: "r0", Start: local(t, "2026-10-07 00:00"), End: local(t, "2026-10-07 10:00")}},
+			from: "2026-10-07 10:00", to: "2026-10-07 13:00", wantKind: quotaTeamDay, wantReset: "2026-10-08 00:00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, api := newTestPlugin(configuration{MaxHoursPerDay: "8", MaxHoursPerWeek: "20", TeamMaxHoursPerDay: "12"})
+			api.teams["u1"] = []*model.Team{{Id: "t1", DisplayName: "Lab"}}
+			if err := p.store.set(userUsageKey("u1"), &usageRecord{Spans: tt.user}); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.store.set(teamUsageKey("t1"), &usageRecord{Spans: tt.team}); err != nil {
+				t.Fatal(err)
+			}
+			err := p.checkQuotaSpan("u1", res, local(t, tt.from), local(t, tt.to), true)
+			if tt.wantKind == "" {
+				if err != nil {
+					t.Fatalf("err = %v, want nil", err)
+				}
+				return
+			}
+			var qe *QuotaError
+			if !errors.As(err, &qe) || qe.Kind != tt.wantKind {
+				t.Fatalf("err = %v, want %s quota error", err, tt.wantKind)
+			}
+			if !qe.ResetAt.Equal(local(t, tt.wantReset)) {
+				t.Errorf("ResetAt = %v, want %s", qe.ResetAt, tt.wantReset)
+			}
+		})
+	}
+}
+
+func TestCheckQuotaCooldown(t *testing.T) {
+	res := &Resource{ID: "r1", Name: "gpu-1"}
+	now := time.Now().Truncate(time.Second)
+	tests := []struct {
+		name      string
+		user      string
+		endedAgo  time.Duration
+		wantReset time.Time
+	}{
+		{name: "within the cooldown", user: "u1", endedAgo: 10 * time.Minute, wantReset: now.Add(20 * time.Minute)},
+		{name: "after the cooldown", user: "u1", endedAgo: 40 * time.Minute},
+		{name: "another user", user: "u2", endedAgo: 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestPlugin(configuration{RebookCooldownMinutes: "30"})
+			ended := now.Add(-tt.endedAgo)
+			if err := p.store.AddHistory(HistoryEntry{UserID: "u1", ResourceID: res.ID, StartedAt: ended.Add(-time.Hour), EndedAt: ended}); err != nil {
+				t.Fatal(err)
+			}
+			err := p.checkQuota(tt.user, []*Resource{res}, time.Hour)
+			if tt.wantReset.IsZero() {
+				if err != nil {
+					t.Fatalf("err = %v, want nil", err)
+				}
+				return
+			}
+			var qe *QuotaError
+			if !errors.As(err, &qe) || qe.Kind != quotaCooldown || qe.Resource != res.Name {
+				t.Fatalf("err = %v, want cooldown quota error", err)
+			}
+			if !qe.ResetAt.Equal(tt.wantReset) {
+				t.Errorf("ResetAt = %v, want %v", qe.ResetAt, tt.wantReset)
+			}
+		})
+	}
+}
+
+func TestQuotasCheckRule(t *testing.T) {
+	now := local(t, "2026-10-05 00:00")
+	tests := []struct {
+		name     string
+		q        quotas
+		rule     RecurringRule
+		wantKind string
+	}{
+		{name: "no limits", q: quotas{}, rule: RecurringRule{Kind: RecurDaily, At: "00:00", Minutes: 24 * 60}},
+		{name: "fits", q: quotas{DayHours: 8, WeekHours: 40}, rule: RecurringRule{Kind: RecurWeekdays, At: "09:00", Minutes: 8 * 60}},
+		{name: "day", q: quotas{DayHours: 8}, rule: RecurringRule{Kind: RecurWeekly, At: "09:00", Weekdays: []time.Weekday{time.Monday}, Minutes: 9 * 60}, wantKind: quotaDay},
+		{name: "team day is the lower", q: quotas{DayHours: 8, TeamDayHours: 4}, rule: RecurringRule{Kind: RecurDaily, At: "09:00", Minutes: 5 * 60}, wantKind: quotaDay},
+		{name: "two a day", q: quotas{DayHours: 8}, rule: RecurringRule{Kind: RecurCron, Cron: "0 8,14 * * *", Minutes: 5 * 60}, wantKind: quotaDay},
+		{name: "week", q: quotas{DayHours: 8, WeekHours: 30}, rule: RecurringRule{Kind: RecurDaily, At: "09:00", Minutes: 5 * 60}, wantKind: quotaWeek},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.q.checkRule(&tt.rule, now)
+			var qe *QuotaError
+			switch {
+			case tt.wantKind == "" && err != nil:
+				t.Fatalf("err = %v, want nil", err)
+			case tt.wantKind != "" && (!errors.As(err, &qe) || qe.Kind != tt.wantKind):
+				t.Fatalf("err = %v, want %s quota error", err, tt.wantKind)
+			}
+		})
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const dateLayout = "2006-01-02"
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+	"вс": time.Sunday, "пн": time.Monday, "вт": time.Tuesday, "ср": time.Wednesday,
+	"чт": time.Thursday, "пт": time.Friday, "сб": time.Saturday,
+}
+
+// validateRule checks a rule for res before it is stored.
+func (p *Plugin) validateRule(res *Resource, rule *RecurringRule) error {
+	if rule.Minutes <= 0 {
+		return fmt.Errorf("длительность должна быть не меньше минуты")
+	}
+	if err := p.limitsFor(res).checkBooking(time.Duration(rule.Minutes) * time.Minute); err != nil {
+		return errors.New(p.limitErrText(res, err))
+	}
+	switch rule.Kind {
+	case RecurDaily, RecurWeekdays, RecurWeekly:
+		if _, err := time.Parse("15:04", rule.At); err != nil {
+			return fmt.Errorf("неверное время начала `%s` (формат ЧЧ:ММ)", rule.At)
+		}
+		if rule.Kind == RecurWeekly && len(rule.Weekdays) == 0 {
+			return fmt.Errorf("укажите дни недели")
+		}
+	case RecurCron:
+		if _, err := parseCron(rule.Cron); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("неизвестный тип расписания `%s`", rule.Kind)
+	}
+	if rule.Until != "" {
+		if _, err := time.ParseInLocation(dateLayout, rule.Until, time.Local); err != nil {
+			return fmt.Errorf("неверная дата окончания `%s` (формат ГГГГ-ММ-ДД)", rule.Until)
+		}
+	}
+	for _, d := range rule.Exceptions {
+		if _, err := time.ParseInLocation(dateLayout, d, time.Local); err != nil {
+			return fmt.Errorf("неверная дата исключения `%s` (формат ГГГГ-ММ-ДД)", d)
+		}
+	}
+	return nil
+}
+
+// addRecurringRule validates and stores a new rule for res.
+func (p *Plugin) addRecurringRule(res *Resource, rule RecurringRule) (*RecurringRule, error) {
+	rule.ID = model.NewId()[:8]
+	rule.ResourceID = res.ID
+	rule.CreatedAt = time.Now()
+	if err := p.validateRule(res, &rule); err != nil {
+		return nil, err
+	}
+	if err := p.quotas().checkRule(&rule, rule.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := p.store.AddRecurringRule(rule); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// deleteRecurringRule removes a rule owned by actorID (managers may delete any)
+// together with the reservations already expanded from it.
+func (p *Plugin) deleteRecurringRule(res *Resource, id, actorID string) (*RecurringRule, error) {
+	manager := p.canManage(actorID, res)
+	rule, err := p.store.RemoveRecurringRule(res.ID, id, func(r *RecurringRule) error {
+		if r.UserID != actorID && !manager {
+			return errNotHolder
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	rsvs, _ := p.store.GetReservations(res.ID)
+	for _, r := range rsvs {
+		if r.RuleID == rule.ID {
+			p.store.RemoveReservation(res.ID, r.ID, nil)
+		}
+	}
+	return rule, nil
+}
+
+// skipRecurringDate adds an exception date to a rule and drops the
+// reservation already expanded for that date, if any.
+func (p *Plugin) skipRecurringDate(res *Resource, id, date, actorID string) (*RecurringRule, error) {
+	if _, err := time.ParseInLocation(dateLayout, date, time.Local); err != nil {
+		return nil, fmt.Errorf("неверная дата `%s` (формат ГГГГ-ММ-ДД)", date)
+	}
+	manager := p.canManage(actorID, res)
+	rule, err := p.store.UpdateRecurringRule(res.ID, id, func(r *RecurringRule) error {
+		if r.UserID != actorID && !manager {
+			return errNotHolder
+		}
+		for _, d := range r.Exceptions {
+			if d == date {
+				return nil
+			}
+		}
+		r.Exceptions = append(r.Exceptions, date)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	rsvs, _ := p.store.GetReservations(res.ID)
+	for _, r := range rsvs {
+		if r.RuleID == rule.ID && r.StartsAt.Format(dateLayout) == date {
+			p.store.RemoveReservation(res.ID, r.ID, nil)
+		}
+	}
+	return rule, nil
+}
+
+// expandRecurring creates reservations for rule occurrences starting within
+// recurLookahead. Reservation IDs are derived from the rule and start time,
+// so repeating an expansion after a partial run creates no duplicates.
+func (p *Plugin) expandRecurring(resourceID, name string) {
+	rules, err := p.store.GetRecurringRules(resourceID)
+	if err != nil {
+		return
+	}
+	seats := 1
+	if res, _ := p.store.GetResource(resourceID); res != nil {
+		seats = res.Seats()
+	}
+	now := time.Now()
+	horizon := now.Add(recurLookahead)
+	for i := range rules {
+		rule := &rules[i]
+		from := rule.ExpandedUntil
+		if from.Before(now) {
+			from = now
+		}
+		if !from.Before(horizon) {
+			continue
+		}
+		for _, start := range rule.Occurrences(from, horizon) {
+			p.materializeOccurrence(rule, start, name, seats)
+		}
+		p.store.UpdateRecurringRule(resourceID, rule.ID, func(r *RecurringRule) error {
+			if r.ExpandedUntil.Before(horizon) {
+				r.ExpandedUntil = horizon
+			}
+			return nil
+		})
+	}
+}
+
+func (p *Plugin) materializeOccurrence(rule *RecurringRule, start time.Time, name string, seats int) {
+	r := Reservation{
+		ID:         rule.ID + "-" + start.Format("0601021504"),
+		ResourceID: rule.ResourceID, UserID: rule.UserID, Purpose: rule.Purpose,
+		StartsAt: start, EndsAt: start.Add(time.Duration(rule.Minutes) * time.Minute),
+		CreatedAt: time.Now(), RuleID: rule.ID,
+	}
+	err := p.store.AddReservation(r, seats)
+	var ce *ConflictError
+	if err == nil || (errors.As(err, &ce) && ce.With.ID == r.ID) {
+		return
+	}
+	if ce != nil {
+		p.sendDM(rule.UserID, fmt.Sprintf(
+			"⚠️ Повторное бронирование **%s** на %s пропущено: пересекается с резервированием %s %s–%s.",
+			name, start.Format("02.01 15:04"), p.displayName(ce.With.UserID),
+			ce.With.StartsAt.Format("15:04"), ce.With.EndsAt.Format("15:04")))
+		return
+	}
+	p.API.LogWarn("materializeOccurrence: AddReservation", "rule", rule.ID, "err", err.Error())
+}
+
+// recurringWarning returns a chat note if a booking of userID lasting until
+// `until` runs into someone else's recurring slot, or "" otherwise.
+func (p *Plugin) recurringWarning(resourceID, userID string, until time.Time) string {
+	rules, _ := p.store.GetRecurringRules(resourceID)
+	now := time.Now()
+	for i := range rules {
+		rule := &rules[i]
+		if rule.UserID == userID {
+			continue
+		}
+		if occ := rule.Occurrences(now, until); len(occ) > 0 {
+			return fmt.Sprintf("\n⚠️ С %s ресурс занят по расписанию %s (%s) — ваша бронь будет прервана.",
+				occ[0].Format("02.01 15:04"), p.displayName(rule.UserID), rule.Describe())
+		}
+	}
+	return ""
+}
+
+// Occurrences returns the rule's start times in [from, to), honouring Until
+// and Exceptions.
+func (r *RecurringRule) Occurrences(from, to time.Time) []time.Time {
+	var out []time.Time
+	var until time.Time
+	if r.Until != "" {
+		if d, err := time.ParseInLocation(dateLayout, r.Until, time.Local); err == nil {
+			until = d.AddDate(0, 0, 1)
+		}
+	}
+	keep := func(t time.Time) bool {
+		if t.Before(from) || !t.Before(to) || (!until.IsZero() && !t.Before(until)) {
+			return false
+		}
+		day := t.Format(dateLayout)
+		for _, d := range r.Exceptions {
+			if d == day {
+				return false
+			}
+		}
+		return true
+	}
+
+	if r.Kind == RecurCron {
+		spec, err := parseCron(r.Cron)
+		if err != nil {
+			return nil
+		}
+		for t := from.Truncate(time.Minute); t.Before(to); t = t.Add(time.Minute) {
+			if spec.matches(t) && keep(t) {
+				out = append(out, t)
+			}
+		}
+		return out
+	}
+
+	at, err := time.Parse("15:04", r.At)
+	if err != nil {
+		return nil
+	}
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local)
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		wd := day.Weekday()
+		switch r.Kind {
+		case RecurWeekdays:
+			if wd == time.Saturday || wd == time.Sunday {
+				continue
+			}
+		case RecurWeekly:
+			if !containsWeekday(r.Weekdays, wd) {
+				continue
+			}
+		}
+		t := time.Date(day.Year(), day.Month(), day.Day(), at.Hour(), at.Minute(), 0, 0, time.Local)
+		if keep(t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Describe renders the schedule for chat, e.g. "пн,чт 10:00".
+func (r *RecurringRule) Describe() string {
+	var sched string
+	switch r.Kind {
+	case RecurDaily:
+		sched = "ежедневно " + r.At
+	case RecurWeekdays:
+		sched = "по будням " + r.At
+	case RecurWeekly:
+		names := make([]string, 0, len(r.Weekdays))
+		for _, wd := range r.Weekdays {
+			names = append(names, []string{"вс", "пн", "вт", "ср", "чт", "пт", "сб"}[wd])
+		}
+		sched = strings.Join(names, ",") + " " + r.At
+	case RecurCron:
+		sched = "cron `" + r.Cron + "`"
+	}
+	sched += ", " + formatDuration(time.Duration(r.Minutes)*time.Minute)
+	if r.Until != "" {
+		sched += ", до " + r.Until
+	}
+	return sched
+}
+
+func containsWeekday(days []time.Weekday, wd time.Weekday) bool {
+	for _, d := range days {
+		if d == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// parseWeekdays parses "mon,thu" or "пн,чт".
+func parseWeekdays(s string) ([]time.Weekday, error) {
+	var out []time.Weekday
+	for _, name := range strings.Split(strings.ToLower(s), ",") {
+		wd, ok := weekdayNames[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("неизвестный день недели `%s`", name)
+		}
+		if !containsWeekday(out, wd) {
+			out = append(out, wd)
+		}
+	}
+	return out, nil
+}
+
+// --- cron ---
+
+// cronSpec is a parsed 5-field cron expression: minute, hour, day of month,
+// month, day of week (0 and 7 are Sunday).
+type cronSpec struct {
+	minute, hour, dom, month, dow []bool
+	domAny, dowAny                bool
+}
+
+func parseCron(expr string) (*cronSpec, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron-выражение должно содержать 5 полей: `мин час день месяц день_недели`")
+	}
+	var spec cronSpec
+	var err error
+	if spec.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if spec.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if spec.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if spec.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if spec.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	if spec.dow[7] {
+		spec.dow[0] = true
+	}
+	spec.domAny = fields[2] == "*"
+	spec.dowAny = fields[4] == "*"
+	return &spec, nil
+}
+
+func parseCronField(field string, min, max int) ([]bool, error) {
+	set := make([]bool, max+1)
+	bad := fmt.Errorf("неверное поле cron `%s`", field)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return nil, bad
+			}
+			step = n
+			part = part[:i]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, bad
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, bad
+				}
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, bad
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+func (c *cronSpec) matches(t time.Time) bool {
+	if !c.minute[t.Minute()] || !c.hour[t.Hour()] || !c.month[int(t.Month())] {
+		return false
+	}
+	domOK, dowOK := c.dom[t.Day()], c.dow[int(t.Weekday())]
+	// Standard cron: if both day fields are restricted, either may match.
+	if !c.domAny && !c.dowAny {
+		return domOK || dowOK
+	}
+	return domOK && dowOK
+}
+
+// splitQuoted splits s on whitespace, keeping "double quoted" parts together.
+func splitQuoted(s string) []string {
+	var out []string
+	var cur strings.Builder
+	inQuote := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case r == ' ' && !inQuote:
+			if cur.Len() > 0 {
+				out = append(out, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		out = append(out, cur.String())
+	}
+	return out
+}
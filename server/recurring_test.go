@@ -0,0 +1,168 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// local builds a time.Local timestamp from "2006-01-02 15:04".
+func local(t *testing.T, s string) time.Time {
+	t.Helper()
+	v, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{expr: "0 10 * * 1"},
+		{expr: "*/15 9-17 * * 1-5"},
+		{expr: "0 0 1,15 * *"},
+		{expr: "30 8 * 1-12/3 7"},
+		{expr: "0 10 * *", wantErr: true},
+		{expr: "0 10 * * 1 2", wantErr: true},
+		{expr: "60 10 * * *", wantErr: true},
+		{expr: "0 24 * * *", wantErr: true},
+		{expr: "0 10 0 * *", wantErr: true},
+		{expr: "0 10 * 13 *", wantErr: true},
+		{expr: "0 10 * * 8", wantErr: true},
+		{expr: "0 10 * * 5-1", wantErr: true},
+		{expr: "*/0 10 * * *", wantErr: true},
+		{expr: "a 10 * * *", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := parseCron(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseCron(%q) err = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCronMatches(t *testing.T) {
+	// 2026-10-05 is a Monday, 2026-10-11 a Sunday.
+	tests := []struct {
+		expr string
+		at   string
+		want bool
+	}{
+		{"0 10 * * 1", "2026-10-05 10:00", true},
+		{"0 10 * * 1", "2026-10-05 10:01", false},
+		{"0 10 * * 1", "2026-10-06 10:00", false},
+		{"0 10 * * 7", "2026-10-11 10:00", true},
+		{"0 10 * * 0", "2026-10-11 10:00", true},
+		{"*/15 9-17 * * 1-5", "2026-10-07 17:45", true},
+		{"*/15 9-17 * * 1-5", "2026-10-07 17:50", false},
+		{"*/15 9-17 * * 1-5", "2026-10-10 12:00", false},
+		// Both day fields restricted: either one matching is enough.
+		{"0 10 15 * 1", "2026-10-15 10:00", true},
+		{"0 10 15 * 1", "2026-10-12 10:00", true},
+		{"0 10 15 * 1", "2026-10-13 10:00", false},
+		// Only one restricted: it alone decides.
+		{"0 10 15 * *", "2026-10-12 10:00", false},
+		{"0 10 * 11 *", "2026-10-12 10:00", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr+" @ "+tt.at, func(t *testing.T) {
+			spec, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := spec.matches(local(t, tt.at)); got != tt.want {
+				t.Errorf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	// The window is Monday 2026-10-05 00:00 to Monday 2026-10-12 00:00.
+	tests := []struct {
+		name string
+		rule RecurringRule
+		from string // defaults to the window start
+		want []string
+	}{
+		{
+			name: "daily",
+			rule: RecurringRule{Kind: RecurDaily, At: "09:30"},
+			want: []string{
+				"2026-10-05 09:30", "2026-10-06 09:30", "2026-10-07 09:30", "2026-10-08 09:30",
+				"2026-10-09 09:30", "2026-10-10 09:30", "2026-10-11 09:30",
+			},
+		},
+		{
+			name: "from skips today's start already past",
+			rule: RecurringRule{Kind: RecurDaily, At: "09:30", Until: "2026-10-06"},
+			from: "2026-10-05 09:31",
+			want: []string{"2026-10-06 09:30"},
+		},
+		{
+			name: "weekdays",
+			rule: RecurringRule{Kind: RecurWeekdays, At: "10:00"},
+			want: []string{
+				"2026-10-05 10:00", "2026-10-06 10:00", "2026-10-07 10:00", "2026-10-08 10:00",
+				"2026-10-09 10:00",
+			},
+		},
+		{
+			name: "weekly",
+			rule: RecurringRule{Kind: RecurWeekly, At: "10:00", Weekdays: []time.Weekday{time.Monday, time.Thursday}},
+			want: []string{"2026-10-05 10:00", "2026-10-08 10:00"},
+		},
+		{
+			name: "until is inclusive",
+			rule: RecurringRule{Kind: RecurDaily, At: "23:30", Until: "2026-10-07"},
+			want: []string{"2026-10-05 23:30", "2026-10-06 23:30", "2026-10-07 23:30"},
+		},
+		{
+			name: "until before the window",
+			rule: RecurringRule{Kind: RecurDaily, At: "10:00", Until: "2026-10-04"},
+		},
+		{
+			name: "exceptions",
+			rule: RecurringRule{Kind: RecurWeekdays, At: "10:00", Exceptions: []string{"2026-10-06", "2026-10-08"}},
+			want: []string{"2026-10-05 10:00", "2026-10-07 10:00", "2026-10-09 10:00"},
+		},
+		{
+			name: "exception on the until day",
+			rule: RecurringRule{Kind: RecurDaily, At: "10:00", Until: "2026-10-06", Exceptions: []string{"2026-10-06"}},
+			want: []string{"2026-10-05 10:00"},
+		},
+		{
+			name: "cron with until and exceptions",
+			rule: RecurringRule{Kind: RecurCron, Cron: "0 8,20 * * *", Until: "2026-10-07", Exceptions: []string{"2026-10-06"}},
+			want: []string{"2026-10-05 08:00", "2026-10-05 20:00", "2026-10-07 08:00", "2026-10-07 20:00"},
+		},
+		{
+			name: "bad cron yields nothing",
+			rule: RecurringRule{Kind: RecurCron, Cron: "0 8 * *"},
+		},
+		{
+			name: "bad time yields nothing",
+			rule: RecurringRule{Kind: RecurDaily, At: "25:00"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from := "2026-10-05 00:00"
+			if tt.from != "" {
+				from = tt.from
+			}
+			var got []string
+			for _, o := range tt.rule.Occurrences(local(t, from), local(t, "2026-10-12 00:00")) {
+				got = append(got, o.Format("2006-01-02 15:04"))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Occurrences = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
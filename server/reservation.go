@@ -0,0 +1,265 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+var errBadSlot = errors.New("invalid reservation slot")
+
+// reserveResource schedules a booking of res for userID from start for dur.
+// The slot must leave a seat free given other reservations and current bookings.
+func (p *Plugin) reserveResource(res *Resource, userID string, start time.Time, dur time.Duration, purpose string) (*Reservation, error) {
+	now := time.Now()
+	if !start.After(now) || start.After(now.Add(maxReserveAhead)) {
+		return nil, errBadSlot
+	}
+	if err := p.limitsFor(res).checkBooking(dur); err != nil {
+		return nil, err
+	}
+	if err := p.checkQuotaSpan(userID, []*Resource{res}, start, start.Add(dur), false); err != nil {
+		return nil, err
+	}
+	if p.needsApproval(res, userID) {
+		return nil, errApprovalRequired
+	}
+	if m := res.Maintenance; m != nil && m.StartsAt.Before(start.Add(dur)) && (m.EndsAt.IsZero() || m.EndsAt.After(start)) {
+		return nil, errMaintenance
+	}
+	r := Reservation{
+		ID: model.NewId()[:8], ResourceID: res.ID, UserID: userID, Purpose: purpose,
+		StartsAt: start, EndsAt: start.Add(dur), CreatedAt: now,
+	}
+	bookings, _ := p.store.GetBookings(res.ID)
+	busy := 0
+	for _, b := range bookings {
+		if b.UserID != userID && b.ExpiresAt.After(r.StartsAt) {
+			busy++
+		}
+	}
+	if busy >= res.Seats() {
+		return nil, ErrBusy
+	}
+	if err := p.store.AddReservation(r, res.Seats()); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// cancelReservation removes a reservation owned by actorID (managers may cancel any).
+func (p *Plugin) cancelReservation(res *Resource, id, actorID string) (*Reservation, error) {
+	manager := p.canManage(actorID, res)
+	return p.store.RemoveReservation(res.ID, id, func(r *Reservation) error {
+		if r.UserID != actorID && !manager {
+			return errNotHolder
+		}
+		return nil
+	})
+}
+
+// reservationWarning returns a chat note if a booking of userID lasting until
+// `until` runs into scheduled maintenance or someone else's reservation or
+// recurring slot, or "" otherwise.
+// On multi-seat resources only reservations beyond the remaining free seats count.
+func (p *Plugin) reservationWarning(res *Resource, userID string, until time.Time) string {
+	if w := maintenanceWarning(res, until); w != "" {
+		return w
+	}
+	free := res.Seats() - 1 // the seat of the booking itself
+	if free > 0 {
+		bookings, _ := p.store.GetBookings(res.ID)
+		for _, b := range bookings {
+			if b.UserID != userID {
+				free--
+			}
+		}
+	}
+	rsvs, _ := p.store.GetReservations(res.ID)
+	now := time.Now()
+	for _, r := range rsvs {
+		if r.UserID == userID || !r.Overlaps(now, until) {
+			continue
+		}
+		if free > 0 {
+			free--
+			continue
+		}
+		return fmt.Sprintf("\n⚠️ С %s ресурс зарезервирован %s — ваша бронь будет прервана.",
+			r.StartsAt.Format("02.01 15:04"), p.displayName(r.UserID))
+	}
+	if free > 0 {
+		return ""
+	}
+	return p.recurringWarning(res.ID, userID, until)
+}
+
+// activateReservations turns due reservations into live bookings. Called by
+// the scheduler; safe to repeat after a partial run because the booking is
+// tagged with the reservation ID before the reservation is removed.
+func (p *Plugin) activateReservations(resourceID, name string) {
+	if res, _ := p.store.GetResource(resourceID); res != nil && inMaintenance(res) {
+		return // started once maintenance ends, if still running
+	}
+	rsvs, err := p.store.GetReservations(resourceID)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for i := range rsvs {
+		r := &rsvs[i]
+		if r.StartsAt.After(now) {
+			break
+		}
+		if r.EndsAt.After(now) && !p.startReservation(r, name) {
+			continue // try again next tick
+		}
+		p.store.RemoveReservation(resourceID, r.ID, nil)
+	}
+}
+
+// startReservation books a seat for the reservation owner, replacing their
+// own booking if they have one and otherwise bumping the holder whose booking
+// ends soonest when all seats are taken. Returns false if the booking could
+// not be created and should be tried again; a reservation the owner's quota
+// no longer allows is dropped with a DM instead.
+func (p *Plugin) startReservation(r *Reservation, name string) bool {
+	res, _ := p.store.GetResource(r.ResourceID)
+	if res == nil {
+		return false
+	}
+	bookings, _ := p.store.GetBookingsRaw(r.ResourceID)
+	var current *Booking
+	for i, b := range bookings {
+		if b.ReservationID == r.ID {
+			return true // already started by an earlier tick
+		}
+		if b.UserID == r.UserID && !b.IsExpired() && !b.Hold {
+			current = &bookings[i]
+		}
+	}
+	// Time the owner's current booking covers is counted already.
+	from := time.Now()
+	if current != nil && current.ExpiresAt.After(from) {
+		from = current.ExpiresAt
+	}
+	if from.After(r.EndsAt) {
+		from = r.EndsAt
+	}
+	if err := p.checkQuotaSpan(r.UserID, []*Resource{res}, from, r.EndsAt, current == nil); err != nil {
+		if !errors.Is(err, errQuota) {
+			return false
+		}
+		p.sendDM(r.UserID, fmt.Sprintf("📅 Резервирование **%s** на %s отменено.\n%s",
+			name, r.StartsAt.Format("02.01 15:04"), quotaErrText(err)))
+		return true
+	}
+	if own, err := p.store.TakeBooking(r.ResourceID, r.UserID, func(b *Booking) error { return nil }); err == nil {
+		ended := time.Now()
+		if own.IsExpired() {
+			ended = own.ExpiresAt
+		}
+		p.store.AddHistory(own.History(ended))
+	}
+	active := 0
+	var victim *Booking
+	for i := range bookings {
+		b := &bookings[i]
+		if b.IsExpired() || b.UserID == r.UserID {
+			continue
+		}
+		active++
+		if victim == nil || b.ExpiresAt.Before(victim.ExpiresAt) {
+			victim = b
+		}
+	}
+	if active >= res.Seats() && victim != nil {
+		p.bumpBooking(victim, r, name)
+	}
+	b := &Booking{
+		ResourceID: r.ResourceID, UserID: r.UserID, Purpose: r.Purpose,
+		StartedAt: time.Now(), ExpiresAt: r.EndsAt, ReservationID: r.ID,
+	}
+	if err := p.store.CreateBooking(b, res.Seats()); err != nil {
+		p.API.LogWarn("startReservation: CreateBooking", "resource", r.ResourceID, "err", err.Error())
+		return false
+	}
+	p.store.RemoveFromQueue(r.ResourceID, r.UserID)
+	p.sendDM(r.UserID, fmt.Sprintf("📅 Ваше резервирование **%s** началось — ресурс ваш до %s.",
+		name, r.EndsAt.Format("15:04")))
+	p.notifySubscribers(r.ResourceID, fmt.Sprintf("🔒 **%s** занят @%s (резервирование) до %s",
+		name, p.username(r.UserID), r.EndsAt.Format("15:04")), r.UserID)
+	return true
+}
+
+// bumpBooking ends victim's booking to make room for reservation r.
+func (p *Plugin) bumpBooking(victim *Booking, r *Reservation, name string) {
+	bumped, err := p.store.TakeBooking(r.ResourceID, victim.UserID, func(b *Booking) error {
+		if !b.StartedAt.Equal(victim.StartedAt) {
+			return ErrConflict
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	p.store.AddHistory(bumped.History(time.Now()))
+	if bumped.BundleID != "" {
+		p.cleanupBundle(bumped.BundleID)
+	}
+	p.sendDM(bumped.UserID, fmt.Sprintf(
+		"⛔ Бронирование **%s** прервано: начинается резервирование @%s до %s.",
+		name, p.username(r.UserID), r.EndsAt.Format("15:04")))
+}
+
+// reserveErrText renders a failed reservation attempt for chat responses.
+func (p *Plugin) reserveErrText(res *Resource, err error) string {
+	var ce *ConflictError
+	switch {
+	case errors.As(err, &ce):
+		return fmt.Sprintf("🔴 Пересекается с резервированием %s %s–%s",
+			p.displayName(ce.With.UserID), ce.With.StartsAt.Format("02.01 15:04"), ce.With.EndsAt.Format("15:04"))
+	case errors.Is(err, ErrBusy):
+		return p.bookErrText(res, err) + " — слот пересекается с текущей бронью"
+	case errors.Is(err, errBadSlot):
+		return "Начало должно быть в будущем, но не дальше чем через 90 дней"
+	}
+	return p.bookErrText(res, err)
+}
+
+// parseStartTime parses a reservation start in server local time:
+// "15:04" (today, or tomorrow if already past), "02.01-15:04",
+// "02.01.2006-15:04", "2006-01-02T15:04" or a relative "+2h".
+func parseStartTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if strings.HasPrefix(s, "+") {
+		d, err := parseDuration(s[1:])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(d).Truncate(time.Minute), nil
+	}
+	if t, err := time.ParseInLocation("15:04", s, time.Local); err == nil {
+		at := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, time.Local)
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+		return at, nil
+	}
+	if t, err := time.ParseInLocation("02.01-15:04", s, time.Local); err == nil {
+		at := time.Date(now.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.Local)
+		if !at.After(now) {
+			at = at.AddDate(1, 0, 0)
+		}
+		return at, nil
+	}
+	for _, layout := range []string{"02.01.2006-15:04", "2006-01-02t15:04"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("неверное время начала: `%s` (примеры: 14:00, 25.12-14:00, +2h)", s)
+}
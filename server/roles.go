@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Resource managers. Besides system admins the plugin has its own manager
+// role, held by users or group members. Global managers (stored under
+// keyManagers) manage every resource and may create new ones; the managers
+// of one resource (Resource.Managers) may edit and delete it, force-release
+// and book for others, remove queue entries and approve its bookings. Managers
+// always see what they manage, whatever its Access says. Only system admins
+// appoint global managers.
+
+const maxManagers = 50
+
+var (
+	errNotManager = errors.New("not a manager of the resource")
+	errNotQueued  = errors.New("user is not in the queue")
+)
+
+// managerChecker returns a function reporting whether userID manages a
+// resource; a nil resource asks for the global role. The global managers and
+// the user's groups are looked up once, so checking a whole list stays cheap.
+func (p *Plugin) managerChecker(userID string) func(res *Resource) bool {
+	if p.isAdmin(userID) {
+		return func(*Resource) bool { return true }
+	}
+	var groups []string
+	loaded := false
+	member := func(m *Managers) bool {
+		if m == nil {
+			return false
+		}
+		if containsString(m.Users, userID) {
+			return true
+		}
+		if len(m.Groups) == 0 {
+			return false
+		}
+		if !loaded {
+			loaded = true
+			groups = p.userGroups(userID)
+		}
+		return intersects(m.Groups, groups)
+	}
+	if global, _ := p.store.GetManagers(); member(global) {
+		return func(*Resource) bool { return true }
+	}
+	return func(res *Resource) bool {
+		return res != nil && member(res.Managers)
+	}
+}
+
+// canManage reports whether userID manages res, or all resources if res is nil.
+func (p *Plugin) canManage(userID string, res *Resource) bool {
+	return p.managerChecker(userID)(res)
+}
+
+// userGroups returns the names of the groups userID belongs to.
+func (p *Plugin) userGroups(userID string) []string {
+	gs, appErr := p.API.GetGroupsForUser(userID)
+	if appErr != nil {
+		return nil
+	}
+	var names []string
+	for _, g := range gs {
+		if g.Name != nil {
+			names = append(names, *g.Name)
+		}
+	}
+	return names
+}
+
+// groupMemberIDs appends the members of group name to ids, up to limit.
+func (p *Plugin) groupMemberIDs(ids []string, name string, limit int) []string {
+	g, appErr := p.API.GetGroupByName(name)
+	if appErr != nil {
+		p.API.LogWarn("groupMemberIDs: GetGroupByName", "group", name, "err", appErr.Error())
+		return ids
+	}
+	const perPage = 100
+	for page := 0; len(ids) < limit; page++ {
+		users, appErr := p.API.GetGroupMemberUsers(g.Id, page, perPage)
+		if appErr != nil {
+			break
+		}
+		for _, u := range users {
+			if !containsString(ids, u.Id) && len(ids) < limit {
+				ids = append(ids, u.Id)
+			}
+		}
+		if len(users) < perPage {
+			break
+		}
+	}
+	return ids
+}
+
+// describeManagers renders m for chat, or "" if nobody is in it.
+func (p *Plugin) describeManagers(m *Managers) string {
+	if m == nil {
+		return ""
+	}
+	var parts []string
+	for _, id := range m.Users {
+		parts = append(parts, p.displayName(id))
+	}
+	for _, g := range m.Groups {
+		parts = append(parts, "группа `"+g+"`")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// kickFromQueue removes userID from the queue of res on behalf of a manager
+// and tells them.
+func (p *Plugin) kickFromQueue(res *Resource, actorID, userID string) error {
+	if !p.canManage(actorID, res) {
+		return errNotManager
+	}
+	entries, err := p.store.GetQueueEntries(res.ID)
+	if err != nil {
+		return err
+	}
+	queued := false
+	for _, e := range entries {
+		queued = queued || e.UserID == userID
+	}
+	if !queued {
+		return errNotQueued
+	}
+	p.store.RemoveFromQueue(res.ID, userID)
+	if userID != actorID {
+		p.sendDM(userID, fmt.Sprintf("🚪 @%s убрал вас из очереди на **%s**", p.username(actorID), res.Name))
+	}
+	return nil
+}
+
+// sanitizeManagers cleans input; an empty list clears it.
+func sanitizeManagers(m *Managers) *Managers {
+	if m == nil {
+		return nil
+	}
+	out := &Managers{}
+	for _, uid := range m.Users {
+		if model.IsValidId(uid) && !containsString(out.Users, uid) && len(out.Users) < maxManagers {
+			out.Users = append(out.Users, uid)
+		}
+	}
+	for _, g := range mergeNames(nil, m.Groups) {
+		if len(out.Groups) < maxManagers {
+			out.Groups = append(out.Groups, g)
+		}
+	}
+	if len(out.Users) == 0 && len(out.Groups) == 0 {
+		return nil
+	}
+	return out
+}
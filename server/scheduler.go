@@ -3,96 +3,190 @@ package main
 import (
 	"fmt"
 	"time"
+
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
 )
 
+const schedulerJobKey = "rq_scheduler"
+
+// Scheduler runs tick on one node of the cluster at a time. The cluster job
+// holds a KV-backed mutex while ticking and records when the last run
+// finished, so however many plugin instances are running, each interval is
+// processed once. If a node dies mid-tick the mutex expires and another node
+// picks the work up; tick itself is idempotent, so a partial run is safe to
+// repeat.
 type Scheduler struct {
 	plugin *Plugin
-	stop   chan struct{}
-	done   chan struct{}
+	job    *cluster.Job
 }
 
 func NewScheduler(p *Plugin) *Scheduler {
-	return &Scheduler{
-		plugin: p,
-		stop:   make(chan struct{}),
-		done:   make(chan struct{}),
-	}
+	return &Scheduler{plugin: p}
 }
 
-func (s *Scheduler) Start() {
-	go s.run()
+func (s *Scheduler) Start() error {
+	interval := time.Duration(s.plugin.cfgCheckSeconds()) * time.Second
+	job, err := cluster.Schedule(s.plugin.API, schedulerJobKey, cluster.MakeWaitForInterval(interval), s.tick)
+	if err != nil {
+		return err
+	}
+	s.job = job
+	return nil
 }
 
 func (s *Scheduler) Stop() {
-	close(s.stop)
-	<-s.done // wait for goroutine to exit
+	if s.job != nil {
+		s.job.Close() // waits for a running tick to finish
+	}
 }
 
-func (s *Scheduler) run() {
-	defer close(s.done)
+// tick works from the resource index, after repairing entries a failed
+// refresh left stale, so idle resources cost nothing beyond reading it: per-resource keys are only read for resources that have
+// bookings, maintenance, recurring rules, reservations or approval requests.
+// Every step re-checks the source atomically before acting, so an index entry
+// a moment out of date only delays the work to the next tick.
+func (s *Scheduler) tick() {
+	if err := s.plugin.store.RepairIndex(); err != nil {
+		s.plugin.API.LogWarn("scheduler: RepairIndex", "err", err.Error())
+	}
+	entries, err := s.plugin.store.IndexEntries()
+	if err != nil {
+		return
+	}
+
+	for _, e := range entries {
+		res := &e.Resource
+		id, name := res.ID, res.Name
+		if res.Maintenance != nil {
+			if fresh, _ := s.plugin.store.GetResource(id); fresh != nil {
+				s.plugin.checkMaintenance(fresh)
+			}
+		}
 
-	interval := time.Duration(s.plugin.cfgCheckSeconds()) * time.Second
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			s.tick()
-		case <-s.stop:
-			return
+		s.checkBookings(id, name, e.Bookings, s.plugin.limitsFor(res).WarnBefore)
+		if e.Rules > 0 {
+			s.plugin.expandRecurring(id, name)
+		}
+		if e.Rules > 0 || e.Reservations > 0 {
+			s.plugin.activateReservations(id, name)
+		}
+		if e.Approvals > 0 {
+			s.plugin.expireApprovals(id, name)
 		}
 	}
+	s.plugin.refreshBoards()
 }
 
-func (s *Scheduler) tick() {
-	ids, err := s.plugin.store.getResourceIDs()
-	if err != nil {
-		return
+// checkBookings expires or warns about each holder of a resource, expired
+// bookings included. Every booking is handled on its own, so one seat
+// expiring frees just that seat.
+func (s *Scheduler) checkBookings(id, name string, bookings []Booking, notifyBefore time.Duration) {
+	for i := range bookings {
+		s.checkBooking(id, name, &bookings[i], notifyBefore)
 	}
+}
 
-	notifyBefore := time.Duration(s.plugin.cfgNotifyMinutes()) * time.Minute
+func (s *Scheduler) checkBooking(id, name string, booking *Booking, notifyBefore time.Duration) {
+	left := time.Until(booking.ExpiresAt)
 
-	for _, id := range ids {
-		// Use Raw to see expired bookings before cleanup
-		booking, err := s.plugin.store.GetBookingRaw(id)
-		if err != nil || booking == nil {
-			continue
+	if booking.Hold {
+		if left <= 0 {
+			s.expireHold(id, name, booking)
 		}
+		return
+	}
 
-		res, _ := s.plugin.store.GetResource(id)
-		name := id
-		if res != nil {
-			name = res.Name
+	if left <= 0 {
+		// Expired — auto-release. The index copy may be out of date, so the
+		// stored booking is first flagged Ended, which fails if it was
+		// extended meanwhile and freezes it otherwise. History is recorded
+		// from the flagged booking (AddHistory ignores duplicates) before it
+		// is taken, so a crash in between just repeats this on the next tick.
+		// Taking the booking is atomic and is the point after which the
+		// expiry counts as processed.
+		ended, err := s.plugin.store.EndBooking(id, booking.UserID, booking.StartedAt)
+		if err != nil {
+			return
+		}
+		s.plugin.store.AddHistory(ended.History(ended.ExpiresAt))
+		taken, err := s.plugin.store.TakeBooking(id, booking.UserID, func(b *Booking) error {
+			if !b.Ended || !b.StartedAt.Equal(ended.StartedAt) {
+				return ErrBusy
+			}
+			return nil
+		})
+		if err != nil {
+			return
+		}
+		if taken.PreemptedBy != "" {
+			s.plugin.completePreemption(id, name, taken)
+			return
 		}
+		s.plugin.sendDM(taken.UserID,
+			fmt.Sprintf("⏰ Время бронирования **%s** истекло. Ресурс освобождён.", name))
+		text := fmt.Sprintf("🔓 **%s** освобождён (время истекло)", name)
+		if res, _ := s.plugin.store.GetResource(id); res != nil {
+			s.plugin.notifyFreed(res, text)
+		} else {
+			s.plugin.notifySubscribers(id, text, "")
+		}
+		s.plugin.processQueue(id, name)
+		if taken.BundleID != "" {
+			s.plugin.cleanupBundle(taken.BundleID)
+		}
+		return
+	}
 
-		left := time.Until(booking.ExpiresAt)
+	if booking.PreemptedBy != "" {
+		if res, _ := s.plugin.store.GetResource(id); res != nil {
+			s.plugin.updatePreemptCountdown(res, booking)
+		}
+		return
+	}
 
-		if left <= 0 {
-			// Expired — auto-release
-			s.plugin.store.AddHistory(HistoryEntry{
-				UserID:     booking.UserID,
-				ResourceID: id,
-				Purpose:    booking.Purpose,
-				StartedAt:  booking.StartedAt,
-				EndedAt:    booking.ExpiresAt,
-			})
-			s.plugin.store.DeleteBooking(id)
-			s.plugin.sendDM(booking.UserID,
-				fmt.Sprintf("⏰ Время бронирования **%s** истекло. Ресурс освобождён.", name))
-			s.plugin.notifySubscribers(id,
-				fmt.Sprintf("🔓 **%s** освобождён (время истекло)", name), "")
-			s.plugin.processQueue(id, name)
-			continue
+	// Warn before expiry
+	if left <= notifyBefore && !booking.NotifiedSoon {
+		flipped := false
+		_, err := s.plugin.store.UpdateBooking(id, booking.UserID, func(b *Booking) error {
+			flipped = !b.NotifiedSoon && b.StartedAt.Equal(booking.StartedAt)
+			b.NotifiedSoon = true
+			return nil
+		})
+		if err != nil || !flipped {
+			return
 		}
+		s.plugin.sendDM(booking.UserID,
+			fmt.Sprintf("⚠️ Бронирование **%s** истечёт через %s. `/rq extend %s <время>` чтобы продлить.",
+				name, formatTimeLeft(left), name))
+	}
+}
 
-		// Warn before expiry
-		if left <= notifyBefore && !booking.NotifiedSoon {
-			s.plugin.sendDM(booking.UserID,
-				fmt.Sprintf("⚠️ Бронирование **%s** истечёт через %s. `/rq extend %s <время>` чтобы продлить.",
-					name, formatTimeLeft(left), name))
-			booking.NotifiedSoon = true
-			s.plugin.store.SaveBooking(booking)
+// expireHold passes an unclaimed hold on to the next in line, with the rest
+// of the set for a bundle member.
+func (s *Scheduler) expireHold(id, name string, hold *Booking) {
+	taken, err := s.plugin.store.TakeBooking(id, hold.UserID, func(b *Booking) error {
+		if !b.Hold || !b.IsExpired() {
+			return ErrBusy
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	if taken.BundleID != "" {
+		if bundle, _ := s.plugin.store.GetBundle(taken.BundleID); bundle != nil {
+			names := name
+			if members, err := s.plugin.findBundleIDs(bundle.ResourceIDs); err == nil {
+				names = resourceNames(members)
+			}
+			s.plugin.dropBundleHold(bundle)
+			s.plugin.sendDM(hold.UserID,
+				fmt.Sprintf("⌛ Время на подтверждение комплекта **%s** истекло — ресурсы переданы следующим в очереди.", names))
+			s.plugin.processQueue(id, name)
+			return
 		}
 	}
+	s.plugin.sendDM(hold.UserID,
+		fmt.Sprintf("⌛ Время на подтверждение **%s** истекло — ресурс передан следующему в очереди.", name))
+	s.plugin.processQueue(id, name)
 }
@@ -2,23 +2,76 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin"
 )
 
 const (
-	keyResourceList = "res_list"
+	keyResourceList = "res_list" // the ID list used before the index; removed on rebuild
 	prefixResource  = "res:"
 	prefixBooking   = "bk:"
 	prefixQueue     = "q:"
 	prefixSubs      = "sub:"
 	prefixHistory   = "hist:"
+	prefixReserve   = "rsv:"
+	prefixRecurring = "rec:"
+	prefixBundle    = "bdl:"
+	prefixApproval  = "apr:"
+	keyBundleQueue  = "bundle_queue"
+	keyPriorities   = "priority_classes"
+	keyManagers     = "managers"
+	keyGroups       = "res_groups"
+	keyBoards       = "boards"
 	keyBotUserID    = "bot_uid"
+
+	// casRetries is how many times an atomic update is retried when another
+	// writer changes the key between our read and write.
+	casRetries = 10
 )
 
+var (
+	// ErrConflict is returned when an atomic update lost the race on every retry.
+	ErrConflict = errors.New("concurrent update conflict, try again")
+	// ErrBusy is returned when booking a resource whose seats are all taken.
+	ErrBusy = errors.New("resource busy")
+	// ErrNotBooked is returned when the resource has no active booking.
+	ErrNotBooked = errors.New("not booked")
+	// ErrHolding is returned when the user already holds a seat on the resource.
+	ErrHolding = errors.New("already holding this resource")
+	// ErrNoReservation is returned when a reservation does not exist.
+	ErrNoReservation = errors.New("reservation not found")
+	// ErrNoResource is returned when updating a resource that does not exist.
+	ErrNoResource = errors.New("resource not found")
+	// ErrNoRule is returned when a recurring rule does not exist.
+	ErrNoRule = errors.New("recurring rule not found")
+	// ErrNoApproval is returned when a booking request is no longer pending.
+	ErrNoApproval = errors.New("approval request not found")
+	// ErrRequestPending is returned when the user already waits for approval.
+	ErrRequestPending = errors.New("booking request already pending")
+)
+
+// ConflictError is returned when a reservation overlaps an existing one.
+type ConflictError struct {
+	With Reservation
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conflicts with reservation %s–%s",
+		e.With.StartsAt.Format("02.01 15:04"), e.With.EndsAt.Format("15:04"))
+}
+
 type Store struct {
 	api plugin.API
+	// OnResourceChange and OnGroupsChange, if set, are called after the
+	// indexed state of a resource, or the group list, has changed.
+	OnResourceChange func(id string)
+	OnGroupsChange   func()
 }
 
 func NewStore(api plugin.API) *Store {
@@ -53,18 +106,47 @@ func (s *Store) del(key string) {
 	s.api.KVDelete(key)
 }
 
-// --- Resource list ---
-
-func (s *Store) getResourceIDs() ([]string, error) {
-	var ids []string
-	if err := s.get(keyResourceList, &ids); err != nil {
-		return nil, err
+// update atomically applies fn to the JSON value stored at key. fn receives nil
+// if the key is missing and returns the new value, or nil to delete the key.
+// The write is a compare-and-set against the value that was read, so if another
+// writer got in between, fn is re-run on fresh data (up to casRetries times).
+// Errors returned by fn abort the update and are passed through unchanged.
+func update[T any](s *Store, key string, fn func(cur *T) (*T, error)) error {
+	for i := 0; i < casRetries; i++ {
+		old, appErr := s.api.KVGet(key)
+		if appErr != nil {
+			return fmt.Errorf("kvget %s: %v", key, appErr)
+		}
+		var cur *T
+		if old != nil {
+			cur = new(T)
+			if err := json.Unmarshal(old, cur); err != nil {
+				return err
+			}
+		}
+		next, err := fn(cur)
+		if err != nil {
+			return err
+		}
+		if old == nil && next == nil {
+			return nil // nothing to delete; the atomic set would report a conflict
+		}
+		var data []byte
+		if next != nil {
+			if data, err = json.Marshal(next); err != nil {
+				return err
+			}
+		}
+		ok, appErr := s.api.KVSetWithOptions(key, data, model.PluginKVSetOptions{Atomic: true, OldValue: old})
+		if appErr != nil {
+			return fmt.Errorf("kvset %s: %v", key, appErr)
+		}
+		if ok {
+			return nil
+		}
+		time.Sleep(time.Duration(i+1) * 5 * time.Millisecond)
 	}
-	return ids, nil
-}
-
-func (s *Store) setResourceIDs(ids []string) error {
-	return s.set(keyResourceList, ids)
+	return ErrConflict
 }
 
 // --- Resources ---
@@ -84,17 +166,28 @@ func (s *Store) SaveResource(r *Resource) error {
 	if err := s.set(prefixResource+r.ID, r); err != nil {
 		return err
 	}
-	ids, _ := s.getResourceIDs()
-	for _, id := range ids {
-		if id == r.ID {
-			return nil
+	return s.indexResource(r.ID)
+}
+
+// UpdateResource atomically applies fn to resource id and returns the stored
+// result, so fields fn leaves alone keep any concurrent edit. Returns
+// ErrNoResource if there is no such resource.
+func (s *Store) UpdateResource(id string, fn func(r *Resource) error) (*Resource, error) {
+	var out *Resource
+	err := update(s, prefixResource+id, func(r *Resource) (*Resource, error) {
+		if r == nil || r.ID == "" {
+			return nil, ErrNoResource
 		}
+		if err := fn(r); err != nil {
+			return nil, err
+		}
+		out = r
+		return r, nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	if len(ids) >= maxResources {
-		return fmt.Errorf("max resources limit (%d) reached", maxResources)
-	}
-	ids = append(ids, r.ID)
-	return s.setResourceIDs(ids)
+	return out, s.indexResource(id)
 }
 
 func (s *Store) DeleteResource(id string) error {
@@ -103,67 +196,285 @@ func (s *Store) DeleteResource(id string) error {
 	s.del(prefixQueue + id)
 	s.del(prefixSubs + id)
 	s.del(prefixHistory + id)
-
-	ids, _ := s.getResourceIDs()
-	filtered := make([]string, 0, len(ids))
-	for _, eid := range ids {
-		if eid != id {
-			filtered = append(filtered, eid)
-		}
-	}
-	return s.setResourceIDs(filtered)
+	s.del(prefixReserve + id)
+	s.del(prefixRecurring + id)
+	s.del(prefixApproval + id)
+	return s.indexResource(id)
 }
 
+// GetAllResources returns every resource, ordered by name, from the index.
 func (s *Store) GetAllResources() ([]*Resource, error) {
-	ids, err := s.getResourceIDs()
+	entries, err := s.IndexEntries()
 	if err != nil {
 		return nil, err
 	}
-	out := make([]*Resource, 0, len(ids))
-	for _, id := range ids {
-		r, err := s.GetResource(id)
-		if err == nil && r != nil {
-			out = append(out, r)
-		}
+	out := make([]*Resource, len(entries))
+	for i, e := range entries {
+		out[i] = &e.Resource
 	}
 	return out, nil
 }
 
 // --- Bookings ---
 
-// GetBooking returns the active booking or nil. Does NOT auto-delete expired.
-func (s *Store) GetBooking(resourceID string) (*Booking, error) {
-	var b Booking
-	if err := s.get(prefixBooking+resourceID, &b); err != nil {
+// bookingSet holds every booking of a resource: one per seat holder. Expired
+// bookings stay until the scheduler takes them, so they are still recorded in
+// history; they do not occupy a seat.
+type bookingSet struct {
+	Bookings []Booking `json:"bookings"`
+}
+
+// UnmarshalJSON also accepts the single-Booking format used before resources
+// had seats.
+func (bs *bookingSet) UnmarshalJSON(data []byte) error {
+	var aux struct {
+		Bookings   []Booking `json:"bookings"`
+		ResourceID string    `json:"resource_id"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	bs.Bookings = aux.Bookings
+	if bs.Bookings == nil && aux.ResourceID != "" {
+		var b Booking
+		if err := json.Unmarshal(data, &b); err != nil {
+			return err
+		}
+		bs.Bookings = []Booking{b}
+	}
+	return nil
+}
+
+func (bs *bookingSet) active() []Booking {
+	out := make([]Booking, 0, len(bs.Bookings))
+	for _, b := range bs.Bookings {
+		if !b.IsExpired() {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// GetBookings returns the active bookings ordered by start time.
+func (s *Store) GetBookings(resourceID string) ([]Booking, error) {
+	var bs bookingSet
+	if err := s.get(prefixBooking+resourceID, &bs); err != nil {
 		return nil, err
 	}
-	if b.ResourceID == "" {
-		return nil, nil
+	return bs.active(), nil
+}
+
+// GetBookingsRaw returns bookings even if expired (for scheduler cleanup).
+func (s *Store) GetBookingsRaw(resourceID string) ([]Booking, error) {
+	var bs bookingSet
+	if err := s.get(prefixBooking+resourceID, &bs); err != nil {
+		return nil, err
 	}
-	if b.IsExpired() {
-		return nil, nil
+	if bs.Bookings == nil {
+		return []Booking{}, nil
 	}
-	return &b, nil
+	return bs.Bookings, nil
 }
 
-// GetBookingRaw returns booking even if expired (for scheduler cleanup).
-func (s *Store) GetBookingRaw(resourceID string) (*Booking, error) {
-	var b Booking
-	if err := s.get(prefixBooking+resourceID, &b); err != nil {
+// GetUserBooking returns the active booking of userID or nil.
+func (s *Store) GetUserBooking(resourceID, userID string) (*Booking, error) {
+	bookings, err := s.GetBookings(resourceID)
+	if err != nil {
 		return nil, err
 	}
-	if b.ResourceID == "" {
-		return nil, nil
+	for _, b := range bookings {
+		if b.UserID == userID {
+			return &b, nil
+		}
 	}
-	return &b, nil
+	return nil, nil
 }
 
-func (s *Store) SaveBooking(b *Booking) error {
-	return s.set(prefixBooking+b.ResourceID, b)
+// CreateBooking stores b if a seat is free, otherwise returns ErrBusy (or
+// ErrHolding if the user already has a seat). Of concurrent callers competing
+// for the last seat only one wins.
+func (s *Store) CreateBooking(b *Booking, capacity int) error {
+	err := update(s, prefixBooking+b.ResourceID, func(bs *bookingSet) (*bookingSet, error) {
+		if bs == nil {
+			bs = &bookingSet{}
+		}
+		kept := make([]Booking, 0, len(bs.Bookings)+1)
+		for _, cur := range bs.Bookings {
+			if cur.UserID == b.UserID {
+				if !cur.IsExpired() {
+					return nil, ErrHolding
+				}
+				continue // superseded by the new booking
+			}
+			kept = append(kept, cur)
+		}
+		if len(bs.active()) >= capacity {
+			return nil, ErrBusy
+		}
+		bs.Bookings = append(kept, *b)
+		return bs, nil
+	})
+	if err == nil {
+		s.indexBookings(b.ResourceID)
+	}
+	return err
 }
 
-func (s *Store) DeleteBooking(resourceID string) {
-	s.del(prefixBooking + resourceID)
+// UpdateBooking atomically applies fn to the active booking of userID and
+// returns the stored result. Returns ErrNotBooked if there is none.
+func (s *Store) UpdateBooking(resourceID, userID string, fn func(b *Booking) error) (*Booking, error) {
+	var out *Booking
+	err := update(s, prefixBooking+resourceID, func(bs *bookingSet) (*bookingSet, error) {
+		if bs == nil {
+			return nil, ErrNotBooked
+		}
+		for i := range bs.Bookings {
+			b := &bs.Bookings[i]
+			if b.UserID != userID || b.IsExpired() {
+				continue
+			}
+			if err := fn(b); err != nil {
+				return nil, err
+			}
+			out = b
+			return bs, nil
+		}
+		return nil, ErrNotBooked
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.indexBookings(resourceID)
+	return out, nil
+}
+
+// UpdateBookings atomically applies fn to every active booking of the resource.
+func (s *Store) UpdateBookings(resourceID string, fn func(b *Booking) error) error {
+	err := update(s, prefixBooking+resourceID, func(bs *bookingSet) (*bookingSet, error) {
+		if bs == nil {
+			return nil, ErrNotBooked
+		}
+		for i := range bs.Bookings {
+			if bs.Bookings[i].IsExpired() {
+				continue
+			}
+			if err := fn(&bs.Bookings[i]); err != nil {
+				return nil, err
+			}
+		}
+		return bs, nil
+	})
+	if err == nil {
+		s.indexBookings(resourceID)
+	}
+	return err
+}
+
+// TransferBooking atomically hands the active booking of fromUserID to
+// toUserID: fn edits a copy that replaces it. Returns the booking as it was
+// and as stored. Returns ErrHolding if toUserID already has a seat.
+func (s *Store) TransferBooking(resourceID, fromUserID, toUserID string, fn func(b *Booking) error) (*Booking, *Booking, error) {
+	var old, out *Booking
+	err := update(s, prefixBooking+resourceID, func(bs *bookingSet) (*bookingSet, error) {
+		if bs == nil {
+			return nil, ErrNotBooked
+		}
+		from := -1
+		kept := make([]Booking, 0, len(bs.Bookings))
+		for _, b := range bs.Bookings {
+			switch {
+			case b.UserID == toUserID && !b.IsExpired():
+				return nil, ErrHolding
+			case b.UserID == toUserID:
+				continue // superseded by the transferred booking
+			case b.UserID == fromUserID && !b.IsExpired():
+				from = len(kept)
+			}
+			kept = append(kept, b)
+		}
+		if from < 0 {
+			return nil, ErrNotBooked
+		}
+		prev := kept[from]
+		next := prev
+		if err := fn(&next); err != nil {
+			return nil, err
+		}
+		next.UserID = toUserID
+		kept[from] = next
+		bs.Bookings = kept
+		old, out = &prev, &next
+		return bs, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	s.indexBookings(resourceID)
+	return old, out, nil
+}
+
+// EndBooking atomically flags the expired booking of userID that started at
+// startedAt as Ended and returns it as stored. Expired bookings are never
+// changed after that, so history recorded from the result is final. Returns
+// ErrBusy if the booking was extended or replaced meanwhile.
+func (s *Store) EndBooking(resourceID, userID string, startedAt time.Time) (*Booking, error) {
+	var out *Booking
+	err := update(s, prefixBooking+resourceID, func(bs *bookingSet) (*bookingSet, error) {
+		if bs == nil {
+			return nil, ErrNotBooked
+		}
+		for i := range bs.Bookings {
+			b := &bs.Bookings[i]
+			if b.UserID != userID {
+				continue
+			}
+			if !b.IsExpired() || !b.StartedAt.Equal(startedAt) {
+				return nil, ErrBusy
+			}
+			b.Ended = true
+			out = b
+			return bs, nil
+		}
+		return nil, ErrNotBooked
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.indexBookings(resourceID)
+	return out, nil
+}
+
+// TakeBooking atomically deletes the booking of userID (active or expired) if
+// check accepts it and returns the deleted booking. Only one caller can take a
+// given booking, so whoever gets it back owns the follow-up (history,
+// notifications).
+func (s *Store) TakeBooking(resourceID, userID string, check func(b *Booking) error) (*Booking, error) {
+	var out *Booking
+	err := update(s, prefixBooking+resourceID, func(bs *bookingSet) (*bookingSet, error) {
+		if bs == nil {
+			return nil, ErrNotBooked
+		}
+		for i, b := range bs.Bookings {
+			if b.UserID != userID {
+				continue
+			}
+			if err := check(&b); err != nil {
+				return nil, err
+			}
+			out = &b
+			bs.Bookings = append(bs.Bookings[:i], bs.Bookings[i+1:]...)
+			if len(bs.Bookings) == 0 {
+				return nil, nil
+			}
+			return bs, nil
+		}
+		return nil, ErrNotBooked
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.indexBookings(resourceID)
+	return out, nil
 }
 
 // --- Queue ---
@@ -191,52 +502,530 @@ func (s *Store) GetQueueEntries(resourceID string) ([]QueueEntry, error) {
 	return q.Entries, nil
 }
 
-func (s *Store) AddToQueue(resourceID string, entry QueueEntry) (int, error) {
-	q, err := s.getQueue(resourceID)
+// AddToQueue inserts entry behind everyone with the same or a higher
+// priority, unless the user is already queued or the queue holds limit
+// entries. Returns the 1-based position and the users it was put ahead of,
+// in queue order.
+func (s *Store) AddToQueue(resourceID string, entry QueueEntry, limit int) (int, []string, error) {
+	pos := 0
+	var pushed []string
+	err := update(s, prefixQueue+resourceID, func(q *queueData) (*queueData, error) {
+		if q == nil {
+			q = &queueData{}
+		}
+		for _, e := range q.Entries {
+			if e.UserID == entry.UserID {
+				return nil, fmt.Errorf("already in queue")
+			}
+		}
+		if len(q.Entries) >= limit {
+			return nil, fmt.Errorf("queue is full (max %d)", limit)
+		}
+		i := len(q.Entries)
+		for i > 0 && queueBefore(entry, q.Entries[i-1]) {
+			i--
+		}
+		pushed = pushed[:0]
+		for _, e := range q.Entries[i:] {
+			pushed = append(pushed, e.UserID)
+		}
+		q.Entries = append(q.Entries[:i], append([]QueueEntry{entry}, q.Entries[i:]...)...)
+		pos = i + 1
+		return q, nil
+	})
 	if err != nil {
-		return 0, err
+		return -1, nil, err
 	}
-	for _, e := range q.Entries {
-		if e.UserID == entry.UserID {
-			return -1, fmt.Errorf("already in queue")
+	s.indexQueue(resourceID)
+	return pos, pushed, nil
+}
+
+// queueBefore orders queue entries by priority, then by waiting time.
+func queueBefore(a, b QueueEntry) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	return a.QueuedAt.Before(b.QueuedAt)
+}
+
+func (s *Store) RemoveFromQueue(resourceID, userID string) {
+	update(s, prefixQueue+resourceID, func(q *queueData) (*queueData, error) {
+		if q == nil {
+			return nil, nil
+		}
+		filtered := make([]QueueEntry, 0, len(q.Entries))
+		for _, e := range q.Entries {
+			if e.UserID != userID {
+				filtered = append(filtered, e)
+			}
 		}
+		q.Entries = filtered
+		return q, nil
+	})
+	s.indexQueue(resourceID)
+}
+
+// --- Priority classes ---
+
+func (s *Store) GetPriorityClasses() ([]PriorityClass, error) {
+	var classes []PriorityClass
+	if err := s.get(keyPriorities, &classes); err != nil {
+		return nil, err
 	}
-	if len(q.Entries) >= maxQueueSize {
-		return -1, fmt.Errorf("queue is full (max %d)", maxQueueSize)
+	return classes, nil
+}
+
+// UpdatePriorityClasses replaces the priority classes with fn's result.
+func (s *Store) UpdatePriorityClasses(fn func(classes []PriorityClass) ([]PriorityClass, error)) error {
+	return update(s, keyPriorities, func(cur *[]PriorityClass) (*[]PriorityClass, error) {
+		var classes []PriorityClass
+		if cur != nil {
+			classes = *cur
+		}
+		out, err := fn(classes)
+		if err != nil {
+			return nil, err
+		}
+		return &out, nil
+	})
+}
+
+// --- Status boards ---
+
+func (s *Store) GetBoards() ([]Board, error) {
+	var boards []Board
+	if err := s.get(keyBoards, &boards); err != nil {
+		return nil, err
 	}
-	q.Entries = append(q.Entries, entry)
-	if err := s.set(prefixQueue+resourceID, q); err != nil {
-		return 0, err
+	return boards, nil
+}
+
+// UpdateBoards replaces the status boards with fn's result.
+func (s *Store) UpdateBoards(fn func(boards []Board) ([]Board, error)) error {
+	return update(s, keyBoards, func(cur *[]Board) (*[]Board, error) {
+		var boards []Board
+		if cur != nil {
+			boards = *cur
+		}
+		out, err := fn(boards)
+		if err != nil {
+			return nil, err
+		}
+		if len(out) == 0 {
+			return nil, nil
+		}
+		return &out, nil
+	})
+}
+
+// --- Resource groups ---
+
+func (s *Store) GetGroups() ([]ResourceGroup, error) {
+	var groups []ResourceGroup
+	if err := s.get(keyGroups, &groups); err != nil {
+		return nil, err
 	}
-	return len(q.Entries), nil
+	return groups, nil
 }
 
-func (s *Store) RemoveFromQueue(resourceID, userID string) {
-	q, err := s.getQueue(resourceID)
+// UpdateGroups replaces the resource groups with fn's result.
+func (s *Store) UpdateGroups(fn func(groups []ResourceGroup) ([]ResourceGroup, error)) error {
+	err := update(s, keyGroups, func(cur *[]ResourceGroup) (*[]ResourceGroup, error) {
+		var groups []ResourceGroup
+		if cur != nil {
+			groups = *cur
+		}
+		out, err := fn(groups)
+		if err != nil {
+			return nil, err
+		}
+		return &out, nil
+	})
+	if err == nil && s.OnGroupsChange != nil {
+		s.OnGroupsChange()
+	}
+	return err
+}
+
+// --- Global managers ---
+
+// GetManagers returns the global resource managers, or nil if there are none.
+func (s *Store) GetManagers() (*Managers, error) {
+	var m Managers
+	if err := s.get(keyManagers, &m); err != nil {
+		return nil, err
+	}
+	if len(m.Users) == 0 && len(m.Groups) == 0 {
+		return nil, nil
+	}
+	return &m, nil
+}
+
+// UpdateManagers replaces the global managers with fn's result; nil clears them.
+func (s *Store) UpdateManagers(fn func(cur *Managers) (*Managers, error)) error {
+	return update(s, keyManagers, fn)
+}
+
+// --- Bundles ---
+
+func (s *Store) GetBundle(id string) (*Bundle, error) {
+	var b Bundle
+	if err := s.get(prefixBundle+id, &b); err != nil {
+		return nil, err
+	}
+	if b.ID == "" {
+		return nil, nil
+	}
+	return &b, nil
+}
+
+func (s *Store) SaveBundle(b *Bundle) error {
+	return s.set(prefixBundle+b.ID, b)
+}
+
+func (s *Store) DeleteBundle(id string) {
+	s.del(prefixBundle + id)
+}
+
+type bundleQueueData struct {
+	Entries []BundleQueueEntry `json:"entries"`
+}
+
+// GetBundleQueue returns every bundle queue entry, oldest first.
+func (s *Store) GetBundleQueue() ([]BundleQueueEntry, error) {
+	var q bundleQueueData
+	if err := s.get(keyBundleQueue, &q); err != nil {
+		return nil, err
+	}
+	if q.Entries == nil {
+		return []BundleQueueEntry{}, nil
+	}
+	return q.Entries, nil
+}
+
+// AddToBundleQueue appends entry and returns its position among the entries
+// waiting for the same set.
+func (s *Store) AddToBundleQueue(entry BundleQueueEntry) (int, error) {
+	key := bundleKey(entry.ResourceIDs)
+	pos := 0
+	err := update(s, keyBundleQueue, func(q *bundleQueueData) (*bundleQueueData, error) {
+		if q == nil {
+			q = &bundleQueueData{}
+		}
+		pos = 1
+		for _, e := range q.Entries {
+			if bundleKey(e.ResourceIDs) != key {
+				continue
+			}
+			if e.UserID == entry.UserID {
+				return nil, fmt.Errorf("already in queue")
+			}
+			pos++
+		}
+		if len(q.Entries) >= maxQueueSize {
+			return nil, fmt.Errorf("queue is full (max %d)", maxQueueSize)
+		}
+		q.Entries = append(q.Entries, entry)
+		return q, nil
+	})
 	if err != nil {
-		return
+		return -1, err
 	}
-	filtered := make([]QueueEntry, 0, len(q.Entries))
-	for _, e := range q.Entries {
-		if e.UserID != userID {
+	return pos, nil
+}
+
+// RemoveFromBundleQueue drops userID's entry for the given set and reports
+// whether there was one. Only one concurrent caller gets true.
+func (s *Store) RemoveFromBundleQueue(userID string, resourceIDs []string) (bool, error) {
+	key := bundleKey(resourceIDs)
+	removed := false
+	err := update(s, keyBundleQueue, func(q *bundleQueueData) (*bundleQueueData, error) {
+		removed = false
+		if q == nil {
+			return nil, nil
+		}
+		filtered := make([]BundleQueueEntry, 0, len(q.Entries))
+		for _, e := range q.Entries {
+			if e.UserID == userID && bundleKey(e.ResourceIDs) == key {
+				removed = true
+				continue
+			}
 			filtered = append(filtered, e)
 		}
+		q.Entries = filtered
+		return q, nil
+	})
+	return removed, err
+}
+
+// bundleKey identifies a set of resources regardless of order.
+func bundleKey(resourceIDs []string) string {
+	ids := append([]string(nil), resourceIDs...)
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+// --- Reservations ---
+
+type reservationData struct {
+	Entries []Reservation `json:"entries"`
+}
+
+// GetReservations returns the pending reservations ordered by start time.
+func (s *Store) GetReservations(resourceID string) ([]Reservation, error) {
+	var rd reservationData
+	if err := s.get(prefixReserve+resourceID, &rd); err != nil {
+		return nil, err
 	}
-	q.Entries = filtered
-	s.set(prefixQueue+resourceID, q)
+	if rd.Entries == nil {
+		return []Reservation{}, nil
+	}
+	return rd.Entries, nil
 }
 
-func (s *Store) PopQueue(resourceID string) (*QueueEntry, error) {
-	q, err := s.getQueue(resourceID)
-	if err != nil || len(q.Entries) == 0 {
+// AddReservation stores r unless it overlaps `seats` or more reservations of
+// the same resource, in which case a *ConflictError is returned.
+func (s *Store) AddReservation(r Reservation, seats int) error {
+	err := update(s, prefixReserve+r.ResourceID, func(rd *reservationData) (*reservationData, error) {
+		if rd == nil {
+			rd = &reservationData{}
+		}
+		var overlapping []Reservation
+		for _, e := range rd.Entries {
+			if e.ID == r.ID {
+				return nil, &ConflictError{With: e}
+			}
+			if e.Overlaps(r.StartsAt, r.EndsAt) {
+				overlapping = append(overlapping, e)
+			}
+		}
+		if len(overlapping) >= seats {
+			return nil, &ConflictError{With: overlapping[0]}
+		}
+		if len(rd.Entries) >= maxReservations {
+			return nil, fmt.Errorf("too many reservations (max %d)", maxReservations)
+		}
+		rd.Entries = append(rd.Entries, r)
+		sort.Slice(rd.Entries, func(i, j int) bool {
+			return rd.Entries[i].StartsAt.Before(rd.Entries[j].StartsAt)
+		})
+		return rd, nil
+	})
+	if err == nil {
+		s.indexReservations(r.ResourceID)
+	}
+	return err
+}
+
+// RemoveReservation deletes a reservation if check accepts it and returns it.
+func (s *Store) RemoveReservation(resourceID, id string, check func(r *Reservation) error) (*Reservation, error) {
+	var out *Reservation
+	err := update(s, prefixReserve+resourceID, func(rd *reservationData) (*reservationData, error) {
+		if rd == nil {
+			return nil, ErrNoReservation
+		}
+		for i, e := range rd.Entries {
+			if e.ID != id {
+				continue
+			}
+			if check != nil {
+				if err := check(&e); err != nil {
+					return nil, err
+				}
+			}
+			out = &e
+			rd.Entries = append(rd.Entries[:i], rd.Entries[i+1:]...)
+			return rd, nil
+		}
+		return nil, ErrNoReservation
+	})
+	if err != nil {
 		return nil, err
 	}
-	first := q.Entries[0]
-	q.Entries = q.Entries[1:]
-	if err := s.set(prefixQueue+resourceID, q); err != nil {
+	s.indexReservations(resourceID)
+	return out, nil
+}
+
+// --- Approval requests ---
+
+type approvalData struct {
+	Requests []ApprovalRequest `json:"requests"`
+}
+
+// GetApprovalRequests returns the pending booking requests of a resource.
+func (s *Store) GetApprovalRequests(resourceID string) ([]ApprovalRequest, error) {
+	var ad approvalData
+	if err := s.get(prefixApproval+resourceID, &ad); err != nil {
 		return nil, err
 	}
-	return &first, nil
+	if ad.Requests == nil {
+		return []ApprovalRequest{}, nil
+	}
+	return ad.Requests, nil
+}
+
+// AddApprovalRequest stores a request; a user may have one pending request
+// per resource, otherwise ErrRequestPending is returned.
+func (s *Store) AddApprovalRequest(req ApprovalRequest) error {
+	err := update(s, prefixApproval+req.ResourceID, func(ad *approvalData) (*approvalData, error) {
+		if ad == nil {
+			ad = &approvalData{}
+		}
+		for _, e := range ad.Requests {
+			if e.UserID == req.UserID {
+				return nil, ErrRequestPending
+			}
+		}
+		ad.Requests = append(ad.Requests, req)
+		return ad, nil
+	})
+	if err == nil {
+		s.indexApprovals(req.ResourceID)
+	}
+	return err
+}
+
+// UpdateApprovalRequest applies fn to a pending request and returns the result.
+func (s *Store) UpdateApprovalRequest(resourceID, id string, fn func(req *ApprovalRequest) error) (*ApprovalRequest, error) {
+	var out *ApprovalRequest
+	err := update(s, prefixApproval+resourceID, func(ad *approvalData) (*approvalData, error) {
+		if ad == nil {
+			return nil, ErrNoApproval
+		}
+		for i := range ad.Requests {
+			if ad.Requests[i].ID != id {
+				continue
+			}
+			if err := fn(&ad.Requests[i]); err != nil {
+				return nil, err
+			}
+			cp := ad.Requests[i]
+			out = &cp
+			return ad, nil
+		}
+		return nil, ErrNoApproval
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TakeApprovalRequest removes a pending request if check accepts it and
+// returns it, so exactly one decision wins.
+func (s *Store) TakeApprovalRequest(resourceID, id string, check func(req *ApprovalRequest) error) (*ApprovalRequest, error) {
+	var out *ApprovalRequest
+	err := update(s, prefixApproval+resourceID, func(ad *approvalData) (*approvalData, error) {
+		if ad == nil {
+			return nil, ErrNoApproval
+		}
+		for i, e := range ad.Requests {
+			if e.ID != id {
+				continue
+			}
+			if check != nil {
+				if err := check(&e); err != nil {
+					return nil, err
+				}
+			}
+			out = &e
+			ad.Requests = append(ad.Requests[:i], ad.Requests[i+1:]...)
+			return ad, nil
+		}
+		return nil, ErrNoApproval
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.indexApprovals(resourceID)
+	return out, nil
+}
+
+// --- Recurring rules ---
+
+type recurringData struct {
+	Rules []RecurringRule `json:"rules"`
+}
+
+func (s *Store) GetRecurringRules(resourceID string) ([]RecurringRule, error) {
+	var rd recurringData
+	if err := s.get(prefixRecurring+resourceID, &rd); err != nil {
+		return nil, err
+	}
+	if rd.Rules == nil {
+		return []RecurringRule{}, nil
+	}
+	return rd.Rules, nil
+}
+
+func (s *Store) AddRecurringRule(rule RecurringRule) error {
+	err := update(s, prefixRecurring+rule.ResourceID, func(rd *recurringData) (*recurringData, error) {
+		if rd == nil {
+			rd = &recurringData{}
+		}
+		if len(rd.Rules) >= maxRecurring {
+			return nil, fmt.Errorf("too many recurring rules (max %d)", maxRecurring)
+		}
+		rd.Rules = append(rd.Rules, rule)
+		return rd, nil
+	})
+	if err == nil {
+		s.indexRules(rule.ResourceID)
+	}
+	return err
+}
+
+// UpdateRecurringRule atomically applies fn to a rule and returns the result.
+func (s *Store) UpdateRecurringRule(resourceID, id string, fn func(r *RecurringRule) error) (*RecurringRule, error) {
+	var out *RecurringRule
+	err := update(s, prefixRecurring+resourceID, func(rd *recurringData) (*recurringData, error) {
+		if rd == nil {
+			return nil, ErrNoRule
+		}
+		for i := range rd.Rules {
+			if rd.Rules[i].ID != id {
+				continue
+			}
+			if err := fn(&rd.Rules[i]); err != nil {
+				return nil, err
+			}
+			r := rd.Rules[i]
+			out = &r
+			return rd, nil
+		}
+		return nil, ErrNoRule
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RemoveRecurringRule deletes a rule if check accepts it and returns it.
+func (s *Store) RemoveRecurringRule(resourceID, id string, check func(r *RecurringRule) error) (*RecurringRule, error) {
+	var out *RecurringRule
+	err := update(s, prefixRecurring+resourceID, func(rd *recurringData) (*recurringData, error) {
+		if rd == nil {
+			return nil, ErrNoRule
+		}
+		for i, r := range rd.Rules {
+			if r.ID != id {
+				continue
+			}
+			if err := check(&r); err != nil {
+				return nil, err
+			}
+			out = &r
+			rd.Rules = append(rd.Rules[:i], rd.Rules[i+1:]...)
+			return rd, nil
+		}
+		return nil, ErrNoRule
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.indexRules(resourceID)
+	return out, nil
 }
 
 // --- Subscriptions ---
@@ -275,26 +1064,39 @@ func (s *Store) IsSubscribed(resourceID, userID string) bool {
 }
 
 func (s *Store) Subscribe(resourceID, userID string) error {
-	sd, _ := s.getSubs(resourceID)
-	for _, uid := range sd.UserIDs {
-		if uid == userID {
-			return fmt.Errorf("already subscribed")
+	err := update(s, prefixSubs+resourceID, func(sd *subsData) (*subsData, error) {
+		if sd == nil {
+			sd = &subsData{}
+		}
+		for _, uid := range sd.UserIDs {
+			if uid == userID {
+				return nil, fmt.Errorf("already subscribed")
+			}
 		}
+		sd.UserIDs = append(sd.UserIDs, userID)
+		return sd, nil
+	})
+	if err == nil {
+		s.indexSubs(resourceID)
 	}
-	sd.UserIDs = append(sd.UserIDs, userID)
-	return s.set(prefixSubs+resourceID, sd)
+	return err
 }
 
 func (s *Store) Unsubscribe(resourceID, userID string) {
-	sd, _ := s.getSubs(resourceID)
-	filtered := make([]string, 0, len(sd.UserIDs))
-	for _, uid := range sd.UserIDs {
-		if uid != userID {
-			filtered = append(filtered, uid)
+	update(s, prefixSubs+resourceID, func(sd *subsData) (*subsData, error) {
+		if sd == nil {
+			return nil, nil
 		}
-	}
-	sd.UserIDs = filtered
-	s.set(prefixSubs+resourceID, sd)
+		filtered := make([]string, 0, len(sd.UserIDs))
+		for _, uid := range sd.UserIDs {
+			if uid != userID {
+				filtered = append(filtered, uid)
+			}
+		}
+		sd.UserIDs = filtered
+		return sd, nil
+	})
+	s.indexSubs(resourceID)
 }
 
 // --- History ---
@@ -303,17 +1105,29 @@ type historyData struct {
 	Entries []HistoryEntry `json:"entries"`
 }
 
+// AddHistory appends a finished session. A session is identified by user and
+// start time, so recording the same one twice is a no-op.
 func (s *Store) AddHistory(entry HistoryEntry) error {
-	var h historyData
-	s.get(prefixHistory+entry.ResourceID, &h)
-	if h.Entries == nil {
-		h.Entries = []HistoryEntry{}
-	}
-	h.Entries = append(h.Entries, entry)
-	if len(h.Entries) > maxHistory {
-		h.Entries = h.Entries[len(h.Entries)-maxHistory:]
+	err := update(s, prefixHistory+entry.ResourceID, func(h *historyData) (*historyData, error) {
+		if h == nil {
+			h = &historyData{}
+		}
+		for _, e := range h.Entries {
+			if e.UserID == entry.UserID && e.StartedAt.Equal(entry.StartedAt) {
+				return h, nil
+			}
+		}
+		h.Entries = append(h.Entries, entry)
+		if len(h.Entries) > maxHistory {
+			h.Entries = h.Entries[len(h.Entries)-maxHistory:]
+		}
+		return h, nil
+	})
+	if err != nil {
+		return err
 	}
-	return s.set(prefixHistory+entry.ResourceID, &h)
+	s.recordUsage(entry) // idempotent, so a repeated session is harmless
+	return nil
 }
 
 func (s *Store) GetHistory(resourceID string, limit int) ([]HistoryEntry, error) {
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+type counter struct {
+	N int `json:"n"`
+}
+
+func TestUpdate(t *testing.T) {
+	errStop := errors.New("stop")
+	incr := func(c *counter) (*counter, error) {
+		if c == nil {
+			c = &counter{}
+		}
+		c.N++
+		return c, nil
+	}
+	tests := []struct {
+		name      string
+		initial   string // "" for a missing key
+		fn        func(c *counter) (*counter, error)
+		interfere int // concurrent writes slipped in before our sets
+		want      string
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "creates a missing key", fn: incr, want: `{"n":1}`, wantCalls: 1},
+		{name: "updates an existing key", initial: `{"n":1}`, fn: incr, want: `{"n":2}`, wantCalls: 1},
+		{
+			name: "nil deletes", initial: `{"n":1}`,
+			fn:        func(*counter) (*counter, error) { return nil, nil },
+			wantCalls: 1,
+		},
+		{
+			name:      "nil on a missing key is a no-op",
+			fn:        func(*counter) (*counter, error) { return nil, nil },
+			wantCalls: 1,
+		},
+		{
+			name: "fn error aborts unchanged", initial: `{"n":1}`,
+			fn:   func(*counter) (*counter, error) { return nil, errStop },
+			want: `{"n":1}`, wantErr: errStop, wantCalls: 1,
+		},
+		{
+			name: "retries on fresh data after a conflict", initial: `{"n":1}`, fn: incr,
+			interfere: 1, want: `{"n":12}`, wantCalls: 2,
+		},
+		{
+			name: "gives up after casRetries", initial: `{"n":1}`, fn: incr,
+			interfere: casRetries, want: `{"n":101}`, wantErr: ErrConflict, wantCalls: casRetries,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeAPI()
+			s := NewStore(api)
+			if tt.initial != "" {
+				api.kv["k"] = []byte(tt.initial)
+			}
+			interfere := tt.interfere
+			api.beforeSet = func(key string) {
+				if interfere > 0 {
+					interfere--
+					var c counter
+					s.get(key, &c)
+					c.N += 10
+					s.set(key, &c)
+				}
+			}
+			calls := 0
+			err := update(s, "k", func(c *counter) (*counter, error) {
+				calls++
+				return tt.fn(c)
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got := string(api.kv["k"]); got != tt.want {
+				t.Errorf("stored %q, want %q", got, tt.want)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("fn called %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Tags are free-form labels on resources ("gpu", "os:windows", "lab:2") used
+// to filter listings. They are stored normalized: lower case, dashes for
+// spaces, letters, digits and ":._-" only. Matching is looser than equality:
+// separators are ignored, so "lab2" finds "lab:2", and a bare key finds every
+// value of it ("os" finds "os:windows" and "os:linux").
+
+const (
+	maxTags   = 20
+	maxTagLen = 50
+)
+
+// normalizeTag turns input into a stored tag, or "" if nothing valid is left.
+func normalizeTag(s string) string {
+	s = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s), "#")))
+	s = strings.Join(strings.Fields(s), "-")
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(":._-", r) {
+			return ""
+		}
+	}
+	return s
+}
+
+// sanitizeTags normalizes admin input, rejecting invalid tags so typos do
+// not silently disappear. The result is sorted and free of duplicates; an
+// empty list becomes nil.
+func sanitizeTags(in []string) ([]string, error) {
+	var out []string
+	for _, raw := range in {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		t := normalizeTag(raw)
+		if t == "" || len(t) > maxTagLen {
+			return nil, fmt.Errorf("invalid tag %q", raw)
+		}
+		if !containsString(out, t) {
+			out = append(out, t)
+		}
+	}
+	if len(out) > maxTags {
+		return nil, fmt.Errorf("too many tags (max %d)", maxTags)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// compactTag drops separators so "lab:2", "lab-2" and "lab2" compare equal.
+func compactTag(t string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(":._-", r) {
+			return -1
+		}
+		return r
+	}, t)
+}
+
+// tagMatches reports whether the resource tag t satisfies the wanted tag.
+func tagMatches(t, want string) bool {
+	if compactTag(t) == compactTag(want) {
+		return true
+	}
+	key, _, ok := strings.Cut(t, ":")
+	return ok && !strings.Contains(want, ":") && key == want
+}
+
+// hasTags reports whether res carries every tag in want.
+func hasTags(res *Resource, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, t := range res.Tags {
+			if tagMatches(t, w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// resourceFilter narrows a resource listing: every tag must match, Group keeps
+// the resources of a group and its subgroups, Query those whose name contains
+// it or whose ID starts with it, and Free only resources with a seat available
+// right now.
+type resourceFilter struct {
+	Tags  []string
+	Group string
+	Query string
+	Free  bool
+}
+
+func (f resourceFilter) empty() bool {
+	return len(f.Tags) == 0 && f.Group == "" && f.Query == "" && !f.Free
+}
+
+// parseFilterArgs reads command arguments such as "tag:gpu in:lab-2 free". ok is false
+// if any argument is not a filter, so callers can fall back to a resource name.
+func parseFilterArgs(args []string) (f resourceFilter, ok bool) {
+	for _, arg := range args {
+		lower := strings.ToLower(arg)
+		switch {
+		case lower == "free" || lower == "свободные":
+			f.Free = true
+		case strings.HasPrefix(lower, "tag:") || strings.HasPrefix(arg, "#"):
+			t := normalizeTag(strings.TrimPrefix(lower, "tag:"))
+			if t == "" {
+				return f, false
+			}
+			f.Tags = append(f.Tags, t)
+		case isGroupRef(arg):
+			f.Group = strings.TrimSpace(arg[len(groupPrefix):])
+			if f.Group == "" {
+				return f, false
+			}
+		default:
+			return f, false
+		}
+	}
+	return f, true
+}
+
+// parseFilterQuery reads the tag= (repeated or comma separated), group=, q= and
+// free= query parameters of the list and status endpoints.
+func parseFilterQuery(q url.Values) resourceFilter {
+	var f resourceFilter
+	for _, v := range q["tag"] {
+		for _, part := range strings.Split(v, ",") {
+			if t := normalizeTag(part); t != "" {
+				f.Tags = append(f.Tags, t)
+			}
+		}
+	}
+	f.Group = strings.TrimSpace(q.Get("group"))
+	f.Query = strings.ToLower(strings.TrimSpace(q.Get("q")))
+	switch q.Get("free") {
+	case "", "0", "false":
+	default:
+		f.Free = true
+	}
+	return f
+}
+
+// filterResources keeps the resources matching f.
+func (p *Plugin) filterResources(resources []*Resource, f resourceFilter) []*Resource {
+	if f.empty() {
+		return resources
+	}
+	matches := p.filterMatcher(f)
+	out := resources[:0]
+	for _, r := range resources {
+		if matches(r, p.hasFreeSeat) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// filterMatcher returns a predicate for f. isFree is only called when f.Free
+// is set, after everything else has matched. An unknown group matches nothing.
+func (p *Plugin) filterMatcher(f resourceFilter) func(r *Resource, isFree func(*Resource) bool) bool {
+	var inGroup map[string]bool
+	if f.Group != "" {
+		groups, _ := p.store.GetGroups()
+		if g := findGroup(groups, f.Group); g != nil {
+			inGroup = subtreeIDs(groups, g.ID)
+		} else {
+			inGroup = map[string]bool{}
+		}
+	}
+	return func(r *Resource, isFree func(*Resource) bool) bool {
+		if inGroup != nil && !inGroup[r.GroupID] {
+			return false
+		}
+		if f.Query != "" && !strings.Contains(strings.ToLower(r.Name), f.Query) && !strings.HasPrefix(r.ID, f.Query) {
+			return false
+		}
+		return hasTags(r, f.Tags) && (!f.Free || isFree(r))
+	}
+}
+
+// describeFilter renders f for "nothing found" replies.
+func describeFilter(f resourceFilter) string {
+	var parts []string
+	for _, t := range f.Tags {
+		parts = append(parts, "`tag:"+t+"`")
+	}
+	if f.Group != "" {
+		parts = append(parts, "`"+groupPrefix+f.Group+"`")
+	}
+	if f.Query != "" {
+		parts = append(parts, "`q="+f.Query+"`")
+	}
+	if f.Free {
+		parts = append(parts, "`free`")
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,78 @@
+package main
+
+import "testing"
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"gpu", "gpu"},
+		{"#GPU", "gpu"},
+		{"  # GPU  ", "gpu"},
+		{"os windows", "os-windows"},
+		{"OS:Windows", "os:windows"},
+		{"lab:2", "lab:2"},
+		{"cuda_12.1", "cuda_12.1"},
+		{"Лаборатория 2", "лаборатория-2"},
+		{"gpu!", ""},
+		{"a/b", ""},
+		{"#", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := normalizeTag(tt.in); got != tt.want {
+				t.Errorf("normalizeTag(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagMatches(t *testing.T) {
+	tests := []struct {
+		tag, want string
+		match     bool
+	}{
+		{"gpu", "gpu", true},
+		{"gpu", "cpu", false},
+		{"lab:2", "lab2", true},
+		{"lab:2", "lab-2", true},
+		{"lab-2", "lab:2", true},
+		{"os:windows", "os", true},
+		{"os:windows", "os:windows", true},
+		{"os:windows", "os:linux", false},
+		{"os:windows", "windows", false},
+		{"os", "os:windows", false},
+		{"gpu-a100", "gpu", false},
+		{"lab:2", "lab", true},
+		{"lab:2", "lab:3", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag+"~"+tt.want, func(t *testing.T) {
+			if got := tagMatches(tt.tag, tt.want); got != tt.match {
+				t.Errorf("tagMatches(%q, %q) = %v, want %v", tt.tag, tt.want, got, tt.match)
+			}
+		})
+	}
+}
+
+func TestHasTags(t *testing.T) {
+	res := &Resource{Tags: []string{"gpu", "lab:2", "os:linux"}}
+	tests := []struct {
+		name string
+		want []string
+		has  bool
+	}{
+		{"none wanted", nil, true},
+		{"one", []string{"gpu"}, true},
+		{"all", []string{"gpu", "lab2", "os"}, true},
+		{"one missing", []string{"gpu", "os:windows"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasTags(res, tt.want); got != tt.has {
+				t.Errorf("hasTags(%v) = %v, want %v", tt.want, got, tt.has)
+			}
+		})
+	}
+}
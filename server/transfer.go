@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Transfers hand a running booking to a colleague without releasing it, so
+// nobody from the queue can grab the seat in between. The holder makes an
+// offer (Booking.TransferTo) and the recipient accepts or declines it from a
+// DM. On accept the booking changes owner in one atomic step; the old holder's
+// session goes to history and the new one starts now, keeping the expiry or,
+// under the TransferReset policy, getting the default duration.
+
+var (
+	errNoTransfer     = errors.New("no pending transfer")
+	errBundleTransfer = errors.New("bundle bookings cannot be transferred")
+	errSelfTransfer   = errors.New("cannot transfer to yourself")
+)
+
+// offerTransfer records a transfer of fromUserID's booking of res to
+// toUserID and DMs the recipient. A new offer replaces a pending one.
+func (p *Plugin) offerTransfer(res *Resource, fromUserID, toUserID string) (*Booking, error) {
+	if fromUserID == toUserID {
+		return nil, errSelfTransfer
+	}
+	if !p.canAccess(toUserID, res) {
+		return nil, errNoAccess
+	}
+	if other, _ := p.store.GetUserBooking(res.ID, toUserID); other != nil {
+		return nil, ErrHolding
+	}
+	b, err := p.store.UpdateBooking(res.ID, fromUserID, func(b *Booking) error {
+		switch {
+		case b.Hold:
+			return ErrNotBooked
+		case b.BundleID != "":
+			return errBundleTransfer
+		case b.PreemptedBy != "":
+			return errPreempted
+		}
+		b.TransferTo = toUserID
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := map[string]interface{}{"resource_id": res.ID}
+	until := "до " + b.ExpiresAt.Format("15:04")
+	if res.Policy != nil && res.Policy.TransferReset {
+		until = "на " + formatDuration(p.limitsFor(res).Default)
+	}
+	post := &model.Post{}
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{{
+		Text: fmt.Sprintf("🤝 @%s передаёт вам бронь **%s** (%s)", p.username(fromUserID), res.Name, until),
+		Actions: []*model.PostAction{
+			{
+				Id: "accept", Name: "✅ Принять", Type: "button",
+				Integration: &model.PostActionIntegration{URL: actionURL("transfer_accept"), Context: ctx},
+			},
+			{
+				Id: "decline", Name: "✖ Отклонить", Type: "button",
+				Integration: &model.PostActionIntegration{URL: actionURL("transfer_decline"), Context: ctx},
+			},
+		},
+	}})
+	p.sendDMPost(toUserID, post)
+	return b, nil
+}
+
+// pendingTransfer returns the booking of res offered to userID, or nil.
+func (p *Plugin) pendingTransfer(res *Resource, userID string) *Booking {
+	bookings, _ := p.store.GetBookings(res.ID)
+	for i := range bookings {
+		if bookings[i].TransferTo == userID {
+			return &bookings[i]
+		}
+	}
+	return nil
+}
+
+// acceptTransfer moves the booking of res offered to userID over to them.
+// Returns the new booking and the previous holder.
+func (p *Plugin) acceptTransfer(res *Resource, userID string) (*Booking, string, error) {
+	cur := p.pendingTransfer(res, userID)
+	if cur == nil {
+		return nil, "", errNoTransfer
+	}
+	fromUserID := cur.UserID
+	now := time.Now()
+	expires := cur.ExpiresAt
+	if res.Policy != nil && res.Policy.TransferReset {
+		expires = now.Add(p.limitsFor(res).Default)
+	}
+	if err := p.checkQuota(userID, []*Resource{res}, expires.Sub(now)); err != nil {
+		return nil, "", err
+	}
+	old, b, err := p.store.TransferBooking(res.ID, fromUserID, userID, func(b *Booking) error {
+		if b.TransferTo != userID {
+			return errNoTransfer
+		}
+		*b = Booking{
+			ResourceID: b.ResourceID, Purpose: b.Purpose, ReservationID: b.ReservationID,
+			StartedAt: now, ExpiresAt: expires, TransferredFrom: fromUserID,
+		}
+		return nil
+	})
+	if errors.Is(err, ErrNotBooked) {
+		return nil, "", errNoTransfer
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	entry := old.History(now)
+	entry.TransferredTo = userID
+	p.store.AddHistory(entry)
+	p.store.RemoveFromQueue(res.ID, userID)
+	if res.Pool != "" {
+		p.store.RemoveFromQueue(poolQueueID(res.Pool), userID)
+	}
+	p.sendDM(fromUserID, fmt.Sprintf("🤝 @%s принял бронь **%s**", p.username(userID), res.Name))
+	p.notifySubscribers(res.ID, fmt.Sprintf("🤝 @%s передал **%s** @%s", p.username(fromUserID), res.Name, p.username(userID)), userID)
+	return b, fromUserID, nil
+}
+
+// declineTransfer drops the offer of a booking of res to userID.
+func (p *Plugin) declineTransfer(res *Resource, userID string) error {
+	cur := p.pendingTransfer(res, userID)
+	if cur == nil {
+		return errNoTransfer
+	}
+	fromUserID := cur.UserID
+	_, err := p.store.UpdateBooking(res.ID, fromUserID, func(b *Booking) error {
+		if b.TransferTo != userID {
+			return errNoTransfer
+		}
+		b.TransferTo = ""
+		return nil
+	})
+	if errors.Is(err, ErrNotBooked) {
+		return errNoTransfer
+	}
+	if err != nil {
+		return err
+	}
+	p.sendDM(fromUserID, fmt.Sprintf("✖ @%s отклонил передачу **%s** — бронь остаётся за вами", p.username(userID), res.Name))
+	return nil
+}
+
+// transferErrText renders transfer failures for chat responses, or "".
+func transferErrText(res *Resource, err error) string {
+	switch {
+	case errors.Is(err, errNoTransfer):
+		return fmt.Sprintf("Предложение передать **%s** больше не действует", res.Name)
+	case errors.Is(err, errBundleTransfer):
+		return fmt.Sprintf("**%s** забронирован в составе комплекта — его нельзя передать отдельно", res.Name)
+	case errors.Is(err, errSelfTransfer):
+		return "Нельзя передать бронь самому себе"
+	}
+	return ""
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Usage records for quotas. Checking a quota used to read the bookings and
+// history of every resource. Instead, every finished session is also filed
+// under its user and under each team the user is in when it ends, and
+// records keep only what the day and week windows can still see. Live
+// bookings come from the index. Filing is idempotent, a session being
+// identified by user, resource and start like in AddHistory, so retries, a
+// rebuild racing a new session, and two nodes rebuilding at once cannot count
+// anything twice.
+
+const (
+	prefixUsage     = "use:"
+	keyUsageVersion = "use_version"
+	usageVersion    = 1
+	// usageRetention covers the longest quota window, a week, with room for
+	// a session that started before it.
+	usageRetention = 8 * 24 * time.Hour
+)
+
+type usageSpan struct {
+	UserID     string    `json:"u"`
+	ResourceID string    `json:"r"`
+	Start      time.Time `json:"s"`
+	End        time.Time `json:"e"`
+}
+
+type usageRecord struct {
+	Spans []usageSpan `json:"spans"`
+}
+
+func userUsageKey(userID string) string { return prefixUsage + "u:" + userID }
+func teamUsageKey(teamID string) string { return prefixUsage + "t:" + teamID }
+
+// GetUsage returns the sessions filed under key that ended within
+// usageRetention.
+func (s *Store) GetUsage(key string) ([]usageSpan, error) {
+	var rec usageRecord
+	if err := s.get(key, &rec); err != nil {
+		return nil, err
+	}
+	return rec.Spans, nil
+}
+
+// recordUsage files a finished session under its user and the user's teams.
+func (s *Store) recordUsage(e HistoryEntry) {
+	if time.Since(e.EndedAt) > usageRetention {
+		return
+	}
+	span := usageSpan{UserID: e.UserID, ResourceID: e.ResourceID, Start: e.StartedAt, End: e.EndedAt}
+	keys := []string{userUsageKey(e.UserID)}
+	if teams, appErr := s.api.GetTeamsForUser(e.UserID); appErr == nil {
+		for _, t := range teams {
+			keys = append(keys, teamUsageKey(t.Id))
+		}
+	}
+	for _, key := range keys {
+		if err := s.addUsageSpan(key, span); err != nil {
+			s.api.LogWarn("recordUsage", "key", key, "err", err.Error())
+		}
+	}
+}
+
+func (s *Store) addUsageSpan(key string, span usageSpan) error {
+	return update(s, key, func(rec *usageRecord) (*usageRecord, error) {
+		cutoff := time.Now().Add(-usageRetention)
+		out := &usageRecord{}
+		if rec != nil {
+			for _, sp := range rec.Spans {
+				if sp.UserID == span.UserID && sp.ResourceID == span.ResourceID && sp.Start.Equal(span.Start) {
+					return rec, nil
+				}
+				if sp.End.After(cutoff) {
+					out.Spans = append(out.Spans, sp)
+				}
+			}
+		}
+		out.Spans = append(out.Spans, span)
+		return out, nil
+	})
+}
+
+// EnsureUsage files the recent history into usage records once, when the
+// plugin is upgraded from a version without them.
+func (s *Store) EnsureUsage() error {
+	var version int
+	if err := s.get(keyUsageVersion, &version); err != nil {
+		return err
+	}
+	if version == usageVersion {
+		return nil
+	}
+	// Collect first: filing adds keys, which would shift the KVList pages.
+	var ids []string
+	for page := 0; ; page++ {
+		keys, appErr := s.api.KVList(page, kvListPage)
+		if appErr != nil {
+			return fmt.Errorf("kvlist: %v", appErr)
+		}
+		for _, key := range keys {
+			if id, ok := strings.CutPrefix(key, prefixHistory); ok {
+				ids = append(ids, id)
+			}
+		}
+		if len(keys) < kvListPage {
+			break
+		}
+	}
+	for _, id := range ids {
+		history, err := s.GetHistory(id, 0)
+		if err != nil {
+			return err
+		}
+		for _, h := range history {
+			s.recordUsage(h)
+		}
+	}
+	return update(s, keyUsageVersion, func(cur *int) (*int, error) {
+		v := usageVersion
+		return &v, nil
+	})
+}
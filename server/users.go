@@ -0,0 +1,134 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+// User cache. Rendering a status or a history page names every holder, queue
+// entry and history row, and each name used to be a GetUser RPC. Users are
+// cached for userCacheTTL; the user hooks below refresh entries early, but
+// Mattermost has no hook for profile or role edits, so the TTL bounds how long
+// a renamed user can be seen as before. Keep it short. Authorization reads
+// roles through authUser, which skips the cache, so a demoted admin loses
+// their rights at once.
+
+const (
+	userCacheTTL  = time.Minute
+	userCacheSize = 10000
+)
+
+type cachedUser struct {
+	user    *model.User
+	fetched time.Time
+}
+
+type userCache struct {
+	mu       sync.Mutex
+	entries  map[string]cachedUser
+	format   string
+	formatAt time.Time
+}
+
+func newUserCache() *userCache {
+	return &userCache{entries: map[string]cachedUser{}}
+}
+
+func (c *userCache) get(id string) *model.User {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[id]
+	if !ok || time.Since(e.fetched) > userCacheTTL {
+		return nil
+	}
+	return e.user
+}
+
+func (c *userCache) put(u *model.User) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= userCacheSize {
+		// Dropping everything is cheaper than tracking age, and the cache
+		// refills from the next few renders.
+		c.entries = map[string]cachedUser{}
+	}
+	c.entries[u.Id] = cachedUser{user: u, fetched: time.Now()}
+}
+
+// getUser is GetUser through the cache.
+func (p *Plugin) getUser(userID string) (*model.User, error) {
+	if u := p.users.get(userID); u != nil {
+		return u, nil
+	}
+	u, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		return nil, appErr
+	}
+	p.users.put(u)
+	return u, nil
+}
+
+// authUser is GetUser for authorization checks: it always asks the server and
+// refreshes the cache with the answer.
+func (p *Plugin) authUser(userID string) (*model.User, error) {
+	u, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		return nil, appErr
+	}
+	p.users.put(u)
+	return u, nil
+}
+
+// nameFormat returns the server's teammate name display setting, re-read at
+// most once per userCacheTTL.
+func (p *Plugin) nameFormat() string {
+	c := p.users
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.format == "" || time.Since(c.formatAt) > userCacheTTL {
+		c.format = model.ShowUsername
+		if cfg := p.API.GetConfig(); cfg != nil && cfg.TeamSettings.TeammateNameDisplay != nil && *cfg.TeamSettings.TeammateNameDisplay != "" {
+			c.format = *cfg.TeamSettings.TeammateNameDisplay
+		}
+		c.formatAt = time.Now()
+	}
+	return c.format
+}
+
+// displayName names a user the way the rest of the server does: full name or
+// nickname if the teammate name display setting asks for it, else @username,
+// which stays a mention.
+func (p *Plugin) displayName(userID string) string {
+	u, err := p.getUser(userID)
+	if err != nil {
+		return "unknown"
+	}
+	return u.GetDisplayNameWithPrefix(p.nameFormat(), "@")
+}
+
+// plainName is displayName without the @ for the webapp, which lays names out
+// itself.
+func (p *Plugin) plainName(userID string) string {
+	u, err := p.getUser(userID)
+	if err != nil {
+		return "unknown"
+	}
+	return u.GetDisplayName(p.nameFormat())
+}
+
+// --- user hooks ---
+
+func (p *Plugin) UserHasBeenCreated(c *plugin.Context, user *model.User) {
+	p.users.put(user)
+}
+
+func (p *Plugin) UserHasLoggedIn(c *plugin.Context, user *model.User) {
+	p.users.put(user)
+}
+
+func (p *Plugin) UserHasBeenDeactivated(c *plugin.Context, user *model.User) {
+	p.users.put(user)
+}
@@ -28,16 +28,32 @@ async function doFetch(url: string, options: RequestInit = {}): Promise<any> {
     return resp.json();
 }
 
-export async function getAllStatus() {
-    return doFetch(apiUrl('/status'));
+export async function getAllStatus(filter?: {tags?: string[]; group?: string; query?: string; free?: boolean}, page = 0, perPage = 0) {
+    const params = new URLSearchParams();
+    (filter?.tags || []).forEach(t => params.append('tag', t));
+    if (filter?.group) {
+        params.set('group', filter.group);
+    }
+    if (filter?.query) {
+        params.set('q', filter.query);
+    }
+    if (filter?.free) {
+        params.set('free', '1');
+    }
+    if (perPage > 0) {
+        params.set('page', String(page));
+        params.set('per_page', String(perPage));
+    }
+    const q = params.toString();
+    return doFetch(apiUrl(q ? `/status?${q}` : '/status'));
 }
 
 export async function getResourceStatus(id: string) {
     return doFetch(apiUrl(`/status/${id}`));
 }
 
-export async function getResources() {
-    return doFetch(apiUrl('/resources'));
+export async function getResources(managed = false) {
+    return doFetch(apiUrl(managed ? '/resources?managed=1' : '/resources'));
 }
 
 export async function createResource(data: any) {
@@ -70,13 +86,33 @@ export async function extendResource(id: string, minutes: number) {
     });
 }
 
-export async function joinQueue(id: string, minutes: number, purpose: string = '') {
+export async function joinQueue(id: string, minutes: number, purpose: string = '', priority: string = '') {
     return doFetch(apiUrl(`/resources/${id}/queue`), {
         method: 'POST',
-        body: JSON.stringify({minutes, purpose}),
+        body: JSON.stringify({minutes, purpose, priority}),
     });
 }
 
+export async function acceptTransfer(id: string) {
+    return doFetch(apiUrl(`/resources/${id}/transfer/accept`), {method: 'POST'});
+}
+
+export async function declineTransfer(id: string) {
+    return doFetch(apiUrl(`/resources/${id}/transfer/decline`), {method: 'POST'});
+}
+
+export async function getPriorities() {
+    return doFetch(apiUrl('/priorities'));
+}
+
+export async function startMaintenance(id: string, reason: string) {
+    return doFetch(apiUrl(`/resources/${id}/maintenance`), {method: 'POST', body: JSON.stringify({reason})});
+}
+
+export async function endMaintenance(id: string) {
+    return doFetch(apiUrl(`/resources/${id}/maintenance`), {method: 'DELETE'});
+}
+
 export async function leaveQueue(id: string) {
     return doFetch(apiUrl(`/resources/${id}/queue`), {method: 'DELETE'});
 }
@@ -89,10 +125,35 @@ export async function unsubscribeResource(id: string) {
     return doFetch(apiUrl(`/resources/${id}/unsubscribe`), {method: 'POST'});
 }
 
+export async function getGroups() {
+    return doFetch(apiUrl('/groups'));
+}
+
+export async function createGroup(data: any) {
+    return doFetch(apiUrl('/groups'), {method: 'POST', body: JSON.stringify(data)});
+}
+
+export async function updateGroup(id: string, data: any) {
+    return doFetch(apiUrl(`/groups/${id}`), {method: 'PUT', body: JSON.stringify(data)});
+}
+
+export async function deleteGroup(id: string) {
+    return doFetch(apiUrl(`/groups/${id}`), {method: 'DELETE'});
+}
+
+export async function subscribeGroup(id: string) {
+    return doFetch(apiUrl(`/groups/${id}/subscribe`), {method: 'POST'});
+}
+
+export async function unsubscribeGroup(id: string) {
+    return doFetch(apiUrl(`/groups/${id}/unsubscribe`), {method: 'POST'});
+}
+
 export async function getHistory(id: string) {
     return doFetch(apiUrl(`/resources/${id}/history`));
 }
 
-export async function getPresets() {
-    return doFetch(apiUrl('/presets'));
+export async function getPresets(resourceId?: string) {
+    const q = resourceId ? `?resource_id=${encodeURIComponent(resourceId)}` : '';
+    return doFetch(apiUrl(`/presets${q}`));
 }
@@ -0,0 +1,47 @@
+// Plugin WebSocket events, passed from the handlers registered in index.tsx
+// to whichever sidebar is open. 'reconnect' is sent when the WebSocket comes
+// back, since events may have been missed meanwhile.
+
+export interface PluginEvent {
+    type: 'status_changed' | 'resource_deleted' | 'groups_changed' | 'reconnect';
+    data: any;
+}
+
+type Listener = (ev: PluginEvent) => void;
+
+const listeners = new Set<Listener>();
+
+export function subscribe(fn: Listener): () => void {
+    listeners.add(fn);
+    return () => {
+        listeners.delete(fn);
+    };
+}
+
+export function emit(ev: PluginEvent) {
+    listeners.forEach(fn => fn(ev));
+}
+
+// personalize fills in the current user's flags on a status from a
+// status_changed event, which is built for nobody in particular. Flags the
+// event cannot tell are kept from prev.
+export function personalize(st: any, subscriberIds: string[], userId: string, prev: any): any {
+    const bookings = st.bookings || [];
+    const own = bookings.find((b: any) => b.user_id === userId && !b.hold);
+    return {
+        ...st,
+        booking: own || bookings[0],
+        is_holder: !!own,
+        held_for_you: bookings.some((b: any) => b.user_id === userId && b.hold),
+        transfer_for_you: bookings.some((b: any) => b.transfer_to === userId),
+        in_queue: (st.queue || []).some((e: any) => e.user_id === userId),
+        is_subscribed: subscriberIds.includes(userId),
+        approval_pending: !!prev?.approval_pending,
+        can_manage: !!prev?.can_manage,
+    };
+}
+
+// isFree mirrors the server's notion of a free resource in group counts.
+export function isFree(st: any): boolean {
+    return !st.in_maintenance && (st.bookings || []).length < (st.capacity || 1);
+}
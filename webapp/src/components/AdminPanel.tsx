@@ -3,20 +3,28 @@ import * as api from '../actions/api';
 
 interface Props {
     theme: any;
+    canCreate: boolean;
     onBack: () => void;
 }
 
-const AdminPanel: React.FC<Props> = ({theme, onBack}) => {
+const EMPTY_POLICY = {maxMinutes: '', maxExtendMinutes: '', warnBeforeMinutes: '', defaultMinutes: '', presets: '', queueLimit: '', transferReset: false};
+
+const num = (v: any) => (v ? String(v) : '');
+
+const AdminPanel: React.FC<Props> = ({theme, canCreate, onBack}) => {
     const [resources, setResources] = useState<any[]>([]);
     const [editing, setEditing] = useState<any | null>(null);
-    const [form, setForm] = useState({name: '', ip: '', icon: '', description: '', variables: ''});
+    const [form, setForm] = useState({name: '', ip: '', icon: '', description: '', pool: '', tags: '', groupId: '', capacity: '', handoff: '', variables: '', ...EMPTY_POLICY});
+    const [groups, setGroups] = useState<any[]>([]);
+    const [groupForm, setGroupForm] = useState({name: '', icon: '', parentId: ''});
     const [error, setError] = useState('');
     const [saving, setSaving] = useState(false);
 
     const load = async () => {
         try {
-            const data = await api.getResources();
+            const [data, groupData] = await Promise.all([api.getResources(true), api.getGroups()]);
             setResources(data || []);
+            setGroups(groupData || []);
         } catch (e: any) {
             setError(e.message);
         }
@@ -25,7 +33,7 @@ const AdminPanel: React.FC<Props> = ({theme, onBack}) => {
     useEffect(() => { load(); }, []);
 
     const resetForm = () => {
-        setForm({name: '', ip: '', icon: '', description: '', variables: ''});
+        setForm({name: '', ip: '', icon: '', description: '', pool: '', tags: '', groupId: '', capacity: '', handoff: '', variables: '', ...EMPTY_POLICY});
         setEditing(null);
     };
 
@@ -36,6 +44,18 @@ const AdminPanel: React.FC<Props> = ({theme, onBack}) => {
             ip: r.ip || '',
             icon: r.icon || '',
             description: r.description || '',
+            pool: r.pool || '',
+            tags: r.tags ? r.tags.join(', ') : '',
+            groupId: r.group_id || '',
+            capacity: r.capacity ? String(r.capacity) : '',
+            handoff: r.handoff || '',
+            maxMinutes: num(r.policy?.max_minutes),
+            maxExtendMinutes: num(r.policy?.max_extend_minutes),
+            warnBeforeMinutes: num(r.policy?.warn_before_minutes),
+            defaultMinutes: num(r.policy?.default_minutes),
+            presets: r.policy?.presets ? r.policy.presets.join(', ') : '',
+            queueLimit: num(r.policy?.queue_limit),
+            transferReset: !!r.policy?.transfer_reset,
             variables: r.variables ? Object.entries(r.variables).map(([k, v]) => `${k}=${v}`).join('\n') : '',
         });
     };
@@ -64,6 +84,21 @@ const AdminPanel: React.FC<Props> = ({theme, onBack}) => {
                 ip: form.ip.trim(),
                 icon: form.icon.trim(),
                 description: form.description.trim(),
+                pool: form.pool.trim(),
+                tags: form.tags.split(',').map(t => t.trim()).filter(Boolean),
+                group_id: form.groupId,
+                capacity: parseInt(form.capacity, 10) || 1,
+                handoff: form.handoff,
+                // Empty fields fall back to the plugin settings.
+                policy: {
+                    max_minutes: parseInt(form.maxMinutes, 10) || 0,
+                    max_extend_minutes: parseInt(form.maxExtendMinutes, 10) || 0,
+                    warn_before_minutes: parseInt(form.warnBeforeMinutes, 10) || 0,
+                    default_minutes: parseInt(form.defaultMinutes, 10) || 0,
+                    presets: form.presets.split(',').map(v => parseInt(v.trim(), 10)).filter(v => v > 0),
+                    queue_limit: parseInt(form.queueLimit, 10) || 0,
+                    transfer_reset: form.transferReset,
+                },
                 variables: parseVariables(form.variables),
             };
             if (editing) {
@@ -90,13 +125,47 @@ const AdminPanel: React.FC<Props> = ({theme, onBack}) => {
         }
     };
 
+    const addGroup = async () => {
+        if (!groupForm.name.trim()) {
+            setError('Имя группы обязательно');
+            return;
+        }
+        try {
+            await api.createGroup({name: groupForm.name.trim(), icon: groupForm.icon.trim(), parent_id: groupForm.parentId});
+            setGroupForm({name: '', icon: '', parentId: ''});
+            await load();
+        } catch (e: any) {
+            setError(e.message);
+        }
+    };
+
+    const removeGroup = async (id: string) => {
+        if (!confirm('Удалить группу? Её ресурсы и подгруппы перейдут на уровень выше.')) return;
+        try {
+            await api.deleteGroup(id);
+            await load();
+        } catch (e: any) {
+            setError(e.message);
+        }
+    };
+
+    // "Lab 2 › Rack 1" for the selectors and the list.
+    const groupPath = (id: string): string => {
+        const g = groups.find((x: any) => x.id === id);
+        if (!g) {
+            return '';
+        }
+        return g.parent_id ? `${groupPath(g.parent_id)} › ${g.name}` : g.name;
+    };
+    const groupOptions = groups.map((g: any) => ({id: g.id, path: groupPath(g.id)})).sort((a, b) => a.path.localeCompare(b.path));
+
     const styles = getStyles(theme);
 
     return (
         <div>
             {error && <div style={styles.error}>{error}</div>}
 
-            <div style={styles.form}>
+            {(editing || canCreate) && <div style={styles.form}>
                 <div style={styles.formTitle}>{editing ? 'Редактировать' : 'Добавить ресурс'}</div>
                 <input style={styles.input} placeholder="Имя *" value={form.name}
                     onChange={e => setForm({...form, name: e.target.value})} />
@@ -106,6 +175,39 @@ const AdminPanel: React.FC<Props> = ({theme, onBack}) => {
                     onChange={e => setForm({...form, icon: e.target.value})} />
                 <input style={styles.input} placeholder="Описание" value={form.description}
                     onChange={e => setForm({...form, description: e.target.value})} />
+                <input style={styles.input} placeholder="Пул (взаимозаменяемые ресурсы)" value={form.pool}
+                    onChange={e => setForm({...form, pool: e.target.value})} />
+                <input style={styles.input} placeholder="Теги через запятую (gpu, os:windows, lab:2)" value={form.tags}
+                    onChange={e => setForm({...form, tags: e.target.value})} />
+                <select style={styles.input} value={form.groupId}
+                    onChange={e => setForm({...form, groupId: e.target.value})}>
+                    <option value="">Группа: без группы</option>
+                    {groupOptions.map(g => <option key={g.id} value={g.id}>📁 {g.path}</option>)}
+                </select>
+                <input style={styles.input} type="number" min={1} placeholder="Мест (одновременных держателей, по умолчанию 1)" value={form.capacity}
+                    onChange={e => setForm({...form, capacity: e.target.value})} />
+                <select style={styles.input} value={form.handoff}
+                    onChange={e => setForm({...form, handoff: e.target.value})}>
+                    <option value="">Очередь: подтверждение первым в очереди</option>
+                    <option value="auto">Очередь: автоматическая передача</option>
+                </select>
+                <input style={styles.input} type="number" min={0} placeholder="Макс. бронь, мин (по умолчанию из настроек)" value={form.maxMinutes}
+                    onChange={e => setForm({...form, maxMinutes: e.target.value})} />
+                <input style={styles.input} type="number" min={0} placeholder="Макс. суммарное продление, мин" value={form.maxExtendMinutes}
+                    onChange={e => setForm({...form, maxExtendMinutes: e.target.value})} />
+                <input style={styles.input} type="number" min={0} placeholder="Напоминать за, мин" value={form.warnBeforeMinutes}
+                    onChange={e => setForm({...form, warnBeforeMinutes: e.target.value})} />
+                <input style={styles.input} type="number" min={0} placeholder="Бронь по умолчанию, мин" value={form.defaultMinutes}
+                    onChange={e => setForm({...form, defaultMinutes: e.target.value})} />
+                <input style={styles.input} placeholder="Разрешённые длительности, мин (через запятую)" value={form.presets}
+                    onChange={e => setForm({...form, presets: e.target.value})} />
+                <input style={styles.input} type="number" min={0} placeholder="Макс. длина очереди" value={form.queueLimit}
+                    onChange={e => setForm({...form, queueLimit: e.target.value})} />
+                <label style={{fontSize: '12px'}}>
+                    <input type="checkbox" checked={form.transferReset}
+                        onChange={e => setForm({...form, transferReset: e.target.checked})} />
+                    {' '}При передаче брони срок начинается заново
+                </label>
                 <textarea style={{...styles.input, minHeight: '50px'}} placeholder="Переменные (key=value, по одной на строку)"
                     value={form.variables} onChange={e => setForm({...form, variables: e.target.value})} />
                 <div style={styles.formActions}>
@@ -114,13 +216,37 @@ const AdminPanel: React.FC<Props> = ({theme, onBack}) => {
                     </button>
                     {editing && <button style={styles.btnSecondary} onClick={resetForm}>Отмена</button>}
                 </div>
-            </div>
+            </div>}
+
+            {canCreate && <div style={styles.form}>
+                <div style={styles.formTitle}>Группы ресурсов</div>
+                {groupOptions.map(g => (
+                    <div key={g.id} style={styles.listItem}>
+                        <div style={styles.listName}>{groups.find((x: any) => x.id === g.id)?.icon || '📁'} {g.path}</div>
+                        <div style={styles.listActions}>
+                            <button style={styles.btnSmall} onClick={() => removeGroup(g.id)}>🗑️</button>
+                        </div>
+                    </div>
+                ))}
+                <input style={styles.input} placeholder="Новая группа" value={groupForm.name}
+                    onChange={e => setGroupForm({...groupForm, name: e.target.value})} />
+                <input style={styles.input} placeholder="Иконка (emoji)" value={groupForm.icon}
+                    onChange={e => setGroupForm({...groupForm, icon: e.target.value})} />
+                <select style={styles.input} value={groupForm.parentId}
+                    onChange={e => setGroupForm({...groupForm, parentId: e.target.value})}>
+                    <option value="">Верхний уровень</option>
+                    {groupOptions.map(g => <option key={g.id} value={g.id}>внутри 📁 {g.path}</option>)}
+                </select>
+                <div style={styles.formActions}>
+                    <button style={styles.btnPrimary} onClick={addGroup}>Добавить группу</button>
+                </div>
+            </div>}
 
             <div style={styles.list}>
                 {resources.map((r: any) => (
                     <div key={r.id} style={styles.listItem}>
                         <div style={styles.listName}>{r.icon || '🖥️'} {r.name}</div>
-                        <div style={styles.listMeta}>{r.ip}</div>
+                        <div style={styles.listMeta}>{r.group_id ? `📁${groupPath(r.group_id)} ` : ''}{r.pool ? `🧩${r.pool} ` : ''}{r.tags?.length ? `🏷${r.tags.join(',')} ` : ''}{r.capacity > 1 ? `👥${r.capacity} ` : ''}{r.handoff === 'auto' ? '🔁 ' : ''}{r.ip}</div>
                         <div style={styles.listActions}>
                             <button style={styles.btnSmall} onClick={() => startEdit(r)}>✏️</button>
                             <button style={styles.btnSmall} onClick={() => remove(r.id)}>🗑️</button>
@@ -21,10 +21,15 @@ const BookingModal: React.FC<Props> = ({resourceId, mode, theme, onClose, onDone
     const [purpose, setPurpose] = useState('');
     const [error, setError] = useState('');
     const [submitting, setSubmitting] = useState(false);
+    const [priority, setPriority] = useState('normal');
+    const [maxPriority, setMaxPriority] = useState('normal');
 
     useEffect(() => {
-        api.getPresets().then(setPresets).catch(() => {});
-    }, []);
+        api.getPresets(resourceId).then(setPresets).catch(() => {});
+        if (mode === 'queue') {
+            api.getPriorities().then((d: any) => setMaxPriority(d.max_priority)).catch(() => {});
+        }
+    }, [resourceId, mode]);
 
     const submit = async (minutes: number) => {
         if (minutes <= 0) { setError('Укажите время'); return; }
@@ -34,7 +39,7 @@ const BookingModal: React.FC<Props> = ({resourceId, mode, theme, onClose, onDone
             if (mode === 'book') {
                 await api.bookResource(resourceId, minutes, purpose);
             } else if (mode === 'queue') {
-                await api.joinQueue(resourceId, minutes, purpose);
+                await api.joinQueue(resourceId, minutes, purpose, priority);
             } else if (mode === 'extend') {
                 await api.extendResource(resourceId, minutes);
             }
@@ -93,6 +98,17 @@ const BookingModal: React.FC<Props> = ({resourceId, mode, theme, onClose, onDone
                     </div>
                 )}
 
+                {mode === 'queue' && maxPriority !== 'normal' && (
+                    <div style={styles.section}>
+                        <label style={styles.label}>Приоритет:</label>
+                        <select style={styles.input} value={priority} onChange={(e) => setPriority(e.target.value)}>
+                            <option value="normal">Обычный</option>
+                            <option value="high">⚡ Высокий</option>
+                            {maxPriority === 'urgent' && <option value="urgent">🔥 Срочный</option>}
+                        </select>
+                    </div>
+                )}
+
                 <button style={styles.cancelBtn} onClick={onClose}>Отмена</button>
             </div>
         </div>
@@ -30,7 +30,8 @@ const HistoryPanel: React.FC<Props> = ({resourceId, theme}) => {
     const userStats: Record<string, number> = {};
     entries.forEach((e: any) => {
         const dur = (new Date(e.ended_at).getTime() - new Date(e.started_at).getTime()) / 60000;
-        userStats[e.username || e.user_id] = (userStats[e.username || e.user_id] || 0) + dur;
+        const who = userName(e);
+        userStats[who] = (userStats[who] || 0) + dur;
     });
 
     const topUsers = Object.entries(userStats)
@@ -57,9 +58,9 @@ const HistoryPanel: React.FC<Props> = ({resourceId, theme}) => {
             {topUsers.length > 0 && (
                 <div style={styles.section}>
                     <div style={styles.sectionTitle}>Топ пользователей</div>
-                    {topUsers.map(([uid, mins]) => (
-                        <div key={uid} style={styles.topUserRow}>
-                            <span>@{uid.substring(0, 8)}</span>
+                    {topUsers.map(([who, mins]) => (
+                        <div key={who} style={styles.topUserRow}>
+                            <span>{who}</span>
                             <span>{formatMinutes(mins as number)}</span>
                         </div>
                     ))}
@@ -72,12 +73,15 @@ const HistoryPanel: React.FC<Props> = ({resourceId, theme}) => {
                     const dur = (new Date(e.ended_at).getTime() - new Date(e.started_at).getTime()) / 60000;
                     return (
                         <div key={i} style={styles.historyRow}>
-                            <div style={styles.historyUser}>@{e.username || e.user_id}</div>
+                            <div style={styles.historyUser}>{e.handoff ? '🔁 ' : ''}{userName(e)}</div>
                             <div style={styles.historyTime}>
                                 {new Date(e.started_at).toLocaleDateString()} {new Date(e.started_at).toLocaleTimeString([], {hour: '2-digit', minute: '2-digit'})}
                             </div>
                             <div style={styles.historyDur}>{formatMinutes(dur)}</div>
                             {e.purpose && <div style={styles.historyPurpose}>{e.purpose}</div>}
+                            {e.transferred_to && <div style={styles.historyPurpose}>🤝 передано другому</div>}
+                            {e.preempted_by && <div style={styles.historyPurpose}>⛔ вытеснен: {e.preempt_reason}</div>}
+                            {e.booked_by && <div style={styles.historyPurpose}>📌 оформлено за пользователя</div>}
                         </div>
                     );
                 })}
@@ -86,6 +90,15 @@ const HistoryPanel: React.FC<Props> = ({resourceId, theme}) => {
     );
 };
 
+// userName shows the server's display name for a user, or @username when the
+// server shows usernames.
+function userName(e: any): string {
+    if (e.display_name && e.display_name !== e.username) {
+        return e.display_name;
+    }
+    return '@' + (e.username || e.user_id);
+}
+
 function formatMinutes(m: number): string {
     if (m < 60) return `${Math.round(m)}м`;
     const h = Math.floor(m / 60);
@@ -1,5 +1,6 @@
-import React, {useState, useEffect, useCallback} from 'react';
+import React, {useState, useEffect, useCallback, useRef} from 'react';
 import * as api from '../actions/api';
+import {subscribe, personalize, isFree, PluginEvent} from '../actions/events';
 import ResourceCard from './ResourceCard';
 import BookingModal from './BookingModal';
 import AdminPanel from './AdminPanel';
@@ -7,36 +8,105 @@ import HistoryPanel from './HistoryPanel';
 
 interface Props {
     theme: any;
+    currentUserId: string;
 }
 
-const RHSView: React.FC<Props> = ({theme}) => {
+// PAGE_SIZE is how many more resources "Показать ещё" loads.
+const PAGE_SIZE = 50;
+
+const RHSView: React.FC<Props> = ({theme, currentUserId}) => {
     const [statuses, setStatuses] = useState<any[]>([]);
-    const [isAdmin, setIsAdmin] = useState(false);
+    const [groups, setGroups] = useState<any[]>([]);
+    const [total, setTotal] = useState(0);
+    const [limit, setLimit] = useState(PAGE_SIZE);
+    const [canManage, setCanManage] = useState(false);
+    const [canCreate, setCanCreate] = useState(false);
     const [loading, setLoading] = useState(true);
     const [error, setError] = useState('');
     const [view, setView] = useState<'list' | 'admin' | 'history'>('list');
     const [modal, setModal] = useState<{resourceId: string; mode: 'book' | 'queue' | 'extend'} | null>(null);
     const [historyResourceId, setHistoryResourceId] = useState('');
+    const [tagFilter, setTagFilter] = useState('');
+    const [freeOnly, setFreeOnly] = useState(false);
+    const filtered = tagFilter.trim() !== '' || freeOnly;
+    const shown = useRef({statuses, total});
+    shown.current = {statuses, total};
+    const refreshTimer = useRef<any>(null);
 
     const refresh = useCallback(async () => {
         try {
-            const data = await api.getAllStatus();
+            // "in:<группа>" picks a group, as in the slash commands; the rest are tags.
+            const tokens = tagFilter.split(/[\s,]+/).filter(Boolean);
+            const group = tokens.find(t => t.startsWith('in:'))?.substring(3);
+            const data = await api.getAllStatus({tags: tokens.filter(t => !t.startsWith('in:')), group, free: freeOnly}, 0, limit);
             setStatuses(data.statuses || []);
-            setIsAdmin(data.is_admin || false);
+            setGroups(data.groups || []);
+            setTotal(data.total || 0);
+            setCanManage(data.can_manage || false);
+            setCanCreate(data.can_create || false);
             setError('');
         } catch (e: any) {
             setError(e.message);
         } finally {
             setLoading(false);
         }
-    }, []);
+    }, [tagFilter, freeOnly, limit]);
 
     useEffect(() => {
         refresh();
-        const interval = setInterval(refresh, 10000);
-        return () => clearInterval(interval);
     }, [refresh]);
 
+    // scheduleRefresh reloads the list once for a burst of events.
+    const scheduleRefresh = useCallback(() => {
+        if (!refreshTimer.current) {
+            refreshTimer.current = setTimeout(() => {
+                refreshTimer.current = null;
+                refresh();
+            }, 300);
+        }
+    }, [refresh]);
+
+    useEffect(() => () => clearTimeout(refreshTimer.current), []);
+
+    // Status events update the card in place. Anything that may change which
+    // resources match the filter, or how they are grouped, reloads the list.
+    useEffect(() => subscribe(async (ev: PluginEvent) => {
+        if (ev.type !== 'status_changed' || filtered) {
+            scheduleRefresh();
+            return;
+        }
+        const id = ev.data.resource_id;
+        const prev = shown.current.statuses.find((s: any) => s.resource.id === id);
+        if (!prev) {
+            // A new resource, or one beyond the loaded pages.
+            if (shown.current.statuses.length >= shown.current.total) {
+                scheduleRefresh();
+            }
+            return;
+        }
+        let st: any = ev.data.status ? JSON.parse(ev.data.status) : null;
+        // Approval requests and managers decide flags the event cannot carry.
+        if (!st || st.resource.approval || JSON.stringify(st.resource.managers) !== JSON.stringify(prev.resource.managers)) {
+            try {
+                st = await api.getResourceStatus(id);
+            } catch {
+                scheduleRefresh();
+                return;
+            }
+        } else {
+            st = personalize(st, JSON.parse(ev.data.subscriber_ids || '[]'), currentUserId, prev);
+        }
+        if ((st.resource.group_id || '') !== (prev.resource.group_id || '')) {
+            scheduleRefresh();
+            return;
+        }
+        setStatuses(list => list.map((s: any) => (s.resource.id === id ? st : s)));
+        const delta = Number(isFree(st)) - Number(isFree(prev));
+        if (delta !== 0 && st.resource.group_id) {
+            setGroups(nodes => adjustFree(nodes, id, delta));
+        }
+    }), [filtered, scheduleRefresh, currentUserId]);
+
     const styles = getStyles(theme);
 
     if (view === 'admin') {
@@ -46,7 +116,7 @@ const RHSView: React.FC<Props> = ({theme}) => {
                     <button style={styles.backBtn} onClick={() => {setView('list'); refresh();}}>← Назад</button>
                     <span style={styles.title}>Управление ресурсами</span>
                 </div>
-                <AdminPanel theme={theme} onBack={() => {setView('list'); refresh();}} />
+                <AdminPanel theme={theme} canCreate={canCreate} onBack={() => {setView('list'); refresh();}} />
             </div>
         );
     }
@@ -63,53 +133,126 @@ const RHSView: React.FC<Props> = ({theme}) => {
         );
     }
 
+    const byId = new Map(statuses.map((st: any) => [st.resource.id, st]));
+    const grouped = new Set<string>();
+    const collect = (node: any) => {
+        (node.resource_ids || []).forEach((id: string) => grouped.add(id));
+        (node.children || []).forEach(collect);
+    };
+    groups.forEach(collect);
+
+    const renderCard = (status: any) => (
+        <ResourceCard
+            key={status.resource.id}
+            status={status}
+            theme={theme}
+            canManage={!!status.can_manage}
+            onBook={() => setModal({resourceId: status.resource.id, mode: 'book'})}
+            onQueue={() => setModal({resourceId: status.resource.id, mode: 'queue'})}
+            onExtend={() => setModal({resourceId: status.resource.id, mode: 'extend'})}
+            onRelease={async () => {
+                try { await api.releaseResource(status.resource.id); refresh(); }
+                catch (e: any) { alert(e.message); }
+            }}
+            onAcceptTransfer={async () => {
+                try { await api.acceptTransfer(status.resource.id); refresh(); }
+                catch (e: any) { alert(e.message); }
+            }}
+            onDeclineTransfer={async () => {
+                try { await api.declineTransfer(status.resource.id); refresh(); }
+                catch (e: any) { alert(e.message); }
+            }}
+            onLeaveQueue={async () => {
+                try { await api.leaveQueue(status.resource.id); refresh(); }
+                catch (e: any) { alert(e.message); }
+            }}
+            onSubscribe={async () => {
+                try { await api.subscribeResource(status.resource.id); refresh(); }
+                catch (e: any) { alert(e.message); }
+            }}
+            onUnsubscribe={async () => {
+                try { await api.unsubscribeResource(status.resource.id); refresh(); }
+                catch (e: any) { alert(e.message); }
+            }}
+            onHistory={() => {
+                setHistoryResourceId(status.resource.id);
+                setView('history');
+            }}
+            onMaintenance={async (on: boolean) => {
+                try {
+                    if (on) {
+                        const reason = window.prompt('Причина обслуживания', '');
+                        if (reason === null) {
+                            return;
+                        }
+                        await api.startMaintenance(status.resource.id, reason);
+                    } else {
+                        await api.endMaintenance(status.resource.id);
+                    }
+                    refresh();
+                } catch (e: any) { alert(e.message); }
+            }}
+        />
+    );
+
+    const renderGroup = (node: any, depth: number): React.ReactNode => (
+        <div key={node.group.id} style={{marginLeft: depth ? '10px' : 0}}>
+            <div style={styles.groupHeader} title={node.group.description || ''}>
+                <span>{node.group.icon || '📁'} <b>{node.group.name}</b> · свободно {node.free}/{node.total}</span>
+                <button
+                    style={styles.headerBtn}
+                    title={node.is_subscribed ? 'Отписаться от группы' : 'Сообщить, когда в группе что-то освободится'}
+                    onClick={async () => {
+                        try {
+                            if (node.is_subscribed) {
+                                await api.unsubscribeGroup(node.group.id);
+                            } else {
+                                await api.subscribeGroup(node.group.id);
+                            }
+                            refresh();
+                        } catch (e: any) { alert(e.message); }
+                    }}
+                >{node.is_subscribed ? '🔔' : '🔕'}</button>
+            </div>
+            {(node.resource_ids || []).map((id: string) => byId.get(id)).filter(Boolean).map(renderCard)}
+            {(node.children || []).map((child: any) => renderGroup(child, depth + 1))}
+        </div>
+    );
+
     return (
         <div style={styles.container}>
             <div style={styles.header}>
                 <span style={styles.title}>🖥️ Ресурсы</span>
                 <div>
                     <button style={styles.headerBtn} onClick={refresh} title="Обновить">🔄</button>
-                    {isAdmin && <button style={styles.headerBtn} onClick={() => setView('admin')} title="Управление">⚙️</button>}
+                    {canManage && <button style={styles.headerBtn} onClick={() => setView('admin')} title="Управление">⚙️</button>}
                 </div>
             </div>
+            <div style={styles.filter}>
+                <input style={styles.filterInput} placeholder="🏷 Теги и группа: gpu, os:windows, in:lab-2" value={tagFilter}
+                    onChange={e => {setTagFilter(e.target.value); setLimit(PAGE_SIZE);}} />
+                <label style={{fontSize: '12px'}}>
+                    <input type="checkbox" checked={freeOnly} onChange={e => {setFreeOnly(e.target.checked); setLimit(PAGE_SIZE);}} />
+                    {' '}свободные
+                </label>
+            </div>
             {error && <div style={styles.error}>{error}</div>}
             {loading && <div style={styles.loading}>Загрузка...</div>}
-            {!loading && statuses.length === 0 && (
+            {!loading && statuses.length === 0 && filtered && (
+                <div style={styles.empty}>Нет ресурсов по фильтру.</div>
+            )}
+            {!loading && statuses.length === 0 && !filtered && (
                 <div style={styles.empty}>
-                    Ресурсы не настроены.{isAdmin ? ' Нажмите ⚙️ для добавления.' : ' Обратитесь к администратору.'}
+                    Ресурсы не настроены.{canCreate ? ' Нажмите ⚙️ для добавления.' : ' Обратитесь к администратору.'}
                 </div>
             )}
-            {statuses.map((status: any) => (
-                <ResourceCard
-                    key={status.resource.id}
-                    status={status}
-                    theme={theme}
-                    isAdmin={isAdmin}
-                    onBook={() => setModal({resourceId: status.resource.id, mode: 'book'})}
-                    onQueue={() => setModal({resourceId: status.resource.id, mode: 'queue'})}
-                    onExtend={() => setModal({resourceId: status.resource.id, mode: 'extend'})}
-                    onRelease={async () => {
-                        try { await api.releaseResource(status.resource.id); refresh(); }
-                        catch (e: any) { alert(e.message); }
-                    }}
-                    onLeaveQueue={async () => {
-                        try { await api.leaveQueue(status.resource.id); refresh(); }
-                        catch (e: any) { alert(e.message); }
-                    }}
-                    onSubscribe={async () => {
-                        try { await api.subscribeResource(status.resource.id); refresh(); }
-                        catch (e: any) { alert(e.message); }
-                    }}
-                    onUnsubscribe={async () => {
-                        try { await api.unsubscribeResource(status.resource.id); refresh(); }
-                        catch (e: any) { alert(e.message); }
-                    }}
-                    onHistory={() => {
-                        setHistoryResourceId(status.resource.id);
-                        setView('history');
-                    }}
-                />
-            ))}
+            {statuses.filter((status: any) => !grouped.has(status.resource.id)).map(renderCard)}
+            {groups.map(node => renderGroup(node, 0))}
+            {statuses.length < total && (
+                <button style={styles.moreBtn} onClick={() => setLimit(limit + PAGE_SIZE)}>
+                    Показать ещё ({statuses.length} из {total})
+                </button>
+            )}
             {modal && (
                 <BookingModal
                     resourceId={modal.resourceId}
@@ -123,6 +266,16 @@ const RHSView: React.FC<Props> = ({theme}) => {
     );
 };
 
+// adjustFree adds delta to the free count of the groups holding resource id.
+function adjustFree(nodes: any[], id: string, delta: number): any[] {
+    return nodes.map(node => {
+        const children = adjustFree(node.children || [], id, delta);
+        const holds = (node.resource_ids || []).includes(id) ||
+            children.some((c: any, i: number) => c.free !== node.children[i].free);
+        return holds ? {...node, children, free: node.free + delta} : node;
+    });
+}
+
 function getStyles(theme: any) {
     return {
         container: {
@@ -146,6 +299,24 @@ function getStyles(theme: any) {
             fontSize: '13px', padding: '4px 8px',
             color: theme?.linkColor || '#2389d7',
         },
+        moreBtn: {
+            width: '100%', padding: '6px', marginTop: '8px', fontSize: '13px', cursor: 'pointer',
+            background: 'none', borderRadius: '4px',
+            border: `1px solid ${theme?.centerChannelColor ? theme.centerChannelColor + '33' : '#ccc'}`,
+            color: theme?.linkColor || '#2389d7',
+        },
+        groupHeader: {
+            display: 'flex', justifyContent: 'space-between', alignItems: 'center',
+            fontSize: '13px', margin: '10px 0 4px',
+        },
+        filter: {
+            display: 'flex', gap: '8px', alignItems: 'center', marginBottom: '8px',
+        },
+        filterInput: {
+            flex: 1, padding: '4px 8px', fontSize: '13px', borderRadius: '4px',
+            border: `1px solid ${theme?.centerChannelColor ? theme.centerChannelColor + '33' : '#ccc'}`,
+            background: 'transparent', color: theme?.centerChannelColor || '#333',
+        },
         error: {
             padding: '8px', backgroundColor: '#ffebee', color: '#c62828',
             borderRadius: '4px', marginBottom: '8px', fontSize: '13px',
@@ -3,7 +3,7 @@ import React, {useState} from 'react';
 interface Props {
     status: any;
     theme: any;
-    isAdmin: boolean;
+    canManage: boolean;
     onBook: () => void;
     onQueue: () => void;
     onRelease: () => void;
@@ -12,16 +12,23 @@ interface Props {
     onSubscribe: () => void;
     onUnsubscribe: () => void;
     onHistory: () => void;
+    onAcceptTransfer: () => void;
+    onDeclineTransfer: () => void;
+    onMaintenance: (on: boolean) => void;
 }
 
 const ResourceCard: React.FC<Props> = ({
-    status, theme, isAdmin,
+    status, theme, canManage,
     onBook, onQueue, onRelease, onExtend, onLeaveQueue,
-    onSubscribe, onUnsubscribe, onHistory,
+    onSubscribe, onUnsubscribe, onHistory, onAcceptTransfer, onDeclineTransfer, onMaintenance,
 }) => {
     const [expanded, setExpanded] = useState(false);
-    const {resource, booking, queue, subscribers, is_holder, in_queue, is_subscribed} = status;
+    const {resource, booking, queue, subscribers, is_holder, held_for_you, in_queue, is_subscribed} = status;
     const isBooked = !!booking;
+    const bookings = status.bookings || [];
+    const capacity = status.capacity || 1;
+    const maintenance = status.in_maintenance ? resource.maintenance : null;
+    const isFull = bookings.length >= capacity || !!maintenance;
     const icon = resource.icon || '🖥️';
 
     const timeLeft = isBooked ? Math.max(0, Math.floor((new Date(booking.expires_at).getTime() - Date.now()) / 1000)) : 0;
@@ -35,18 +42,27 @@ const ResourceCard: React.FC<Props> = ({
                 <div style={styles.nameRow}>
                     <span style={styles.icon}>{icon}</span>
                     <span style={styles.name}>{resource.name}</span>
-                    <span style={styles.statusDot}>{isBooked ? '🔴' : '🟢'}</span>
+                    {resource.approval && <span title="Бронь после согласования">🔐</span>}
+                    <span style={styles.statusDot}>{maintenance ? '🛠' : (!isBooked ? '🟢' : (isFull ? '🔴' : '🟡'))}</span>
                     <span style={styles.expandArrow}>{expanded ? '▾' : '▸'}</span>
                 </div>
                 {isBooked && (
                     <div style={styles.bookingInfo}>
                         <span style={styles.username}>
-                            {is_holder ? '📌 Вы' : `@${booking.username}`}
+                            {booking.hold ? `⏳ для ${userName(booking)}` : (is_holder ? '📌 Вы' : userName(booking))}
                         </span>
                         <span style={styles.timeLeft}>⏱ {timeLeftStr}</span>
+                        {capacity > 1 && <span style={styles.timeLeft}>{bookings.length}/{capacity} мест</span>}
                     </div>
                 )}
-                {!isBooked && (
+                {maintenance && (
+                    <div style={styles.freeLabel}>
+                        На обслуживании
+                        {maintenance.ends_at && !maintenance.ends_at.startsWith('0001') && ` до ${new Date(maintenance.ends_at).toLocaleString()}`}
+                        {maintenance.reason && `: ${maintenance.reason}`}
+                    </div>
+                )}
+                {!isBooked && !maintenance && (
                     <div style={styles.freeLabel}>Свободен</div>
                 )}
                 {queue && queue.length > 0 && (
@@ -59,6 +75,7 @@ const ResourceCard: React.FC<Props> = ({
             {expanded && (
                 <div style={styles.details}>
                     {resource.ip && <div style={styles.detailRow}>📡 <code>{resource.ip}</code></div>}
+                    {resource.tags && resource.tags.length > 0 && <div style={styles.detailRow}>🏷 {resource.tags.join(', ')}</div>}
                     {resource.description && <div style={styles.detailRow}>{resource.description}</div>}
                     {resource.variables && Object.keys(resource.variables).length > 0 && (
                         <div style={styles.varsBlock}>
@@ -70,7 +87,18 @@ const ResourceCard: React.FC<Props> = ({
                             ))}
                         </div>
                     )}
-                    {isBooked && booking.purpose && (
+                    {capacity > 1 && bookings.length > 0 && (
+                        <div style={styles.queueList}>
+                            <div style={styles.subTitle}>Места {bookings.length}/{capacity}:</div>
+                            {bookings.map((b: any) => (
+                                <div key={b.user_id} style={styles.queueEntry}>
+                                    {userName(b)} — ⏱ {formatSeconds(Math.max(0, Math.floor((new Date(b.expires_at).getTime() - Date.now()) / 1000)))}
+                                    {b.purpose && <span style={styles.queuePurpose}> — {b.purpose}</span>}
+                                </div>
+                            ))}
+                        </div>
+                    )}
+                    {isBooked && capacity === 1 && booking.purpose && (
                         <div style={styles.detailRow}>🎯 {booking.purpose}</div>
                     )}
 
@@ -79,7 +107,8 @@ const ResourceCard: React.FC<Props> = ({
                             <div style={styles.subTitle}>Очередь:</div>
                             {queue.map((e: any, i: number) => (
                                 <div key={i} style={styles.queueEntry}>
-                                    {i + 1}. @{e.username}
+                                    {i + 1}. {userName(e)}
+                                    {e.priority === 2 && ' 🔥'}{e.priority === 1 && ' ⚡'}
                                     {e.purpose && <span style={styles.queuePurpose}> — {e.purpose}</span>}
                                 </div>
                             ))}
@@ -87,9 +116,27 @@ const ResourceCard: React.FC<Props> = ({
                     )}
 
                     <div style={styles.actions}>
-                        {/* Free resource — anyone can book */}
-                        {!isBooked && (
-                            <button style={styles.btnPrimary} onClick={onBook}>🔒 Занять</button>
+                        {/* A seat is free — anyone without one can book */}
+                        {!isFull && !is_holder && !held_for_you && !status.approval_pending && (
+                            <button style={styles.btnPrimary} onClick={onBook}>{resource.approval ? '📨 Запросить' : '🔒 Занять'}</button>
+                        )}
+
+                        {/* My booking request waits for an approver */}
+                        {status.approval_pending && (
+                            <span style={styles.metaTag}>⏳ Ждёт согласования</span>
+                        )}
+
+                        {/* The freed seat is held for me during the claim window */}
+                        {held_for_you && (
+                            <button style={styles.btnPrimary} onClick={onBook}>✅ Подтвердить</button>
+                        )}
+
+                        {/* A holder offers me their booking */}
+                        {status.transfer_for_you && (
+                            <>
+                                <button style={styles.btnPrimary} onClick={onAcceptTransfer}>🤝 Принять бронь</button>
+                                <button style={styles.btnSecondary} onClick={onDeclineTransfer}>✖ Отклонить</button>
+                            </>
                         )}
 
                         {/* I hold the resource */}
@@ -100,8 +147,8 @@ const ResourceCard: React.FC<Props> = ({
                             </>
                         )}
 
-                        {/* Someone else holds it — I can queue */}
-                        {isBooked && !is_holder && !in_queue && (
+                        {/* All seats are taken — I can queue */}
+                        {isFull && !maintenance && !is_holder && !held_for_you && !in_queue && (
                             <button style={styles.btnPrimary} onClick={onQueue}>📋 В очередь</button>
                         )}
 
@@ -110,9 +157,16 @@ const ResourceCard: React.FC<Props> = ({
                             <button style={styles.btnSecondary} onClick={onLeaveQueue}>🚪 Покинуть очередь</button>
                         )}
 
-                        {/* Admin can force release */}
-                        {isBooked && !is_holder && isAdmin && (
-                            <button style={styles.btnDanger} onClick={onRelease}>⚡ Освободить (админ)</button>
+                        {/* A manager can force release */}
+                        {bookings.length === 1 && !is_holder && canManage && (
+                            <button style={styles.btnDanger} onClick={onRelease}>⚡ Освободить (менеджер)</button>
+                        )}
+
+                        {/* A manager takes the resource out of service and back */}
+                        {canManage && (
+                            <button style={styles.btnSecondary} onClick={() => onMaintenance(!maintenance)}>
+                                {maintenance ? '✅ Вернуть в строй' : '🛠 На обслуживание'}
+                            </button>
                         )}
 
                         {/* Subscribe / unsubscribe */}
@@ -135,6 +189,15 @@ const ResourceCard: React.FC<Props> = ({
     );
 };
 
+// userName shows the server's display name for a user, or @username when the
+// server shows usernames.
+function userName(u: any): string {
+    if (u.display_name && u.display_name !== u.username) {
+        return u.display_name;
+    }
+    return '@' + u.username;
+}
+
 function formatSeconds(s: number): string {
     if (s <= 0) return 'истекает...';
     const h = Math.floor(s / 3600);
@@ -1,5 +1,6 @@
 import React from 'react';
 import RHSView from './components/RHSView';
+import {emit} from './actions/events';
 
 const PLUGIN_ID = 'com.scientia.resource-queue';
 
@@ -29,7 +30,8 @@ class PluginClass {
             (props: any) => {
                 const state = store.getState();
                 const theme = getTheme(state);
-                return React.createElement(RHSView, {...props, theme});
+                const currentUserId = state?.entities?.users?.currentUserId || '';
+                return React.createElement(RHSView, {...props, theme, currentUserId});
             },
             'Resource Queue'
         );
@@ -42,6 +44,11 @@ class PluginClass {
             null,
             'Resource Queue'
         );
+
+        (['status_changed', 'resource_deleted', 'groups_changed'] as const).forEach(type => {
+            registry.registerWebSocketEventHandler(`custom_${PLUGIN_ID}_${type}`, (msg: any) => emit({type, data: msg.data}));
+        });
+        registry.registerReconnectHandler(() => emit({type: 'reconnect', data: null}));
     }
 
     uninitialize() {